@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"gitlab.com/renodesper/aws-utils/pkg/iamdup"
+)
+
+// targetAccount is one account the source role is duplicated into with
+// -target-accounts, reached through a shared config profile, a role to
+// assume, or both.
+type targetAccount struct {
+	Name       string `json:"name"`
+	Profile    string `json:"profile"`
+	RoleArn    string `json:"roleArn"`
+	ExternalID string `json:"externalId"`
+}
+
+// accountSummary is the JSON description of one account printed with
+// -output json.
+type accountSummary struct {
+	Account string `json:"account"`
+	summary
+}
+
+// readTargetAccounts reads a JSON array of {"name", "profile", "roleArn",
+// "externalId"} objects. The name only labels the account in the report
+// and defaults to the profile or role ARN.
+func readTargetAccounts(path string) ([]targetAccount, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read target accounts file, %w", err)
+	}
+
+	var accounts []targetAccount
+	err = json.Unmarshal(data, &accounts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode target accounts file, %w", err)
+	}
+
+	for i := range accounts {
+		if accounts[i].Profile == "" && accounts[i].RoleArn == "" {
+			return nil, fmt.Errorf("target account %d has neither profile nor roleArn", i+1)
+		}
+
+		if accounts[i].RoleArn != "" {
+			_, account, err := iamdup.ParseRoleArn(accounts[i].RoleArn)
+			if err == nil && account == "" {
+				err = fmt.Errorf("role %q is not a role ARN", accounts[i].RoleArn)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("target account %d, %w", i+1, err)
+			}
+		}
+
+		if accounts[i].Name == "" {
+			accounts[i].Name = accounts[i].Profile
+			if accounts[i].RoleArn != "" {
+				accounts[i].Name = accounts[i].RoleArn
+			}
+		}
+	}
+
+	return accounts, nil
+}
+
+// duplicateRoleToAccounts reads the source role once, like loadSnapshot,
+// and duplicates it into every account of the target accounts file.
+func duplicateRoleToAccounts(ctx context.Context, clientFlags *clientFlags, duplicator *iamdup.Duplicator, path string, sourceRoleName string, importPath string, sourceFile string, target targetName, confirm bool, jsonOutput bool) error {
+	accounts, err := readTargetAccounts(path)
+	if err != nil {
+		return err
+	}
+
+	snapshot, err := loadSnapshot(ctx, duplicator, sourceRoleName, importPath, sourceFile)
+	if err != nil {
+		return err
+	}
+
+	// A role read from a file may be restored under its own name, only a
+	// live source role cannot be copied onto itself.
+	if importPath != "" || sourceFile != "" {
+		sourceRoleName = ""
+	}
+
+	return duplicateToAccounts(ctx, clientFlags, duplicator, accounts, snapshot, sourceRoleName, target.resolve(snapshot.RoleName), confirm, jsonOutput)
+}
+
+// duplicateToAccounts creates targetRoleName as a copy of snapshot in every
+// account and reports how each one went. A failing account does not stop
+// the others. sourceRoleName is the live source role snapshot was read
+// from, if any, which fails the accounts where it would be copied onto
+// itself.
+func duplicateToAccounts(ctx context.Context, clientFlags *clientFlags, duplicator *iamdup.Duplicator, accounts []targetAccount, snapshot *iamdup.Snapshot, sourceRoleName string, targetRoleName string, confirm bool, jsonOutput bool) error {
+	// The confirmations of every account share one reader of stdin.
+	stdin := bufio.NewReader(os.Stdin)
+
+	var summaries []accountSummary
+	failed := 0
+	for i, account := range accounts {
+		if duplicator.Progress != nil {
+			duplicator.Progress(i+1, len(accounts), "duplicating "+snapshot.RoleName+" to "+account.Name)
+		}
+
+		result, err := duplicateToAccount(ctx, clientFlags, duplicator, account, snapshot, sourceRoleName, targetRoleName, confirm, stdin)
+		if err != nil {
+			failed++
+		}
+
+		if result == nil {
+			result = &iamdup.Result{RoleName: targetRoleName}
+		}
+
+		summaries = append(summaries, accountSummary{
+			Account: account.Name,
+			summary: newSummary(result, err),
+		})
+	}
+
+	if jsonOutput {
+		printJSON(summaries)
+	} else {
+		for _, s := range summaries {
+			if s.Error != "" {
+				fmt.Printf("failed  %s %s: %s\n", s.Account, s.RoleName, s.Error)
+			} else {
+				fmt.Printf("ok      %s %s\n", s.Account, s.RoleName)
+			}
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d accounts failed", failed, len(accounts))
+	}
+
+	return nil
+}
+
+func duplicateToAccount(ctx context.Context, clientFlags *clientFlags, duplicator *iamdup.Duplicator, account targetAccount, snapshot *iamdup.Snapshot, sourceRoleName string, targetRoleName string, confirm bool, stdin io.Reader) (*iamdup.Result, error) {
+	cfg, err := clientFlags.loadAccountConfig(ctx, account)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load SDK config, %w", err)
+	}
+
+	if sourceRoleName != "" {
+		err = clientFlags.checkAccountSelfCopy(ctx, cfg, sourceRoleName, targetRoleName)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	d := duplicator.WithTarget(clientFlags.newClient(cfg))
+	if confirm {
+		d.Confirm = newConfirm(cfg, stdin)
+	}
+
+	return d.Import(ctx, snapshot, targetRoleName)
+}
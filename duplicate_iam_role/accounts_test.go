@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gitlab.com/renodesper/aws-utils/pkg/iamdup"
+)
+
+func TestTargetAccountInSourceAccountRefusesSelfCopy(t *testing.T) {
+	var actions []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		actions = append(actions, r.Form.Get("Action"))
+
+		w.Header().Set("Content-Type", "text/xml")
+		switch r.Form.Get("Action") {
+		case "AssumeRole":
+			fmt.Fprint(w, `<AssumeRoleResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/"><AssumeRoleResult>`+
+				`<Credentials><AccessKeyId>AKIDTARGET</AccessKeyId><SecretAccessKey>secret</SecretAccessKey><SessionToken>token</SessionToken><Expiration>2100-01-01T00:00:00Z</Expiration></Credentials>`+
+				`<AssumedRoleUser><Arn>arn:aws:sts::111111111111:assumed-role/deployer/duplicate-iam-role</Arn><AssumedRoleId>AROAEXAMPLE:duplicate-iam-role</AssumedRoleId></AssumedRoleUser>`+
+				`</AssumeRoleResult><ResponseMetadata><RequestId>1</RequestId></ResponseMetadata></AssumeRoleResponse>`)
+		case "GetCallerIdentity":
+			fmt.Fprint(w, `<GetCallerIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/"><GetCallerIdentityResult>`+
+				`<Arn>arn:aws:iam::111111111111:user/deployer</Arn><UserId>AIDAEXAMPLE</UserId><Account>111111111111</Account>`+
+				`</GetCallerIdentityResult><ResponseMetadata><RequestId>2</RequestId></ResponseMetadata></GetCallerIdentityResponse>`)
+		default:
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	fakeLoadConfig(t)
+
+	f := clientFlags{region: "us-east-1", sessionName: defaultSessionName, endpointURL: server.URL, quiet: true}
+	duplicator, err := f.newDuplicator(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	account := targetAccount{Name: "same", RoleArn: "arn:aws:iam::111111111111:role/deployer"}
+	snapshot := &iamdup.Snapshot{RoleName: "app"}
+
+	tests := []struct {
+		name           string
+		sourceRoleName string
+		targetRoleName string
+		wantErr        bool
+	}{
+		{"live source", "app", "app", true},
+		{"other name", "app", "app-copy", false},
+		{"source file", "", "app", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actions = nil
+
+			_, err := duplicateToAccount(context.Background(), &f, duplicator, account, snapshot, tt.sourceRoleName, tt.targetRoleName, false, nil)
+			if errors.Is(err, errSelfCopy) != tt.wantErr {
+				t.Errorf("err = %v, want self-copy error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				for _, action := range actions {
+					if action != "GetCallerIdentity" && action != "AssumeRole" {
+						t.Errorf("%s called before refusing the copy", action)
+					}
+				}
+			}
+		})
+	}
+}
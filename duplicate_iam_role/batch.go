@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"gitlab.com/renodesper/aws-utils/pkg/iamdup"
+)
+
+// batchPair is one source role to duplicate in batch mode, each role given
+// as a name or as a role ARN. An empty target is derived from the source
+// with -target-prefix and -target-suffix.
+type batchPair struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+
+	// sourceAccount and targetAccount are the account IDs of the roles
+	// given as ARNs, replaced by their names by readBatch.
+	sourceAccount string
+	targetAccount string
+}
+
+// batchSummary is the JSON description of one pair printed with
+// -output json.
+type batchSummary struct {
+	Source  string `json:"source"`
+	Skipped bool   `json:"skipped,omitempty"`
+	summary
+}
+
+// readBatch reads the pairs of a batch file, either a JSON array of
+// {"source", "target"} objects or CSV lines of source,target.
+func readBatch(path string) ([]batchPair, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read batch file, %w", err)
+	}
+
+	var pairs []batchPair
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		err = json.Unmarshal(trimmed, &pairs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode batch file, %w", err)
+		}
+	} else {
+		pairs, err = readBatchCSV(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode batch file, %w", err)
+		}
+	}
+
+	for i := range pairs {
+		pair := &pairs[i]
+		if pair.Source == "" {
+			return nil, fmt.Errorf("batch pair %d has no source", i+1)
+		}
+
+		pair.Source, pair.sourceAccount, err = iamdup.ParseRoleArn(pair.Source)
+		if err != nil {
+			return nil, fmt.Errorf("batch pair %d, %w", i+1, err)
+		}
+
+		if pair.Target != "" {
+			pair.Target, pair.targetAccount, err = iamdup.ParseRoleArn(pair.Target)
+			if err != nil {
+				return nil, fmt.Errorf("batch pair %d, %w", i+1, err)
+			}
+		}
+	}
+
+	return pairs, nil
+}
+
+func readBatchCSV(r io.Reader) ([]batchPair, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+
+	var pairs []batchPair
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return pairs, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		if len(record) > 2 {
+			line, _ := reader.FieldPos(0)
+			return nil, fmt.Errorf("line %d has %d fields, expected source,target", line, len(record))
+		}
+
+		pair := batchPair{Source: strings.TrimSpace(record[0])}
+		if len(record) == 2 {
+			pair.Target = strings.TrimSpace(record[1])
+		}
+		pairs = append(pairs, pair)
+	}
+}
+
+// duplicateBatch duplicates every pair of the batch file independently and
+// reports how each one went. Unless continueOnError is set the remaining
+// pairs are skipped after the first failure.
+func duplicateBatch(ctx context.Context, clientFlags *clientFlags, duplicator *iamdup.Duplicator, path string, target targetName, continueOnError bool, jsonOutput bool) error {
+	pairs, err := readBatch(path)
+	if err != nil {
+		return err
+	}
+
+	var sourceAccounts, targetAccounts []string
+	for _, pair := range pairs {
+		if pair.sourceAccount != "" {
+			sourceAccounts = append(sourceAccounts, pair.sourceAccount)
+		}
+		if pair.targetAccount != "" {
+			targetAccounts = append(targetAccounts, pair.targetAccount)
+		}
+	}
+
+	err = clientFlags.checkAccounts(ctx, sourceAccounts, targetAccounts)
+	if err != nil {
+		return err
+	}
+
+	for i, pair := range pairs {
+		if pair.Target == "" && !target.derived() {
+			return fmt.Errorf("batch pair %d has no target, set it or use target-prefix or target-suffix", i+1)
+		}
+
+		targetRoleName := pair.Target
+		if targetRoleName == "" {
+			targetRoleName = target.resolve(pair.Source)
+		}
+
+		err = iamdup.ValidateRoleName(targetRoleName)
+		if err != nil {
+			return fmt.Errorf("batch pair %d, %w", i+1, err)
+		}
+
+		err = clientFlags.checkSelfCopy(ctx, pair.Source, targetRoleName)
+		if err != nil {
+			return fmt.Errorf("batch pair %d, %w", i+1, err)
+		}
+	}
+
+	var summaries []batchSummary
+	failed := 0
+	for i, pair := range pairs {
+		targetRoleName := pair.Target
+		if targetRoleName == "" {
+			targetRoleName = target.resolve(pair.Source)
+		}
+
+		if failed > 0 && !continueOnError {
+			summaries = append(summaries, batchSummary{
+				Source:  pair.Source,
+				Skipped: true,
+				summary: newSummary(&iamdup.Result{RoleName: targetRoleName}, nil),
+			})
+			continue
+		}
+
+		if duplicator.Progress != nil {
+			duplicator.Progress(i+1, len(pairs), "duplicating "+pair.Source+" to "+targetRoleName)
+		}
+
+		result, err := duplicator.Duplicate(ctx, pair.Source, targetRoleName)
+		if errors.Is(err, iamdup.ErrRoleExists) {
+			err = fmt.Errorf("%w, use -overwrite to update it", err)
+		}
+		if err != nil {
+			failed++
+		}
+
+		if result == nil {
+			result = &iamdup.Result{RoleName: targetRoleName}
+		}
+
+		summaries = append(summaries, batchSummary{
+			Source:  pair.Source,
+			summary: newSummary(result, err),
+		})
+	}
+
+	printBatch(summaries, jsonOutput)
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d roles failed to duplicate", failed, len(pairs))
+	}
+
+	return nil
+}
+
+// printBatch reports the outcome of each role of a batch, as JSON with
+// -output json.
+func printBatch(summaries []batchSummary, jsonOutput bool) {
+	if jsonOutput {
+		printJSON(summaries)
+	} else {
+		for _, s := range summaries {
+			switch {
+			case s.Skipped:
+				fmt.Printf("skipped %s -> %s\n", s.Source, s.RoleName)
+			case s.Error != "":
+				fmt.Printf("failed  %s -> %s: %s\n", s.Source, s.RoleName, s.Error)
+			default:
+				fmt.Printf("ok      %s -> %s\n", s.Source, s.RoleName)
+			}
+		}
+	}
+}
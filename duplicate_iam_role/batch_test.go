@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadBatchParsesRoleArns(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []batchPair
+		wantErr bool
+	}{
+		{
+			name:    "CSV",
+			content: "app,app-copy\narn:aws:iam::111111111111:role/team/web,arn:aws:iam::222222222222:role/web\nworker\n",
+			want: []batchPair{
+				{Source: "app", Target: "app-copy"},
+				{Source: "web", Target: "web", sourceAccount: "111111111111", targetAccount: "222222222222"},
+				{Source: "worker"},
+			},
+		},
+		{
+			name:    "JSON",
+			content: `[{"source": "arn:aws:iam::111111111111:role/app", "target": "app-copy"}]`,
+			want:    []batchPair{{Source: "app", Target: "app-copy", sourceAccount: "111111111111"}},
+		},
+		{
+			name:    "malformed ARN",
+			content: "arn:aws:iam::111111111111:user/app,app-copy\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "batch")
+			err := os.WriteFile(path, []byte(tt.content), 0o600)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			pairs, err := readBatch(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readBatch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(pairs, tt.want) {
+				t.Errorf("readBatch() = %+v, want %+v", pairs, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,543 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"math/rand"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+
+	"gitlab.com/renodesper/aws-utils/pkg/iamdup"
+)
+
+// loadConfig loads an SDK configuration. It is a variable so that the
+// options built from the flags can be inspected without real credentials.
+var loadConfig = config.LoadDefaultConfig
+
+// clientFlags are the flags shared by every command that select how the
+// source and target IAM clients are built and used.
+type clientFlags struct {
+	profile       string
+	region        string
+	targetProfile string
+	targetRoleArn string
+	externalID    string
+	mfaSerial     string
+
+	assumeRoleDuration time.Duration
+	sessionName        string
+
+	maxAttempts    int
+	retryBaseDelay time.Duration
+	httpTimeout    time.Duration
+	endpointURL    string
+
+	concurrency int
+	verbose     bool
+	quiet       bool
+
+	timeout time.Duration
+
+	// apiCalls prints the calls counted in calls at the end of the run.
+	apiCalls bool
+	calls    iamdup.CallCounter
+
+	// sourceCfg and targetCfg are the configurations of the source and
+	// target clients, set by newDuplicator.
+	sourceCfg aws.Config
+	targetCfg aws.Config
+
+	// sourceAccount caches the account of sourceCfg once retrieved by
+	// inSourceAccount.
+	sourceAccount string
+}
+
+func (f *clientFlags) register(flags *flag.FlagSet) {
+	flags.StringVar(&f.profile, "profile", "", "shared config profile used to read the source, defaults to the SDK's resolution")
+	flags.StringVar(&f.region, "region", "", "region used to build the IAM clients, defaults to the SDK's resolution")
+	flags.StringVar(&f.targetProfile, "target-profile", "", "shared config profile used to write to the target account")
+	flags.StringVar(&f.targetRoleArn, "target-role-arn", "", "role to assume when writing to the target account")
+	flags.StringVar(&f.externalID, "external-id", "", "external ID passed when assuming -target-role-arn")
+	flags.StringVar(&f.mfaSerial, "mfa-serial", "", "serial number or ARN of the MFA device used when assuming -target-role-arn, the token code is read from stdin")
+	flags.DurationVar(&f.assumeRoleDuration, "assume-role-duration", 0, "duration of the -target-role-arn session, between 15m and 12h and at most the role's maximum session duration, defaults to the SDK's 15m")
+	flags.StringVar(&f.sessionName, "session-name", defaultSessionName, "name of the -target-role-arn session, shown in the CloudTrail events of the target account")
+	flags.IntVar(&f.maxAttempts, "max-attempts", 0, "maximum attempts the SDK makes for each API call, including throttled ones, defaults to the SDK's value; -copy-count repeats the whole duplication instead")
+	flags.DurationVar(&f.retryBaseDelay, "retry-base-delay", 0, "initial delay of the exponential backoff between attempts, defaults to the SDK's backoff")
+	flags.DurationVar(&f.httpTimeout, "http-timeout", 0, "timeout of each HTTP request, a timed out attempt is retried up to -max-attempts; -timeout bounds the whole run")
+	flags.StringVar(&f.endpointURL, "endpoint-url", "", "send every IAM and STS call to this URL, such as http://localhost:4566 for LocalStack")
+	flags.IntVar(&f.concurrency, "concurrency", iamdup.DefaultConcurrency, "number of inline policies fetched or managed policies attached at once")
+	flags.BoolVar(&f.verbose, "verbose", false, "log every API call and its result")
+	flags.BoolVar(&f.verbose, "v", false, "shorthand for -verbose")
+	flags.BoolVar(&f.quiet, "quiet", false, "do not log the source and target accounts at startup nor show progress")
+	flags.BoolVar(&f.apiCalls, "api-calls", false, "print the number of calls made to each IAM API at the end of the run")
+	flags.DurationVar(&f.timeout, "timeout", 0, "abort the run when it takes longer than this, no limit when zero")
+	flags.Func("log-format", "format of the logs on stderr, text or json for one JSON event per line, defaults to text", setLogFormat)
+}
+
+// context returns the context of a run, cancelled after the timeout when
+// one was given.
+func (f *clientFlags) context() (context.Context, context.CancelFunc) {
+	if f.timeout > 0 {
+		return context.WithTimeout(context.Background(), f.timeout)
+	}
+
+	return context.WithCancel(context.Background())
+}
+
+// timeoutError tells that err was caused by the timeout. The step that was
+// in progress is already named by the wrapped errors.
+func (f *clientFlags) timeoutError(err error) error {
+	if f.timeout > 0 && errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("timed out after %s, %w", f.timeout, err)
+	}
+
+	return err
+}
+
+// deniedError names the missing permission and the target caller when err
+// was caused by a call the target credentials are not allowed to make.
+func (f *clientFlags) deniedError(ctx context.Context, err error) error {
+	action := iamdup.DeniedAction(err)
+	if action == "" {
+		return err
+	}
+
+	identity, identityErr := sts.NewFromConfig(f.targetCfg).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if identityErr != nil {
+		return fmt.Errorf("missing %s permission, %w", action, err)
+	}
+
+	return fmt.Errorf("missing %s permission for %s, %w", action, *identity.Arn, err)
+}
+
+// checkPermissions runs duplicator.CheckPermissions for the IAM entity of
+// the target credentials. A caller not allowed to simulate its own
+// policies only gets a warning.
+func (f *clientFlags) checkPermissions(ctx context.Context, duplicator *iamdup.Duplicator) error {
+	identity, err := sts.NewFromConfig(f.targetCfg).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return fmt.Errorf("unable to get target caller identity, %w", err)
+	}
+
+	err = duplicator.CheckPermissions(ctx, iamdup.PrincipalArn(*identity.Arn))
+	if iamdup.IsAccessDenied(err) {
+		logWarning(fmt.Sprintf("permissions not checked, %v", err))
+		return nil
+	}
+
+	return err
+}
+
+// newDuplicator returns a Duplicator reading through the default
+// configuration and writing through the target configuration.
+func (f *clientFlags) newDuplicator(ctx context.Context) (*iamdup.Duplicator, error) {
+	// Using the SDK's default configuration, loading additional config
+	// and credentials values from the environment variables, shared
+	// credentials, and shared configuration files
+	if f.endpointURL != "" {
+		endpoint, err := url.Parse(f.endpointURL)
+		if err != nil || endpoint.Scheme == "" || endpoint.Host == "" {
+			return nil, fmt.Errorf("invalid endpoint URL %q, expected a URL such as http://localhost:4566", f.endpointURL)
+		}
+	}
+
+	opts := f.loadOptions()
+	sourceOpts := opts
+	if f.profile != "" {
+		sourceOpts = append(sourceOpts[:len(sourceOpts):len(sourceOpts)], config.WithSharedConfigProfile(f.profile))
+	}
+
+	cfg, err := loadConfig(ctx, sourceOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load SDK config, %w", err)
+	}
+
+	if f.targetRoleArn == "" && (f.externalID != "" || f.mfaSerial != "" || f.assumeRoleDuration != 0) {
+		return nil, fmt.Errorf("external-id, mfa-serial and assume-role-duration require target-role-arn")
+	}
+
+	if f.assumeRoleDuration != 0 {
+		err = validateAssumeRoleDuration(f.assumeRoleDuration)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = validateSessionName(f.sessionName)
+	if err != nil {
+		return nil, err
+	}
+
+	targetCfg, err := loadTargetConfig(ctx, cfg, f.targetProfile, f.targetRoleArn, opts, f.assumeRoleOptions)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load target SDK config, %w", err)
+	}
+
+	f.sourceCfg = cfg
+	f.targetCfg = targetCfg
+
+	if !f.quiet {
+		err = logCallerIdentity(ctx, "source", cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		if f.targetProfile != "" || f.targetRoleArn != "" {
+			err = logCallerIdentity(ctx, "target", targetCfg)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	duplicator := iamdup.New(f.newClient(cfg))
+	duplicator.Target = f.newClient(targetCfg)
+	duplicator.Concurrency = f.concurrency
+	duplicator.Warn = logWarning
+
+	return duplicator, nil
+}
+
+// printAPICalls prints on stderr the calls made so far with -api-calls.
+func (f *clientFlags) printAPICalls() {
+	if !f.apiCalls {
+		return
+	}
+
+	counts := f.calls.Counts()
+	ops := make([]string, 0, len(counts))
+	total := 0
+	for op, count := range counts {
+		ops = append(ops, op)
+		total += count
+	}
+	sort.Strings(ops)
+
+	for _, op := range ops {
+		fmt.Fprintf(os.Stderr, "%s %d\n", op, counts[op])
+	}
+	fmt.Fprintf(os.Stderr, "total %d API calls\n", total)
+}
+
+// newClient returns an IAM client for cfg, counting every call and logging
+// it with -verbose.
+func (f *clientFlags) newClient(cfg aws.Config) iamdup.IAMClient {
+	var client iamdup.IAMClient = &iamdup.CountingClient{IAMClient: iam.NewFromConfig(cfg), Counter: &f.calls}
+	if f.verbose && jsonLogs {
+		client = &iamdup.LoggingClient{IAMClient: client, StructuredLogger: slog.Default()}
+	} else if f.verbose {
+		client = &iamdup.LoggingClient{IAMClient: client, Logger: log.New(os.Stderr, "", log.LstdFlags)}
+	}
+
+	return client
+}
+
+// loadAccountConfig returns the configuration writing to account, built
+// like the target configuration from the account's profile and role.
+func (f *clientFlags) loadAccountConfig(ctx context.Context, account targetAccount) (aws.Config, error) {
+	return loadTargetConfig(ctx, f.sourceCfg, account.Profile, account.RoleArn, f.loadOptions(), f.assumeRoleOptions, func(o *stscreds.AssumeRoleOptions) {
+		if account.ExternalID != "" {
+			o.ExternalID = aws.String(account.ExternalID)
+		}
+	})
+}
+
+// sameAccount reports whether the target configuration writes to the
+// account of the source one. Without target-profile nor target-role-arn
+// both use the same credentials, otherwise their caller identities are
+// compared.
+func (f *clientFlags) sameAccount(ctx context.Context) (bool, error) {
+	if f.targetProfile == "" && f.targetRoleArn == "" {
+		return true, nil
+	}
+
+	return f.inSourceAccount(ctx, f.targetCfg)
+}
+
+// inSourceAccount reports whether cfg writes to the account of the source
+// configuration, by comparing their caller identities. The source one is
+// only retrieved once.
+func (f *clientFlags) inSourceAccount(ctx context.Context, cfg aws.Config) (bool, error) {
+	if f.sourceAccount == "" {
+		source, err := sts.NewFromConfig(f.sourceCfg).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+		if err != nil {
+			return false, fmt.Errorf("unable to get source caller identity, %w", err)
+		}
+		f.sourceAccount = *source.Account
+	}
+
+	target, err := sts.NewFromConfig(cfg).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return false, fmt.Errorf("unable to get target caller identity, %w", err)
+	}
+
+	return f.sourceAccount == *target.Account, nil
+}
+
+// errSelfCopy is returned when the target role is the source role itself,
+// which the copy would overwrite with its own, transformed, definition.
+var errSelfCopy = errors.New("role would be copied onto itself")
+
+// checkSelfCopy fails with errSelfCopy when targetRoleName is
+// sourceRoleName and the target configuration writes to the source
+// account. Without target-profile nor target-role-arn no call is made.
+func (f *clientFlags) checkSelfCopy(ctx context.Context, sourceRoleName string, targetRoleName string) error {
+	if sourceRoleName != targetRoleName {
+		return nil
+	}
+
+	same, err := f.sameAccount(ctx)
+	if err != nil {
+		return err
+	}
+	if same {
+		return fmt.Errorf("target role %s: %w, set target-profile or target-role-arn to copy it to another account", targetRoleName, errSelfCopy)
+	}
+
+	return nil
+}
+
+// checkAccountSelfCopy is checkSelfCopy for cfg, the configuration of an
+// account of the target accounts file, which may be the source account.
+func (f *clientFlags) checkAccountSelfCopy(ctx context.Context, cfg aws.Config, sourceRoleName string, targetRoleName string) error {
+	if sourceRoleName != targetRoleName {
+		return nil
+	}
+
+	same, err := f.inSourceAccount(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	if same {
+		return fmt.Errorf("target role %s: %w, the account is the source account", targetRoleName, errSelfCopy)
+	}
+
+	return nil
+}
+
+// checkAccounts fails when one of sourceAccounts, the account IDs of the
+// role ARNs given for source roles, is not the account of the source
+// configuration, or one of targetAccounts is not the account of the
+// target configuration. Only the role name of an ARN is used, so a role of
+// another account would otherwise be read or written in the account of
+// the credentials.
+func (f *clientFlags) checkAccounts(ctx context.Context, sourceAccounts []string, targetAccounts []string) error {
+	sides := []struct {
+		kind     string
+		cfg      aws.Config
+		accounts []string
+	}{
+		{"source", f.sourceCfg, sourceAccounts},
+		{"target", f.targetCfg, targetAccounts},
+	}
+
+	for _, side := range sides {
+		if len(side.accounts) == 0 {
+			continue
+		}
+
+		identity, err := sts.NewFromConfig(side.cfg).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+		if err != nil {
+			return fmt.Errorf("unable to get %s caller identity, %w", side.kind, err)
+		}
+
+		for _, account := range side.accounts {
+			if account != *identity.Account {
+				return fmt.Errorf("%s role ARN is in account %s, not in account %s of the %s credentials", side.kind, account, *identity.Account, side.kind)
+			}
+		}
+	}
+
+	return nil
+}
+
+// logCallerIdentity logs the account and ARN of the credentials of cfg, so
+// that a run against the wrong account is noticed before anything happens.
+func logCallerIdentity(ctx context.Context, name string, cfg aws.Config) error {
+	identity, err := sts.NewFromConfig(cfg).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return fmt.Errorf("unable to get %s caller identity, %w", name, err)
+	}
+
+	if jsonLogs {
+		slog.Info("caller identity", "kind", name, "account", *identity.Account, "arn", *identity.Arn)
+		return nil
+	}
+
+	log.Printf("%s account %s as %s", name, *identity.Account, *identity.Arn)
+	return nil
+}
+
+// loadOptions returns the options passed to config.LoadDefaultConfig. An
+// empty region keeps the SDK's default region resolution.
+//
+// The HTTP timeout applies to every attempt of an API call, while the
+// -timeout context covers the whole run, retries and backoff included, so
+// the run stops at whichever expires first.
+func (f *clientFlags) loadOptions() []func(*config.LoadOptions) error {
+	var opts []func(*config.LoadOptions) error
+
+	if f.region != "" {
+		opts = append(opts, config.WithRegion(f.region))
+	}
+
+	if f.maxAttempts > 0 || f.retryBaseDelay > 0 {
+		opts = append(opts, config.WithRetryer(newRetryer(f.maxAttempts, f.retryBaseDelay)))
+	}
+
+	if f.httpTimeout > 0 {
+		opts = append(opts, config.WithHTTPClient(awshttp.NewBuildableClient().WithTimeout(f.httpTimeout)))
+	}
+
+	if f.endpointURL != "" {
+		opts = append(opts, config.WithEndpointResolver(staticEndpoint(f.endpointURL)))
+	}
+
+	return opts
+}
+
+// staticEndpoint resolves every service to endpointURL. Requests are signed for
+// the client's region, or us-east-1 like the global IAM endpoint when no
+// region is set.
+func staticEndpoint(endpointURL string) aws.EndpointResolver {
+	return aws.EndpointResolverFunc(func(service string, region string) (aws.Endpoint, error) {
+		if region == "" {
+			region = "us-east-1"
+		}
+
+		return aws.Endpoint{URL: endpointURL, HostnameImmutable: true, SigningRegion: region}, nil
+	})
+}
+
+// newRetryer returns the SDK's standard retryer, which already retries
+// Throttling and RequestLimitExceeded errors, with the given number of
+// attempts and an exponential backoff starting at baseDelay. Zero values
+// keep the SDK's defaults.
+func newRetryer(maxAttempts int, baseDelay time.Duration) func() aws.Retryer {
+	return func() aws.Retryer {
+		return retry.NewStandard(func(o *retry.StandardOptions) {
+			if maxAttempts > 0 {
+				o.MaxAttempts = maxAttempts
+			}
+
+			if baseDelay > 0 {
+				o.Backoff = exponentialBackoff(baseDelay, o.MaxBackoff)
+			}
+		})
+	}
+}
+
+// exponentialBackoff doubles baseDelay on every attempt, up to maxDelay,
+// and picks a random delay below that bound.
+func exponentialBackoff(baseDelay time.Duration, maxDelay time.Duration) retry.BackoffDelayer {
+	return retry.BackoffDelayerFunc(func(attempt int, err error) (time.Duration, error) {
+		delay := maxDelay
+		if attempt < 32 && baseDelay<<attempt < maxDelay {
+			delay = baseDelay << attempt
+		}
+
+		return time.Duration(rand.Int63n(int64(delay)) + 1), nil
+	})
+}
+
+// Bounds of the duration of an assumed role session accepted by STS.
+const (
+	minAssumeRoleDuration = 15 * time.Minute
+	maxAssumeRoleDuration = 12 * time.Hour
+)
+
+// validateAssumeRoleDuration checks duration against the bounds of STS.
+// The maximum session duration of the target role itself usually cannot be
+// read before assuming it, so a longer duration is left to STS to reject.
+func validateAssumeRoleDuration(duration time.Duration) error {
+	if duration < minAssumeRoleDuration || duration > maxAssumeRoleDuration {
+		return fmt.Errorf("assume role duration %s must be between %s and %s", duration, minAssumeRoleDuration, maxAssumeRoleDuration)
+	}
+
+	return nil
+}
+
+// defaultSessionName is the name of the target role session, so that the
+// calls of the tool can be told apart in CloudTrail.
+const defaultSessionName = "aws-utils-duplicate-role"
+
+var sessionNamePattern = regexp.MustCompile(`^[\w+=,.@-]{2,64}$`)
+
+// validateSessionName checks that name is a role session name STS accepts.
+func validateSessionName(name string) error {
+	if !sessionNamePattern.MatchString(name) {
+		return fmt.Errorf("session name %q must be 2 to 64 letters, digits or +=,.@_-", name)
+	}
+
+	return nil
+}
+
+// assumeRoleOptions sets the session name, external ID, MFA device and
+// session duration used to assume the target role.
+func (f *clientFlags) assumeRoleOptions(o *stscreds.AssumeRoleOptions) {
+	o.RoleSessionName = f.sessionName
+
+	if f.assumeRoleDuration != 0 {
+		o.Duration = f.assumeRoleDuration
+	}
+
+	if f.externalID != "" {
+		o.ExternalID = aws.String(f.externalID)
+	}
+
+	if f.mfaSerial != "" {
+		o.SerialNumber = aws.String(f.mfaSerial)
+		o.TokenProvider = stdinTokenProvider
+	}
+}
+
+// stdinTokenProvider prompts on stderr for an MFA token code and reads it
+// from stdin, leaving stdout to the output of the command.
+func stdinTokenProvider() (string, error) {
+	fmt.Fprint(os.Stderr, "Assume role MFA token code: ")
+
+	var code string
+	_, err := fmt.Scanln(&code)
+	if err != nil {
+		return "", fmt.Errorf("unable to read MFA token code, %w", err)
+	}
+
+	return code, nil
+}
+
+// loadTargetConfig returns the configuration used to create the target
+// role. Without a target profile or role ARN the source configuration is
+// reused, so both roles live in the same account.
+func loadTargetConfig(ctx context.Context, sourceCfg aws.Config, profile string, roleArn string, opts []func(*config.LoadOptions) error, assumeRoleOpts ...func(*stscreds.AssumeRoleOptions)) (aws.Config, error) {
+	cfg := sourceCfg
+
+	if profile != "" {
+		var err error
+		cfg, err = loadConfig(ctx, append(opts, config.WithSharedConfigProfile(profile))...)
+		if err != nil {
+			return aws.Config{}, err
+		}
+	}
+
+	if roleArn != "" {
+		provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), roleArn, assumeRoleOpts...)
+		cfg.Credentials = aws.NewCredentialsCache(provider)
+	}
+
+	return cfg, nil
+}
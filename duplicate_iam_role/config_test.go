@@ -0,0 +1,351 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+)
+
+// fakeLoadConfig replaces loadConfig for the test with one using static
+// source credentials and no shared files, and returns the options of
+// every configuration it loaded.
+func fakeLoadConfig(t *testing.T) *[]config.LoadOptions {
+	t.Helper()
+
+	empty := filepath.Join(t.TempDir(), "empty")
+	err := os.WriteFile(empty, nil, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("AWS_CONFIG_FILE", empty)
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", empty)
+
+	var loaded []config.LoadOptions
+	load := loadConfig
+	t.Cleanup(func() { loadConfig = load })
+	loadConfig = func(ctx context.Context, optFns ...func(*config.LoadOptions) error) (aws.Config, error) {
+		var options config.LoadOptions
+		for _, optFn := range optFns {
+			err := optFn(&options)
+			if err != nil {
+				return aws.Config{}, err
+			}
+		}
+		loaded = append(loaded, options)
+
+		// A profile that does not exist in the empty shared files would
+		// fail to load, it was recorded above.
+		optFns = append(optFns, config.WithSharedConfigProfile(""), config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider("AKIDSOURCE", "secret", "")))
+		return config.LoadDefaultConfig(ctx, optFns...)
+	}
+
+	return &loaded
+}
+
+func TestRegionReachesConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		region string
+	}{
+		{"set", "eu-west-1"},
+		{"default resolution", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loaded := fakeLoadConfig(t)
+			t.Setenv("AWS_REGION", "us-west-2")
+
+			f := clientFlags{region: tt.region, sessionName: defaultSessionName, quiet: true}
+			_, err := f.newDuplicator(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := tt.region
+			if want == "" {
+				want = "us-west-2"
+			}
+			if len(*loaded) != 1 || (*loaded)[0].Region != tt.region || f.sourceCfg.Region != want {
+				t.Errorf("loaded %d configs with region %q, want one with region option %q and region %q", len(*loaded), f.sourceCfg.Region, tt.region, want)
+			}
+		})
+	}
+}
+
+func TestEndpointURLReachesConfig(t *testing.T) {
+	loaded := fakeLoadConfig(t)
+
+	f := clientFlags{region: "eu-west-1", sessionName: defaultSessionName, endpointURL: "http://localhost:4566", quiet: true}
+	_, err := f.newDuplicator(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(*loaded) != 1 || (*loaded)[0].EndpointResolver == nil {
+		t.Fatalf("loaded %d configs, want one with an endpoint resolver", len(*loaded))
+	}
+
+	tests := []struct {
+		service    string
+		region     string
+		wantRegion string
+	}{
+		{"IAM", "eu-west-1", "eu-west-1"},
+		{"STS", "eu-west-1", "eu-west-1"},
+		{"IAM", "", "us-east-1"},
+	}
+
+	for _, tt := range tests {
+		endpoint, err := f.sourceCfg.EndpointResolver.ResolveEndpoint(tt.service, tt.region)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if endpoint.URL != "http://localhost:4566" || !endpoint.HostnameImmutable || endpoint.SigningRegion != tt.wantRegion {
+			t.Errorf("%s endpoint in %q = %+v, want http://localhost:4566 signed for %s", tt.service, tt.region, endpoint, tt.wantRegion)
+		}
+	}
+}
+
+func TestProfileReachesConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile string
+	}{
+		{"set", "ops"},
+		{"default resolution", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loaded := fakeLoadConfig(t)
+
+			f := clientFlags{profile: tt.profile, region: "us-east-1", sessionName: defaultSessionName, quiet: true}
+			_, err := f.newDuplicator(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(*loaded) != 1 || (*loaded)[0].SharedConfigProfile != tt.profile {
+				t.Errorf("loaded %d configs, want one with profile %q", len(*loaded), tt.profile)
+			}
+		})
+	}
+}
+
+// fakeSTS starts an STS endpoint answering every AssumeRole request with
+// credentials for the target account, and returns its URL and the forms of
+// the requests it received.
+func fakeSTS(t *testing.T) (string, *[]url.Values) {
+	t.Helper()
+
+	var forms []url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil || r.Form.Get("Action") != "AssumeRole" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		forms = append(forms, r.Form)
+
+		w.Header().Set("Content-Type", "text/xml")
+		fmt.Fprint(w, `<AssumeRoleResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/"><AssumeRoleResult>`+
+			`<Credentials><AccessKeyId>AKIDTARGET</AccessKeyId><SecretAccessKey>secret</SecretAccessKey><SessionToken>token</SessionToken><Expiration>2100-01-01T00:00:00Z</Expiration></Credentials>`+
+			`<AssumedRoleUser><Arn>arn:aws:sts::222222222222:assumed-role/deployer/release-42</Arn><AssumedRoleId>AROAEXAMPLE:release-42</AssumedRoleId></AssumedRoleUser>`+
+			`</AssumeRoleResult><ResponseMetadata><RequestId>1</RequestId></ResponseMetadata></AssumeRoleResponse>`)
+	}))
+	t.Cleanup(server.Close)
+
+	return server.URL, &forms
+}
+
+// assumeTargetRole builds the clients of f and retrieves the credentials of
+// the target role.
+func assumeTargetRole(t *testing.T, f *clientFlags) {
+	t.Helper()
+
+	ctx := context.Background()
+	_, err := f.newDuplicator(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = f.targetCfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionNameReachesAssumeRole(t *testing.T) {
+	endpointURL, forms := fakeSTS(t)
+	fakeLoadConfig(t)
+
+	assumeTargetRole(t, &clientFlags{
+		region:        "us-east-1",
+		targetRoleArn: "arn:aws:iam::222222222222:role/deployer",
+		sessionName:   "release-42",
+		endpointURL:   endpointURL,
+		quiet:         true,
+	})
+
+	if len(*forms) != 1 || (*forms)[0].Get("RoleSessionName") != "release-42" {
+		t.Errorf("AssumeRole requests = %v, want one with session name release-42", *forms)
+	}
+}
+
+func TestAssumeRoleDurationReachesAssumeRole(t *testing.T) {
+	tests := []struct {
+		name     string
+		duration time.Duration
+		want     string
+	}{
+		{"set", 2 * time.Hour, "7200"},
+		{"SDK default", 0, "900"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			endpointURL, forms := fakeSTS(t)
+			fakeLoadConfig(t)
+
+			assumeTargetRole(t, &clientFlags{
+				region:             "us-east-1",
+				targetRoleArn:      "arn:aws:iam::222222222222:role/deployer",
+				sessionName:        defaultSessionName,
+				assumeRoleDuration: tt.duration,
+				endpointURL:        endpointURL,
+				quiet:              true,
+			})
+
+			if len(*forms) != 1 || (*forms)[0].Get("DurationSeconds") != tt.want {
+				t.Errorf("AssumeRole requests = %v, want one with DurationSeconds %s", *forms, tt.want)
+			}
+		})
+	}
+}
+
+func TestMaxAttemptsReachesConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxAttempts int
+		want        int
+	}{
+		{"set", 7, 7},
+		{"SDK default", 0, retry.DefaultMaxAttempts},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeLoadConfig(t)
+
+			f := clientFlags{region: "us-east-1", sessionName: defaultSessionName, maxAttempts: tt.maxAttempts, quiet: true}
+			_, err := f.newDuplicator(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for name, cfg := range map[string]aws.Config{"source": f.sourceCfg, "target": f.targetCfg} {
+				if cfg.Retryer == nil {
+					if tt.maxAttempts != 0 {
+						t.Errorf("%s config has no retryer, want %d attempts", name, tt.want)
+					}
+					continue
+				}
+				if got := cfg.Retryer().MaxAttempts(); got != tt.want {
+					t.Errorf("%s config retries %d attempts, want %d", name, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestThrottledCallsAreRetried(t *testing.T) {
+	tests := []struct {
+		name      string
+		throttled int
+		wantCalls int
+		wantErr   bool
+	}{
+		{"succeeds after throttling", 2, 3, false},
+		{"gives up after max attempts", 5, 3, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				w.Header().Set("Content-Type", "text/xml")
+				if calls <= tt.throttled {
+					w.WriteHeader(http.StatusBadRequest)
+					fmt.Fprint(w, `<ErrorResponse><Error><Type>Sender</Type><Code>Throttling</Code><Message>Rate exceeded</Message></Error><RequestId>1</RequestId></ErrorResponse>`)
+					return
+				}
+
+				fmt.Fprint(w, `<GetRoleResponse><GetRoleResult><Role>`+
+					`<Path>/</Path><RoleName>app</RoleName><RoleId>AROAEXAMPLE</RoleId><Arn>arn:aws:iam::111111111111:role/app</Arn><CreateDate>2020-01-01T00:00:00Z</CreateDate>`+
+					`</Role></GetRoleResult><ResponseMetadata><RequestId>2</RequestId></ResponseMetadata></GetRoleResponse>`)
+			}))
+			defer server.Close()
+
+			fakeLoadConfig(t)
+
+			f := clientFlags{
+				region:         "us-east-1",
+				sessionName:    defaultSessionName,
+				maxAttempts:    3,
+				retryBaseDelay: time.Millisecond,
+				endpointURL:    server.URL,
+				quiet:          true,
+			}
+
+			_, err := f.newDuplicator(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = iam.NewFromConfig(f.sourceCfg).GetRole(context.Background(), &iam.GetRoleInput{RoleName: aws.String("app")})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetRole error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("GetRole sent %d requests, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestValidateSessionName(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{defaultSessionName, false},
+		{"ci+deploy=1,a.b@c_d-e", false},
+		{"a", true},
+		{"has space", true},
+		{"slash/name", true},
+		{strings.Repeat("a", 65), true},
+	}
+
+	for _, tt := range tests {
+		err := validateSessionName(tt.name)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("validateSessionName(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+
+	"gitlab.com/renodesper/aws-utils/pkg/iamdup"
+)
+
+// confirmUnless returns the Duplicator.Confirm of a command, nil when yes
+// skips the confirmation so that in is never read.
+func confirmUnless(yes bool, cfg aws.Config, in io.Reader) func(ctx context.Context, action string) error {
+	if yes {
+		return nil
+	}
+
+	return newConfirm(cfg, in)
+}
+
+// newConfirm returns a Duplicator.Confirm that shows the target account and
+// the pending change on stderr and reads a y/N answer from in. The account
+// is looked up once, on the first change.
+func newConfirm(cfg aws.Config, in io.Reader) func(ctx context.Context, action string) error {
+	reader := bufio.NewReader(in)
+	var account string
+
+	return func(ctx context.Context, action string) error {
+		if account == "" {
+			identity, err := sts.NewFromConfig(cfg).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+			if err != nil {
+				return fmt.Errorf("unable to get target account, %w", err)
+			}
+			account = *identity.Account
+		}
+
+		fmt.Fprintf(os.Stderr, "About to %s in account %s. Continue? [y/N] ", action, account)
+		answer, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("unable to read confirmation, %w", err)
+		}
+
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "y", "yes":
+			return nil
+		}
+
+		return fmt.Errorf("%s: %w", action, iamdup.ErrNotConfirmed)
+	}
+}
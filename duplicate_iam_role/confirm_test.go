@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+
+	"gitlab.com/renodesper/aws-utils/pkg/iamdup"
+)
+
+// failingReader fails the test when read, as stdin must not be.
+type failingReader struct {
+	t *testing.T
+}
+
+func (r failingReader) Read(p []byte) (int, error) {
+	r.t.Error("stdin read")
+	return 0, io.ErrUnexpectedEOF
+}
+
+func TestYesSkipsConfirmation(t *testing.T) {
+	confirm := confirmUnless(true, aws.Config{}, failingReader{t})
+	if confirm != nil {
+		t.Error("confirmation set despite -yes")
+	}
+}
+
+func TestConfirmReadsAnswer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+		fmt.Fprint(w, `<GetCallerIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/"><GetCallerIdentityResult>`+
+			`<Arn>arn:aws:iam::222222222222:user/deployer</Arn><UserId>AIDAEXAMPLE</UserId><Account>222222222222</Account>`+
+			`</GetCallerIdentityResult><ResponseMetadata><RequestId>1</RequestId></ResponseMetadata></GetCallerIdentityResponse>`)
+	}))
+	defer server.Close()
+
+	cfg := aws.Config{
+		Region:           "us-east-1",
+		Credentials:      credentials.NewStaticCredentialsProvider("AKIDTARGET", "secret", ""),
+		EndpointResolver: staticEndpoint(server.URL),
+	}
+
+	tests := []struct {
+		answer  string
+		wantErr error
+	}{
+		{"y\n", nil},
+		{"YES\n", nil},
+		{"n\n", iamdup.ErrNotConfirmed},
+		{"", iamdup.ErrNotConfirmed},
+	}
+
+	for _, tt := range tests {
+		err := confirmUnless(false, cfg, strings.NewReader(tt.answer))(context.Background(), "create role app-copy")
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("confirmation of %q error = %v, want %v", tt.answer, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// deleteRole removes a role together with its policies and instance
+// profile associations.
+func deleteRole(args []string) {
+	flags := flag.NewFlagSet(os.Args[0]+" delete", flag.ExitOnError)
+	var roleName string
+	var accounts []string
+	flags.Var(&roleNameFlag{name: &roleName, accounts: &accounts}, "role", "role name or ARN that we want to delete")
+	var clientFlags clientFlags
+	clientFlags.register(flags)
+	confirm := flags.Bool("confirm", false, "confirm that the role should be deleted")
+	flags.Parse(args)
+
+	if roleName == "" {
+		usageFatalf("role argument cannot be empty")
+		return
+	}
+
+	if !*confirm {
+		usageFatalf("refusing to delete role %s without -confirm", roleName)
+		return
+	}
+
+	ctx, cancel := clientFlags.context()
+	defer cancel()
+	duplicator, err := clientFlags.newDuplicator(ctx)
+	if err != nil {
+		fatal(err)
+		return
+	}
+
+	// The role is deleted through the target configuration.
+	err = clientFlags.checkAccounts(ctx, nil, accounts)
+	if err != nil {
+		fatal(clientFlags.timeoutError(err))
+		return
+	}
+
+	err = duplicator.Delete(ctx, roleName)
+	if err != nil {
+		fatal(fmt.Errorf("unable to delete role, %w", clientFlags.timeoutError(err)))
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"gitlab.com/renodesper/aws-utils/pkg/iamdup"
+)
+
+// diffRoles prints the differences between two roles, or between a role
+// and an exported snapshot, and exits with exitDifferences when there are
+// any.
+func diffRoles(args []string) {
+	flags := flag.NewFlagSet(os.Args[0]+" diff", flag.ExitOnError)
+	var sourceRoleName, targetRoleName string
+	var sourceAccounts, targetAccounts []string
+	flags.Var(&roleNameFlag{name: &sourceRoleName, accounts: &sourceAccounts}, "source", "role name or ARN that we want to compare")
+	flags.Var(&roleNameFlag{name: &targetRoleName, accounts: &targetAccounts}, "target", "role name or ARN that we want to compare against")
+	compareToFile := flags.String("compare-to-file", "", "compare the source role against a file written by -export instead of a target role, to detect drift from it, exiting with 6 when it drifted")
+	var clientFlags clientFlags
+	clientFlags.register(flags)
+	flags.Parse(args)
+
+	if sourceRoleName == "" {
+		usageFatalf("source argument cannot be empty")
+		return
+	}
+
+	if targetRoleName == "" && *compareToFile == "" {
+		usageFatalf("target argument cannot be empty, set it or use compare-to-file")
+		return
+	}
+
+	if targetRoleName != "" && *compareToFile != "" {
+		usageFatalf("target cannot be combined with compare-to-file")
+		return
+	}
+
+	ctx, cancel := clientFlags.context()
+	defer cancel()
+	duplicator, err := clientFlags.newDuplicator(ctx)
+	if err != nil {
+		fatal(err)
+		return
+	}
+
+	err = clientFlags.checkAccounts(ctx, sourceAccounts, targetAccounts)
+	if err != nil {
+		fatal(clientFlags.timeoutError(err))
+		return
+	}
+
+	var differences []iamdup.Difference
+	if *compareToFile != "" {
+		var snapshot *iamdup.Snapshot
+		snapshot, err = readSnapshotFile(*compareToFile)
+		if err != nil {
+			fatal(fmt.Errorf("unable to read %s, %w", *compareToFile, err))
+			return
+		}
+
+		differences, err = duplicator.DiffFromSnapshot(ctx, sourceRoleName, snapshot)
+	} else {
+		differences, err = duplicator.Diff(ctx, sourceRoleName, targetRoleName)
+	}
+	if err != nil {
+		fatal(fmt.Errorf("unable to diff roles, %w", clientFlags.timeoutError(err)))
+		return
+	}
+
+	for _, difference := range differences {
+		fmt.Println(difference)
+	}
+
+	if len(differences) > 0 {
+		os.Exit(exitDifferences)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+
+	"gitlab.com/renodesper/aws-utils/pkg/iamdup"
+)
+
+// Exit codes of every command, so that scripts can tell failures apart.
+const (
+	// exitFailure is used for every failure not listed below.
+	exitFailure = 1
+	// exitUsage is used for missing or invalid arguments, as the flag
+	// package does.
+	exitUsage = 2
+	// exitNotFound is used when the source, or another entity the run
+	// depends on, does not exist.
+	exitNotFound = 3
+	// exitConflict is used when the target already exists, is
+	// protected, or is not in the state the command expects.
+	exitConflict = 4
+	// exitAccessDenied is used when the credentials lack a permission.
+	exitAccessDenied = 5
+	// exitDifferences is used by diff when the compared roles differ,
+	// which is not a failure of the command itself.
+	exitDifferences = 6
+)
+
+// exitCode returns the exit code matching the cause of err.
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, errSelfCopy):
+		return exitUsage
+	case errors.Is(err, iamdup.ErrRoleExists), errors.Is(err, iamdup.ErrProtectedRole), errors.Is(err, iamdup.ErrNotLockedDown), iamdup.IsEntityAlreadyExists(err):
+		return exitConflict
+	case errors.Is(err, iamdup.ErrMissingPermissions), iamdup.IsAccessDenied(err):
+		return exitAccessDenied
+	case errors.Is(err, iamdup.ErrRoleNotFound), iamdup.IsNoSuchEntity(err):
+		return exitNotFound
+	}
+
+	return exitFailure
+}
+
+// fatal logs err and exits with the code matching its cause.
+func fatal(err error) {
+	logError(err)
+	os.Exit(exitCode(err))
+}
+
+// usageFatalf logs an argument error and exits with exitUsage.
+func usageFatalf(format string, v ...interface{}) {
+	if jsonLogs {
+		slog.Error(fmt.Sprintf(format, v...), "exit_code", exitUsage)
+	} else {
+		log.Printf(format, v...)
+	}
+	os.Exit(exitUsage)
+}
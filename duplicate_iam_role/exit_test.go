@@ -0,0 +1,39 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/aws/smithy-go"
+
+	"gitlab.com/renodesper/aws-utils/pkg/iamdup"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"role exists", fmt.Errorf("target role app: %w", iamdup.ErrRoleExists), exitConflict},
+		{"protected role", fmt.Errorf("target role prod-app: %w", iamdup.ErrProtectedRole), exitConflict},
+		{"not locked down", fmt.Errorf("target role app-copy: %w", iamdup.ErrNotLockedDown), exitConflict},
+		{"entity already exists", &iamdup.OpError{Op: "CreateRole", RoleName: "app", Err: &types.EntityAlreadyExistsException{}}, exitConflict},
+		{"access denied", &iamdup.OpError{Op: "CreateRole", RoleName: "app", Err: &smithy.GenericAPIError{Code: "AccessDenied"}}, exitAccessDenied},
+		{"missing permissions", fmt.Errorf("arn:aws:iam::111111111111:role/ci is not allowed iam:CreateRole: %w", iamdup.ErrMissingPermissions), exitAccessDenied},
+		{"role not found", fmt.Errorf("source role app: %w", iamdup.ErrRoleNotFound), exitNotFound},
+		{"no such entity", fmt.Errorf("unable to get policy, %w", &iamdup.OpError{Op: "GetPolicy", PolicyName: "p", Err: &types.NoSuchEntityException{}}), exitNotFound},
+		{"other API error", &iamdup.OpError{Op: "PutRolePolicy", RoleName: "app", PolicyName: "p", Err: &types.MalformedPolicyDocumentException{}}, exitFailure},
+		{"other error", errors.New("failure"), exitFailure},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exitCode(tt.err); got != tt.want {
+				t.Errorf("exitCode(%v) = %d, want %d", tt.err, got, tt.want)
+			}
+		})
+	}
+}
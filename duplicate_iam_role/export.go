@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gitlab.com/renodesper/aws-utils/pkg/iamdup"
+)
+
+// manifestFile is the name of the manifest written by -export-all in the
+// export directory, next to the snapshot of each role.
+const manifestFile = "manifest.json"
+
+// exportManifest lists the roles written by -export-all, so that a backup
+// can be checked and imported without guessing which files belong to it.
+type exportManifest struct {
+	ExportedAt time.Time      `json:"exportedAt"`
+	PathPrefix string         `json:"pathPrefix,omitempty"`
+	Roles      []exportedRole `json:"roles"`
+}
+
+type exportedRole struct {
+	RoleName string `json:"roleName"`
+	Arn      string `json:"arn"`
+	File     string `json:"file"`
+}
+
+// exportAll writes the snapshot of every role whose path starts with
+// pathPrefix to dir, one roleName.json file per role, and the manifest
+// listing them. Service-linked roles are skipped since they cannot be
+// imported.
+func exportAll(ctx context.Context, duplicator *iamdup.Duplicator, pathPrefix string, dir string) error {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return err
+	}
+
+	roles, err := iamdup.ListRoles(ctx, duplicator.Client, pathPrefix)
+	if err != nil {
+		return err
+	}
+
+	manifest := exportManifest{
+		ExportedAt: time.Now().UTC(),
+		PathPrefix: pathPrefix,
+		Roles:      []exportedRole{},
+	}
+
+	for _, role := range roles {
+		if iamdup.IsServiceLinkedRole(*role.Path) {
+			continue
+		}
+
+		file := *role.RoleName + ".json"
+		err = exportRole(ctx, duplicator, *role.RoleName, filepath.Join(dir, file))
+		if err != nil {
+			return fmt.Errorf("unable to export role %s, %w", *role.RoleName, err)
+		}
+
+		manifest.Roles = append(manifest.Roles, exportedRole{RoleName: *role.RoleName, Arn: *role.Arn, File: file})
+	}
+
+	f, err := os.Create(filepath.Join(dir, manifestFile))
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(f)
+	encoder.SetIndent("", "  ")
+	err = encoder.Encode(manifest)
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("unable to write manifest, %w", err)
+	}
+
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+
+	log.Printf("exported %d roles to %s", len(manifest.Roles), dir)
+	return nil
+}
+
+// importAll recreates the roles listed in the manifest of dir, written by
+// -export-all. A role trusted by another role of the manifest is imported
+// first, since IAM rejects trust policies naming roles that do not exist.
+// Every role is reported at the end, as in batch mode.
+func importAll(ctx context.Context, duplicator *iamdup.Duplicator, dir string, target targetName, continueOnError bool, jsonOutput bool) error {
+	data, err := os.ReadFile(filepath.Join(dir, manifestFile))
+	if err != nil {
+		return fmt.Errorf("unable to read manifest, %w", err)
+	}
+
+	var manifest exportManifest
+	err = json.Unmarshal(data, &manifest)
+	if err != nil {
+		return fmt.Errorf("failed to decode manifest, %w", err)
+	}
+
+	snapshots := make(map[string]*iamdup.Snapshot, len(manifest.Roles))
+	for _, role := range manifest.Roles {
+		snapshot, err := readSnapshotFile(filepath.Join(dir, role.File))
+		if err != nil {
+			return fmt.Errorf("unable to read snapshot of role %s, %w", role.RoleName, err)
+		}
+		snapshots[role.Arn] = snapshot
+
+		err = iamdup.ValidateRoleName(target.resolve(snapshot.RoleName))
+		if err != nil {
+			return fmt.Errorf("role %s, %w", role.RoleName, err)
+		}
+	}
+
+	order, err := importOrder(manifest.Roles, snapshots)
+	if err != nil {
+		return err
+	}
+
+	var summaries []batchSummary
+	failed := 0
+	for i, role := range order {
+		snapshot := snapshots[role.Arn]
+		targetRoleName := target.resolve(snapshot.RoleName)
+
+		if failed > 0 && !continueOnError {
+			summaries = append(summaries, batchSummary{
+				Source:  role.File,
+				Skipped: true,
+				summary: newSummary(&iamdup.Result{RoleName: targetRoleName}, nil),
+			})
+			continue
+		}
+
+		if duplicator.Progress != nil {
+			duplicator.Progress(i+1, len(order), "importing "+role.File+" to "+targetRoleName)
+		}
+
+		result, err := duplicator.Import(ctx, snapshot, targetRoleName)
+		if errors.Is(err, iamdup.ErrRoleExists) {
+			err = fmt.Errorf("%w, use -overwrite to update it", err)
+		}
+		if err != nil {
+			failed++
+		}
+
+		if result == nil {
+			result = &iamdup.Result{RoleName: targetRoleName}
+		}
+
+		summaries = append(summaries, batchSummary{
+			Source:  role.File,
+			summary: newSummary(result, err),
+		})
+	}
+
+	printBatch(summaries, jsonOutput)
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d roles failed to import", failed, len(order))
+	}
+
+	return nil
+}
+
+// importOrder returns roles sorted so that every role comes after the
+// roles of the manifest its trust policy names. Roles trusting each other
+// keep the manifest order.
+func importOrder(roles []exportedRole, snapshots map[string]*iamdup.Snapshot) ([]exportedRole, error) {
+	byArn := make(map[string]exportedRole, len(roles))
+	for _, role := range roles {
+		byArn[role.Arn] = role
+	}
+
+	var order []exportedRole
+	visited := make(map[string]bool, len(roles))
+	var visit func(role exportedRole) error
+	visit = func(role exportedRole) error {
+		if visited[role.Arn] {
+			return nil
+		}
+		visited[role.Arn] = true
+
+		trusted, err := iamdup.TrustedRoleArns(snapshots[role.Arn].AssumeRolePolicyDocument)
+		if err != nil {
+			return fmt.Errorf("unable to read trust principals of role %s, %w", role.RoleName, err)
+		}
+
+		for _, arn := range trusted {
+			if dependency, ok := byArn[arn]; ok {
+				err = visit(dependency)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		order = append(order, role)
+		return nil
+	}
+
+	for _, role := range roles {
+		err := visit(role)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return order, nil
+}
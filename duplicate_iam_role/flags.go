@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"gitlab.com/renodesper/aws-utils/pkg/iamdup"
+)
+
+// stringsFlag collects the values of a flag that may be repeated.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringsFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// roleNameFlag holds a role name, given as a name or as a role ARN. The
+// account ID of an ARN is added to accounts, so that it can be checked
+// against the caller identity with checkAccounts.
+type roleNameFlag struct {
+	name     *string
+	accounts *[]string
+}
+
+func (f *roleNameFlag) String() string {
+	if f.name == nil {
+		return ""
+	}
+	return *f.name
+}
+
+func (f *roleNameFlag) Set(value string) error {
+	roleName, account, err := iamdup.ParseRoleArn(value)
+	if err != nil {
+		return err
+	}
+
+	*f.name = roleName
+	if account != "" {
+		*f.accounts = append(*f.accounts, account)
+	}
+	return nil
+}
+
+// roleNamesFlag collects the role names of a flag that may be repeated,
+// each given as a name or as a role ARN, like roleNameFlag.
+type roleNamesFlag struct {
+	names    *[]string
+	accounts *[]string
+}
+
+func (f *roleNamesFlag) String() string {
+	if f.names == nil {
+		return ""
+	}
+	return strings.Join(*f.names, ",")
+}
+
+func (f *roleNamesFlag) Set(value string) error {
+	roleName, account, err := iamdup.ParseRoleArn(value)
+	if err != nil {
+		return err
+	}
+
+	*f.names = append(*f.names, roleName)
+	if account != "" {
+		*f.accounts = append(*f.accounts, account)
+	}
+	return nil
+}
+
+// tagsFlag collects repeated key=value flags as tags.
+type tagsFlag []iamdup.Tag
+
+func (f *tagsFlag) String() string {
+	pairs := make([]string, 0, len(*f))
+	for _, tag := range *f {
+		pairs = append(pairs, tag.Key+"="+tag.Value)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (f *tagsFlag) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return fmt.Errorf("tag %q must be in the key=value form", value)
+	}
+
+	*f = append(*f, iamdup.Tag{Key: parts[0], Value: parts[1]})
+	return nil
+}
+
+// replacementsFlag collects repeated old=new flags as replacements. The
+// -replace and -replace-regex flags share one list so that replacements
+// run in the order they were given.
+type replacementsFlag struct {
+	replacements *[]iamdup.Replacement
+	regex        bool
+}
+
+func (f replacementsFlag) String() string {
+	if f.replacements == nil {
+		return ""
+	}
+
+	pairs := make([]string, 0, len(*f.replacements))
+	for _, replacement := range *f.replacements {
+		if replacement.Regex == f.regex {
+			pairs = append(pairs, replacement.Old+"="+replacement.New)
+		}
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (f replacementsFlag) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return fmt.Errorf("replacement %q must be in the old=new form", value)
+	}
+
+	*f.replacements = append(*f.replacements, iamdup.Replacement{Old: parts[0], New: parts[1], Regex: f.regex})
+	return nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestRoleNameFlagsKeepAccounts(t *testing.T) {
+	var sourceAccounts, targetAccounts []string
+	var sourceRoleNames []string
+	var targetRoleName string
+
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	flags.Var(&roleNamesFlag{names: &sourceRoleNames, accounts: &sourceAccounts}, "source", "")
+	flags.Var(&roleNameFlag{name: &targetRoleName, accounts: &targetAccounts}, "target", "")
+
+	err := flags.Parse([]string{"-source", "app", "-source", "arn:aws:iam::111111111111:role/team/web", "-target", "arn:aws:iam::222222222222:role/merged"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"app", "web"}; !reflect.DeepEqual(sourceRoleNames, want) {
+		t.Errorf("source role names = %q, want %q", sourceRoleNames, want)
+	}
+	if want := []string{"111111111111"}; !reflect.DeepEqual(sourceAccounts, want) {
+		t.Errorf("source accounts = %q, want %q", sourceAccounts, want)
+	}
+	if targetRoleName != "merged" || !reflect.DeepEqual(targetAccounts, []string{"222222222222"}) {
+		t.Errorf("target = %q in %q, want merged in 222222222222", targetRoleName, targetAccounts)
+	}
+
+	err = flags.Parse([]string{"-target", "arn:aws:iam::222222222222:role/"})
+	if err == nil {
+		t.Error("Parse() accepted a role ARN without name")
+	}
+}
@@ -1,9 +1,19 @@
 module gitlab.com/renodesper/aws-utils
 
-go 1.16
+go 1.21
 
 require (
-	github.com/aws/aws-sdk-go-v2 v1.8.0 // indirect
+	github.com/aws/aws-sdk-go-v2 v1.8.0
 	github.com/aws/aws-sdk-go-v2/config v1.6.0
+	github.com/aws/aws-sdk-go-v2/credentials v1.3.2
 	github.com/aws/aws-sdk-go-v2/service/iam v1.8.0
+	github.com/aws/aws-sdk-go-v2/service/sts v1.6.1
+	github.com/aws/smithy-go v1.7.0
+)
+
+require (
+	github.com/aws/aws-sdk-go-v2/feature/ec2/imds v1.4.0 // indirect
+	github.com/aws/aws-sdk-go-v2/internal/ini v1.2.0 // indirect
+	github.com/aws/aws-sdk-go-v2/service/internal/presigned-url v1.2.2 // indirect
+	github.com/aws/aws-sdk-go-v2/service/sso v1.3.2 // indirect
 )
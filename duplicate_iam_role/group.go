@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"os"
+)
+
+func duplicateGroup(args []string) {
+	flags := flag.NewFlagSet(os.Args[0]+" group", flag.ExitOnError)
+	sourceGroupName := flags.String("source", "", "group name that we want to use as a source")
+	targetGroupName := flags.String("target", "", "group name that we want to create")
+	var clientFlags clientFlags
+	clientFlags.register(flags)
+	path := flags.String("path", "", "path of the target group, defaults to the source path")
+	copyMembers := flags.Bool("copy-members", false, "add the members of the source group to the target group")
+	dryRun := flags.Bool("dry-run", false, "print the changes without creating anything")
+	yes := flags.Bool("yes", false, "do not ask for confirmation before writing to the target account")
+	flags.Parse(args)
+
+	if *sourceGroupName == "" {
+		usageFatalf("source argument cannot be empty")
+		return
+	}
+
+	if *targetGroupName == "" {
+		usageFatalf("target argument cannot be empty")
+		return
+	}
+
+	ctx, cancel := clientFlags.context()
+	defer cancel()
+	duplicator, err := clientFlags.newDuplicator(ctx)
+	if err != nil {
+		fatal(err)
+		return
+	}
+
+	duplicator.Path = *path
+	duplicator.CopyGroupMembers = *copyMembers
+	duplicator.DryRun = *dryRun
+	duplicator.Confirm = confirmUnless(*yes, clientFlags.targetCfg, os.Stdin)
+
+	err = duplicator.DuplicateGroup(ctx, *sourceGroupName, *targetGroupName)
+	if err != nil {
+		fatal(clientFlags.timeoutError(err))
+	}
+}
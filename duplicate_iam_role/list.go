@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+
+	"gitlab.com/renodesper/aws-utils/pkg/iamdup"
+)
+
+// listRoles prints the name and path of every source role matching a
+// filter, one per line, to help writing batch files.
+func listRoles(args []string) {
+	flags := flag.NewFlagSet(os.Args[0]+" list", flag.ExitOnError)
+	filter := flags.String("filter", "", "glob the role names must match, all roles when empty")
+	useRegex := flags.Bool("regex", false, "treat -filter as a regular expression instead of a glob")
+	pathPrefix := flags.String("path-prefix", "", "only list roles whose path starts with this prefix, such as /service/")
+	var clientFlags clientFlags
+	clientFlags.register(flags)
+	flags.Parse(args)
+
+	match := func(name string) bool { return true }
+	if *filter != "" && *useRegex {
+		re, err := regexp.Compile(*filter)
+		if err != nil {
+			usageFatalf("invalid filter, %v", err)
+			return
+		}
+		match = re.MatchString
+	} else if *filter != "" {
+		err := iamdup.ValidatePatterns([]string{*filter})
+		if err != nil {
+			usageFatalf("invalid filter, %v", err)
+			return
+		}
+		match = func(name string) bool {
+			matched, _ := path.Match(*filter, name)
+			return matched
+		}
+	}
+
+	ctx, cancel := clientFlags.context()
+	defer cancel()
+	duplicator, err := clientFlags.newDuplicator(ctx)
+	if err != nil {
+		fatal(err)
+		return
+	}
+
+	roles, err := iamdup.ListRoles(ctx, duplicator.Client, *pathPrefix)
+	if err != nil {
+		fatal(fmt.Errorf("unable to list roles, %w", clientFlags.timeoutError(err)))
+		return
+	}
+
+	for _, role := range roles {
+		if match(*role.RoleName) {
+			fmt.Printf("%s\t%s\n", *role.RoleName, *role.Path)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+)
+
+// jsonLogs is set by -log-format json. Every log line is then written as
+// a JSON event through log/slog, including the ones of the log package.
+var jsonLogs bool
+
+// setLogFormat switches the logs to format, text or json.
+func setLogFormat(format string) error {
+	switch format {
+	case "text":
+		jsonLogs = false
+	case "json":
+		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+		jsonLogs = true
+	default:
+		return fmt.Errorf("unsupported log format %q, expected text or json", format)
+	}
+
+	return nil
+}
+
+// logWarning logs message as a warning.
+func logWarning(message string) {
+	if jsonLogs {
+		slog.Warn(message)
+		return
+	}
+
+	log.Printf("warning: %s", message)
+}
+
+// logError logs err, as fatal does before exiting.
+func logError(err error) {
+	if jsonLogs {
+		slog.Error(err.Error(), "exit_code", exitCode(err))
+		return
+	}
+
+	log.Print(err)
+}
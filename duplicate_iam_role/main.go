@@ -2,222 +2,651 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
-	"log"
-	"net/url"
+	"os"
 
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/iam"
-	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"gitlab.com/renodesper/aws-utils/pkg/iamdup"
 )
 
+// commands are the subcommands available besides the default role
+// duplication, selected by the first argument.
+var commands = map[string]func(args []string){
+	"user":   duplicateUser,
+	"group":  duplicateGroup,
+	"policy": duplicatePolicy,
+	"diff":   diffRoles,
+	"delete": deleteRole,
+	"list":   listRoles,
+}
+
 func main() {
-	sourceRoleName := flag.String("source", "", "role name that we want to use as a source")
-	targetRoleName := flag.String("target", "", "role name that we want to create")
-	flag.Parse()
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			command(os.Args[2:])
+			return
+		}
+	}
+
+	duplicateRole(os.Args[1:])
+}
 
-	if *sourceRoleName == "" {
-		log.Fatalf("source argument cannot be empty")
+func duplicateRole(args []string) {
+	flags := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	// The account IDs of the role ARNs given for the source and target
+	// roles, checked against the caller identities.
+	var sourceAccounts, targetAccountIDs []string
+	var sourceRoleNames []string
+	flags.Var(&roleNamesFlag{names: &sourceRoleNames, accounts: &sourceAccounts}, "source", "role name or ARN that we want to use as a source, may be repeated to merge the policies of several roles into the target")
+	var trustFrom string
+	flags.Var(&roleNameFlag{name: &trustFrom, accounts: &sourceAccounts}, "trust-from", "source role, by name or ARN, whose trust policy, tags and other attributes are given to the target when several sources are merged, defaults to the first one")
+	failOnCollision := flags.Bool("fail-on-collision", false, "fail when several merged sources have an inline policy with the same name, instead of prefixing it with the source role name")
+	var target targetName
+	flags.Var(&roleNameFlag{name: &target.name, accounts: &targetAccountIDs}, "target", "role name or ARN that we want to create")
+	flags.StringVar(&target.prefix, "target-prefix", "", "derive the target role name by prepending this to the source name, instead of -target")
+	flags.StringVar(&target.suffix, "target-suffix", "", "derive the target role name by appending this to the source name, instead of -target")
+	var clientFlags clientFlags
+	clientFlags.register(flags)
+	overwrite := flags.Bool("overwrite", false, "update the target role in place when it already exists")
+	protectPattern := flags.String("protect-pattern", "", "regular expression of the existing target role names that are never changed without -force, such as ^admin")
+	force := flags.Bool("force", false, "change existing target roles matching -protect-pattern")
+	overwriteTagsOnly := flags.Bool("overwrite-tags-only", false, "only make the tags of the existing target role match the source tags")
+	rollbackOnError := flags.Bool("rollback-on-error", false, "delete whatever was created when a later step fails")
+	exportPath := flags.String("export", "", "write the source role definition to this file instead of creating the target")
+	exportAllDir := flags.String("export-all", "", "write the definition of every role of the source account, except service-linked ones, to this directory with a manifest.json listing them")
+	importAllDir := flags.String("import-all", "", "recreate every role of a directory written by -export-all, the roles trusted by others first")
+	pathPrefix := flags.String("path-prefix", "", "only export the roles whose path starts with this prefix with -export-all, such as /service/")
+	sourceVersion := flags.Bool("source-version", false, "record the default version of each customer managed policy in the export, so that clone-managed-policies clones that version on import")
+	sourceFile := flags.String("source-file", "", "read the source role from the output of aws iam get-role instead of the live source, policies are not copied")
+	importPath := flags.String("import", "", "create the target role from a file written by -export instead of a live source role")
+	description := flags.String("description", "", "description of the target role, defaults to the source description")
+	path := flags.String("path", "", "path of the target role, defaults to the source path")
+	trustPolicyFile := flags.String("trust-policy-file", "", "JSON file with the assume role policy document of the target role, defaults to the source document")
+	var addTrustPrincipals stringsFlag
+	flags.Var(&addTrustPrincipals, "add-trust-principal", "ARN or account ID allowed to assume the target role on top of the source trust policy, may be repeated")
+	maxSessionDuration := flags.Int("max-session-duration", 0, "maximum session duration of the target role in seconds, defaults to the source value")
+	targetPartition := flags.String("target-partition", "", "rewrite the partition of ARNs in the trust policy and managed policy references, such as aws-us-gov")
+	cloneManagedPolicies := flags.Bool("clone-managed-policies", false, "recreate customer managed policies in the target account and attach the copies")
+	cloneAllPolicyVersions := flags.Bool("clone-all-policy-versions", false, "also copy the non-default versions of the policies recreated by clone-managed-policies or copy-boundary-policy")
+	noBoundary := flags.Bool("no-boundary", false, "create the target role without the permissions boundary of the source role")
+	permissionsBoundary := flags.String("permissions-boundary", "", "ARN of the permissions boundary of the target role, instead of the source one")
+	copyBoundaryPolicy := flags.Bool("copy-boundary-policy", false, "recreate a customer managed permissions boundary in the target account")
+	var attachPolicies stringsFlag
+	flags.Var(&attachPolicies, "attach-policy", "name or ARN of an extra managed policy to attach to the target role, may be repeated")
+	policyNameTemplate := flags.String("policy-name-template", "", "Go template of the inline policy names of the target, given the {{.Name}} of the policy and the {{.Source}} role name, such as prod-{{.Name}}")
+	skipMissingPolicies := flags.Bool("skip-missing-policies", false, "check that each managed policy of the source still exists and skip, with a warning, the ones that do not instead of failing")
+	var inlineManaged stringsFlag
+	flags.Var(&inlineManaged, "inline-managed", "name or ARN of a managed policy of the source role to write as an inline policy of the target instead of attaching it, may be repeated")
+	var includePolicies stringsFlag
+	flags.Var(&includePolicies, "include-policy", "glob of the inline policy names or managed policy names or ARNs to copy, customer managed policy names are resolved in the source account, may be repeated")
+	var excludePolicies stringsFlag
+	flags.Var(&excludePolicies, "exclude-policy", "glob of the inline policy names or managed policy names or ARNs not to copy, customer managed policy names are resolved in the source account, may be repeated")
+	noInline := flags.Bool("no-inline", false, "do not copy the inline policies of the source role")
+	noManaged := flags.Bool("no-managed", false, "do not attach the managed policies of the source role")
+	onlyTrustPolicy := flags.Bool("only-trust-policy", false, "create the target role with the trust policy only, without any inline or managed policy")
+	splitOversize := flags.Bool("split-oversize", false, "split inline policies larger than the IAM limit into several inline policies; IAM also limits the total size of the inline policies of a role, which is checked before anything is written and which splitting does not reduce")
+	var replacements []iamdup.Replacement
+	flags.Var(replacementsFlag{replacements: &replacements}, "replace", "old=new literal replacement in the trust and inline policy documents, such as an account ID, may be repeated")
+	flags.Var(replacementsFlag{replacements: &replacements, regex: true}, "replace-regex", "pattern=new regular expression replacement in the trust and inline policy documents, may be repeated")
+	normalizeJSON := flags.Bool("normalize-json", false, "rewrite policy documents with sorted keys and indentation")
+	var setTags tagsFlag
+	flags.Var(&setTags, "set-tag", "key=value tag to set on the target role, may be repeated")
+	var removeTags stringsFlag
+	flags.Var(&removeTags, "remove-tag", "tag key not to copy to the target role, may be repeated")
+	provenanceTags := flags.Bool("provenance-tags", false, "tag the target role with CopiedFrom=<source> and CopiedAt=<time of the copy>")
+	waitTimeout := flags.Duration("wait-timeout", iamdup.DefaultWaitTimeout, "how long to wait for the new role to become visible before adding its policies")
+	withInstanceProfile := flags.Bool("with-instance-profile", false, "add the target role to an instance profile when the source role is in one")
+	instanceProfileName := flags.String("instance-profile-name", "", "name of the target instance profile, defaults to the target role name")
+	audit := flags.Bool("audit", false, "warn about statements allowing every action, every resource or any principal in the copied documents")
+	auditStrict := flags.Bool("audit-strict", false, "same as -audit but refuse to copy documents with such statements")
+	copyCount := flags.Int("copy-count", 1, "attempts of the whole duplication, the attempts after a failure update what the previous one left in place; -max-attempts retries single API calls instead")
+	lockdownRole := flags.Bool("lockdown", false, "create the target role with a trust policy denying everyone, until it is given the source trust policy with -activate")
+	activate := flags.Bool("activate", false, "give the target role created with -lockdown from the source role the trust policy it was locked down with")
+	followTrust := flags.Bool("follow-trust", false, "first copy, under their own names, the roles of the source account trusted by the source role, recursively, and point the trust policy to the copies")
+	preflight := flags.Bool("preflight", false, "check with iam:SimulatePrincipalPolicy that the target credentials are allowed every call of the duplication before making any")
+	verify := flags.Bool("verify", false, "read the target role back after writing it and fail when it differs")
+	dryRun := flags.Bool("dry-run", false, "print the changes without creating anything")
+	yes := flags.Bool("yes", false, "do not ask for confirmation before writing to the target account")
+	output := flags.String("output", "", "set to json to print a machine-readable summary of the run, or to terraform or cloudformation to print the configuration of the target role instead of creating it")
+	batchPath := flags.String("batch", "", "CSV or JSON file of source,target pairs to duplicate one after another")
+	continueOnError := flags.Bool("continue-on-error", false, "keep going with the remaining batch pairs, or -import-all roles, after one fails")
+	targetAccounts := flags.String("target-accounts", "", "JSON file listing the accounts, by profile and/or roleArn, to duplicate the source role into one after another")
+	flags.Parse(args)
+
+	var sourceRoleName string
+	if len(sourceRoleNames) > 0 {
+		sourceRoleName = sourceRoleNames[0]
+	}
+	merge := len(sourceRoleNames) > 1
+
+	if merge && (target.name == "" || *importPath != "" || *exportPath != "" || *sourceFile != "" || *batchPath != "" || *overwriteTagsOnly || *targetAccounts != "" || *output == "terraform" || *output == "cloudformation") {
+		usageFatalf("several sources require target and cannot be combined with import, export, source-file, batch, overwrite-tags-only, target-accounts or output %s", *output)
 		return
 	}
 
-	if *targetRoleName == "" {
-		log.Fatalf("target argument cannot be empty")
+	if (trustFrom != "" || *failOnCollision) && !merge {
+		usageFatalf("trust-from and fail-on-collision require several sources")
 		return
 	}
 
-	// Using the SDK's default configuration, loading additional config
-	// and credentials values from the environment variables, shared
-	// credentials, and shared configuration files
-	ctx := context.Background()
-	cfg, err := config.LoadDefaultConfig(ctx)
-	if err != nil {
-		log.Fatalf("unable to load SDK config, %v", err)
+	if *output != "" && *output != "json" && *output != "terraform" && *output != "cloudformation" {
+		usageFatalf("unsupported output %q", *output)
+		return
+	}
+
+	if (*output == "terraform" || *output == "cloudformation") && (*batchPath != "" || *exportPath != "" || *overwriteTagsOnly) {
+		usageFatalf("output %s cannot be combined with batch, export or overwrite-tags-only", *output)
 		return
 	}
 
-	client := iam.NewFromConfig(cfg)
+	if *batchPath != "" && (sourceRoleName != "" || target.name != "" || *importPath != "" || *exportPath != "" || *sourceFile != "") {
+		usageFatalf("batch cannot be combined with source, target, import, export or source-file")
+		return
+	}
 
-	sourceRole := GetRole(ctx, client, *sourceRoleName)
-	inlinePolicies := GetInlinePolicies(ctx, client, *sourceRoleName)
-	managedPolicies := GetManagedPolicies(ctx, client, *sourceRoleName)
+	if *targetAccounts != "" && (*batchPath != "" || *exportPath != "" || *overwriteTagsOnly || *output == "terraform" || *output == "cloudformation" || clientFlags.targetProfile != "" || clientFlags.targetRoleArn != "") {
+		usageFatalf("target-accounts cannot be combined with batch, export, overwrite-tags-only, output terraform or cloudformation, target-profile or target-role-arn")
+		return
+	}
 
-	err = CreateRole(ctx, client, sourceRole, *targetRoleName)
-	if err != nil {
-		log.Fatalf("unable to create role, %v", err)
+	if *targetAccounts != "" && len(targetAccountIDs) > 0 {
+		usageFatalf("target must be a role name with target-accounts, the role is created in every account")
+		return
+	}
+
+	if *overwriteTagsOnly && (sourceRoleName == "" || *importPath != "" || *exportPath != "" || *sourceFile != "" || *batchPath != "") {
+		usageFatalf("overwrite-tags-only requires source and cannot be combined with import, export, source-file or batch")
+		return
+	}
+
+	if *activate && (sourceRoleName == "" || merge || *lockdownRole || *importPath != "" || *exportPath != "" || *sourceFile != "" || *batchPath != "" || *overwriteTagsOnly) {
+		usageFatalf("activate requires one source and cannot be combined with lockdown, import, export, source-file, batch or overwrite-tags-only")
 		return
 	}
 
-	if len(inlinePolicies) > 0 {
-		err = AddInlinePolicies(ctx, client, *targetRoleName, inlinePolicies)
+	if *followTrust && (*importPath != "" || *sourceFile != "" || *exportPath != "" || *targetAccounts != "" || merge || *activate || *overwriteTagsOnly || *output == "terraform" || *output == "cloudformation") {
+		usageFatalf("follow-trust requires a live source and cannot be combined with import, source-file, export, target-accounts, several sources, activate, overwrite-tags-only or output %s", *output)
+		return
+	}
+
+	if *permissionsBoundary != "" && (*noBoundary || *copyBoundaryPolicy) {
+		usageFatalf("permissions-boundary cannot be combined with no-boundary or copy-boundary-policy")
+		return
+	}
+
+	if *cloneAllPolicyVersions && !*cloneManagedPolicies && !*copyBoundaryPolicy {
+		usageFatalf("clone-all-policy-versions requires clone-managed-policies or copy-boundary-policy")
+		return
+	}
+
+	if *onlyTrustPolicy && (len(attachPolicies) > 0 || len(inlineManaged) > 0 || *cloneManagedPolicies || len(includePolicies) > 0 || len(excludePolicies) > 0 || *splitOversize) {
+		usageFatalf("only-trust-policy cannot be combined with attach-policy, inline-managed, clone-managed-policies, include-policy, exclude-policy or split-oversize")
+		return
+	}
+
+	// Checked before the conversion to int32, which could wrap an out of
+	// range value into the accepted range.
+	if *maxSessionDuration != 0 {
+		err := iamdup.ValidateMaxSessionDuration(*maxSessionDuration)
 		if err != nil {
-			log.Fatalf("unable to add inline policies, %v", err)
+			usageFatalf("invalid max-session-duration, %v", err)
+			return
 		}
 	}
 
-	if len(managedPolicies) > 0 {
-		err = AddManagedPolicies(ctx, client, *targetRoleName, managedPolicies)
+	if *copyCount < 1 {
+		usageFatalf("copy-count must be at least 1")
+		return
+	}
+
+	if *exportAllDir != "" && (len(sourceRoleNames) > 0 || target.name != "" || target.derived() || *importPath != "" || *exportPath != "" || *sourceFile != "" || *batchPath != "" || *targetAccounts != "" || *overwriteTagsOnly || *activate || *output != "") {
+		usageFatalf("export-all cannot be combined with source, target, import, export, source-file, batch, target-accounts, overwrite-tags-only, activate or output")
+		return
+	}
+
+	if *importAllDir != "" && (len(sourceRoleNames) > 0 || target.name != "" || *importPath != "" || *exportPath != "" || *exportAllDir != "" || *sourceFile != "" || *batchPath != "" || *targetAccounts != "" || *overwriteTagsOnly || *activate || *followTrust || (*output != "" && *output != "json")) {
+		usageFatalf("import-all cannot be combined with source, target, import, export, export-all, source-file, batch, target-accounts, overwrite-tags-only, activate, follow-trust or output %s", *output)
+		return
+	}
+
+	if *pathPrefix != "" && *exportAllDir == "" {
+		usageFatalf("path-prefix requires export-all")
+		return
+	}
+
+	if *sourceVersion && *exportPath == "" && *exportAllDir == "" {
+		usageFatalf("source-version requires export or export-all")
+		return
+	}
+
+	if *sourceFile != "" && (*importPath != "" || *exportPath != "") {
+		usageFatalf("source-file cannot be combined with import or export")
+		return
+	}
+
+	if sourceRoleName == "" && *importPath == "" && *sourceFile == "" && *batchPath == "" && *exportAllDir == "" && *importAllDir == "" {
+		usageFatalf("source argument cannot be empty")
+		return
+	}
+
+	if target.name != "" && target.derived() {
+		usageFatalf("target cannot be combined with target-prefix or target-suffix")
+		return
+	}
+
+	if target.name == "" && !target.derived() && *exportPath == "" && *batchPath == "" && *exportAllDir == "" && *importAllDir == "" {
+		usageFatalf("target argument cannot be empty, set it or use target-prefix or target-suffix")
+		return
+	}
+
+	if sourceRoleName != "" && *exportPath == "" {
+		err := iamdup.ValidateRoleName(target.resolve(sourceRoleName))
 		if err != nil {
-			log.Fatalf("unable to add managed policies, %v", err)
+			usageFatalf("invalid target, %v", err)
+			return
 		}
 	}
-}
 
-func GetRole(ctx context.Context, client *iam.Client, roleName string) *iam.GetRoleOutput {
-	roleInput := iam.GetRoleInput{
-		RoleName: &roleName,
+	ctx, cancel := clientFlags.context()
+	defer cancel()
+	duplicator, err := clientFlags.newDuplicator(ctx)
+	if err != nil {
+		fatal(err)
+		return
 	}
-	sourceRole, err := client.GetRole(ctx, &roleInput)
+
+	err = clientFlags.checkAccounts(ctx, sourceAccounts, targetAccountIDs)
 	if err != nil {
-		log.Fatalf("failed to get role, %v", err)
+		fatal(clientFlags.timeoutError(err))
+		return
 	}
 
-	return sourceRole
-}
+	duplicator.Overwrite = *overwrite
+	duplicator.RollbackOnError = *rollbackOnError
+	duplicator.Description = *description
+	duplicator.Path = *path
+	if *trustPolicyFile != "" {
+		document, err := os.ReadFile(*trustPolicyFile)
+		if err != nil {
+			fatal(fmt.Errorf("unable to read trust policy file, %w", err))
+			return
+		}
+		duplicator.AssumeRolePolicyDocument = document
+	}
 
-func GetInlinePolicies(ctx context.Context, client *iam.Client, roleName string) []*iam.GetRolePolicyOutput {
-	inlinePolicyNames := GetInlinePoliciesRecursive(ctx, client, roleName, "")
+	duplicator.AddTrustPrincipals = addTrustPrincipals
+	duplicator.MaxSessionDuration = int32(*maxSessionDuration)
+	duplicator.SkipBoundary = *noBoundary
+	duplicator.CopyBoundaryPolicy = *copyBoundaryPolicy
+	duplicator.PermissionsBoundaryArn = *permissionsBoundary
+	duplicator.CloneManagedPolicies = *cloneManagedPolicies
+	duplicator.CloneAllPolicyVersions = *cloneAllPolicyVersions
+	duplicator.RecordPolicyVersions = *sourceVersion
+	duplicator.TargetPartition = *targetPartition
+	duplicator.AttachPolicies = attachPolicies
+	duplicator.InlineManagedPolicies = inlineManaged
+	duplicator.SkipMissingPolicies = *skipMissingPolicies
+	duplicator.PolicyNameTemplate = *policyNameTemplate
+	duplicator.IncludePolicies = includePolicies
+	duplicator.ExcludePolicies = excludePolicies
+	duplicator.SkipInlinePolicies = *noInline || *onlyTrustPolicy
+	duplicator.SkipManagedPolicies = *noManaged || *onlyTrustPolicy
+	duplicator.SplitOversize = *splitOversize
+	duplicator.NormalizeJSON = *normalizeJSON
+	duplicator.SetTags = setTags
+	duplicator.RemoveTags = removeTags
+	duplicator.ProvenanceTags = *provenanceTags
+	duplicator.Replacements = replacements
+	duplicator.WaitTimeout = *waitTimeout
+	duplicator.CopyInstanceProfile = *withInstanceProfile
+	duplicator.InstanceProfileName = *instanceProfileName
+	duplicator.Verify = *verify
+	duplicator.Attempts = *copyCount
+	duplicator.Lockdown = *lockdownRole
+	duplicator.TrustFrom = trustFrom
+	duplicator.FollowTrust = *followTrust
+	duplicator.ProtectPattern = *protectPattern
+	duplicator.Force = *force
+	duplicator.FailOnCollision = *failOnCollision
+	if *audit || *auditStrict {
+		duplicator.Audit = func(finding iamdup.Finding) {
+			logWarning(finding.String())
+		}
+	}
+	duplicator.AuditStrict = *auditStrict
+	duplicator.DryRun = *dryRun
+	duplicator.Progress = newProgress(clientFlags.quiet)
+	duplicator.Confirm = confirmUnless(*yes, clientFlags.targetCfg, os.Stdin)
+	if *output == "json" {
+		duplicator.Out = os.Stderr
+	}
 
-	if len(inlinePolicyNames) == 0 {
-		return []*iam.GetRolePolicyOutput{}
+	if *followTrust {
+		same, err := clientFlags.sameAccount(ctx)
+		if err != nil {
+			fatal(clientFlags.timeoutError(err))
+		}
+		if same {
+			usageFatalf("follow-trust copies the trusted roles under their own names, set target-profile or target-role-arn to copy them to another account")
+			return
+		}
 	}
 
-	var inlinePolicies []*iam.GetRolePolicyOutput
+	if *targetAccounts == "" && *exportPath == "" {
+		for _, name := range sourceRoleNames {
+			err = clientFlags.checkSelfCopy(ctx, name, target.resolve(name))
+			if err != nil {
+				fatal(clientFlags.timeoutError(err))
+			}
+		}
+	}
 
-	for _, policyName := range inlinePolicyNames {
-		rolePolicyInput := iam.GetRolePolicyInput{
-			RoleName:   &roleName,
-			PolicyName: &policyName,
+	if *batchPath != "" {
+		err = duplicateBatch(ctx, &clientFlags, duplicator, *batchPath, target, *continueOnError, *output == "json")
+		clientFlags.printAPICalls()
+		if err != nil {
+			fatal(clientFlags.timeoutError(err))
 		}
+		return
+	}
 
-		inlinePolicy, err := client.GetRolePolicy(ctx, &rolePolicyInput)
+	if *targetAccounts != "" {
+		err = duplicateRoleToAccounts(ctx, &clientFlags, duplicator, *targetAccounts, sourceRoleName, *importPath, *sourceFile, target, !*yes, *output == "json")
+		clientFlags.printAPICalls()
 		if err != nil {
-			log.Fatalf("failed to get role policy, %v", err)
+			fatal(clientFlags.timeoutError(err))
 		}
+		return
+	}
 
-		inlinePolicies = append(inlinePolicies, inlinePolicy)
+	if *activate {
+		err = duplicator.Activate(ctx, sourceRoleName, target.resolve(sourceRoleName))
+		if err != nil {
+			fatal(clientFlags.timeoutError(err))
+		}
+		return
 	}
 
-	return inlinePolicies
-}
+	if *overwriteTagsOnly {
+		err = syncTags(ctx, duplicator, sourceRoleName, target.resolve(sourceRoleName), *dryRun)
+		if err != nil {
+			fatal(clientFlags.timeoutError(err))
+		}
+		return
+	}
+
+	if *importAllDir != "" {
+		err = importAll(ctx, duplicator, *importAllDir, target, *continueOnError, *output == "json")
+		clientFlags.printAPICalls()
+		if err != nil {
+			fatal(clientFlags.timeoutError(err))
+		}
+		return
+	}
 
-func GetInlinePoliciesRecursive(ctx context.Context, client *iam.Client, roleName string, marker string) []string {
-	params := iam.ListRolePoliciesInput{
-		RoleName: &roleName,
+	if *exportAllDir != "" {
+		err = exportAll(ctx, duplicator, *pathPrefix, *exportAllDir)
+		if err != nil {
+			fatal(fmt.Errorf("unable to export roles, %w", clientFlags.timeoutError(err)))
+		}
+		return
 	}
 
-	if marker != "" {
-		params.Marker = &marker
+	if *exportPath != "" {
+		err = exportRole(ctx, duplicator, sourceRoleName, *exportPath)
+		if err != nil {
+			fatal(fmt.Errorf("unable to export role, %w", clientFlags.timeoutError(err)))
+		}
+		return
 	}
 
-	rolePolicies, err := client.ListRolePolicies(ctx, &params)
-	if err != nil {
-		log.Fatalf("failed to get list of role policies, %v", err)
+	if *output == "terraform" || *output == "cloudformation" {
+		err = writeConfiguration(ctx, duplicator, *output, sourceRoleName, *importPath, *sourceFile, target)
+		if err != nil {
+			fatal(fmt.Errorf("unable to write %s configuration, %w", *output, clientFlags.timeoutError(err)))
+		}
+		return
+	}
+
+	if *preflight {
+		err = clientFlags.checkPermissions(ctx, duplicator)
+		if err != nil {
+			fatal(fmt.Errorf("preflight check failed, %w", clientFlags.timeoutError(err)))
+		}
+	}
+
+	var result *iamdup.Result
+	if *importPath != "" {
+		result, err = importRole(ctx, duplicator, *importPath, target)
+	} else if merge {
+		result, err = duplicator.DuplicateMerged(ctx, sourceRoleNames, target.name)
+	} else if *sourceFile != "" {
+		result, err = duplicateFromFile(ctx, duplicator, *sourceFile, target)
+	} else {
+		result, err = duplicator.Duplicate(ctx, sourceRoleName, target.resolve(sourceRoleName))
 	}
+	err = clientFlags.deniedError(ctx, clientFlags.timeoutError(err))
 
-	inlinePolicyNames := rolePolicies.PolicyNames
+	if *output == "json" {
+		printSummary(result, err, clientFlags.calls.Counts())
+	} else if err == nil && !*dryRun {
+		printResult(result, clientFlags.verbose)
+	}
+	clientFlags.printAPICalls()
 
-	if rolePolicies.IsTruncated {
-		inlinePolicyNames_ := GetInlinePoliciesRecursive(ctx, client, roleName, *rolePolicies.Marker)
-		inlinePolicyNames = append(inlinePolicyNames, inlinePolicyNames_...)
+	if errors.Is(err, iamdup.ErrRoleExists) {
+		fatal(fmt.Errorf("%w, use -overwrite to update it", err))
+	} else if err != nil {
+		fatal(err)
 	}
+}
 
-	return inlinePolicyNames
+// targetName is the name of the role to create, given directly or derived
+// from the source role name.
+type targetName struct {
+	name   string
+	prefix string
+	suffix string
 }
 
-func GetManagedPolicies(ctx context.Context, client *iam.Client, roleName string) []types.AttachedPolicy {
-	managedPolicies := GetManagedPoliciesRecursive(ctx, client, roleName, "")
-	return managedPolicies
+func (t targetName) derived() bool {
+	return t.prefix != "" || t.suffix != ""
 }
 
-func GetManagedPoliciesRecursive(ctx context.Context, client *iam.Client, roleName string, marker string) []types.AttachedPolicy {
-	params := iam.ListAttachedRolePoliciesInput{
-		RoleName: &roleName,
+// resolve returns the target role name for sourceRoleName.
+func (t targetName) resolve(sourceRoleName string) string {
+	if t.name != "" {
+		return t.name
 	}
 
-	if marker != "" {
-		params.Marker = &marker
-	}
+	return t.prefix + sourceRoleName + t.suffix
+}
 
-	attachedRolePolicies, err := client.ListAttachedRolePolicies(ctx, &params)
+func syncTags(ctx context.Context, duplicator *iamdup.Duplicator, sourceRoleName string, targetRoleName string, dryRun bool) error {
+	changes, err := duplicator.SyncTags(ctx, sourceRoleName, targetRoleName)
 	if err != nil {
-		log.Fatalf("failed to get list of attached role policies, %v", err)
+		return err
+	}
+
+	prefix := ""
+	if dryRun {
+		prefix = "[dry-run] "
 	}
 
-	managedPolicies := attachedRolePolicies.AttachedPolicies
+	for _, tag := range changes.Added {
+		fmt.Printf("%sadded tag %s=%s\n", prefix, tag.Key, tag.Value)
+	}
+
+	for _, tag := range changes.Changed {
+		fmt.Printf("%schanged tag %s=%s\n", prefix, tag.Key, tag.Value)
+	}
 
-	if attachedRolePolicies.IsTruncated {
-		managedPolicies_ := GetManagedPoliciesRecursive(ctx, client, roleName, *attachedRolePolicies.Marker)
-		managedPolicies = append(managedPolicies, managedPolicies_...)
+	for _, key := range changes.Removed {
+		fmt.Printf("%sremoved tag %s\n", prefix, key)
 	}
 
-	return managedPolicies
+	return nil
 }
 
-func CreateRole(ctx context.Context, client *iam.Client, sourceRole *iam.GetRoleOutput, targetRoleName string) error {
-	params := iam.CreateRoleInput{
-		Path:               sourceRole.Role.Path,
-		RoleName:           &targetRoleName,
-		Description:        sourceRole.Role.Description,
-		MaxSessionDuration: sourceRole.Role.MaxSessionDuration,
-		Tags:               sourceRole.Role.Tags,
+func exportRole(ctx context.Context, duplicator *iamdup.Duplicator, roleName string, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
 	}
 
-	assumeRolePolicyDocument, err := url.PathUnescape(*sourceRole.Role.AssumeRolePolicyDocument)
+	err = duplicator.Export(ctx, roleName, f)
 	if err != nil {
+		f.Close()
 		return err
 	}
 
-	params.AssumeRolePolicyDocument = &assumeRolePolicyDocument
+	return f.Close()
+}
 
-	if sourceRole.Role.PermissionsBoundary != nil {
-		params.PermissionsBoundary = sourceRole.Role.PermissionsBoundary.PermissionsBoundaryArn
-	} else {
-		params.PermissionsBoundary = nil
+func importRole(ctx context.Context, duplicator *iamdup.Duplicator, path string, target targetName) (*iamdup.Result, error) {
+	snapshot, err := readSnapshotFile(path)
+	if err != nil {
+		return nil, err
 	}
 
-	_, err = client.CreateRole(ctx, &params)
+	return duplicator.Import(ctx, snapshot, target.resolve(snapshot.RoleName))
+}
+
+func duplicateFromFile(ctx context.Context, duplicator *iamdup.Duplicator, path string, target targetName) (*iamdup.Result, error) {
+	snapshot, err := readRoleFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return duplicator.Import(ctx, snapshot, target.resolve(snapshot.RoleName))
+}
+
+// writeConfiguration prints the Terraform configuration or CloudFormation
+// template of the target role, built from the live source role, the
+// -import file or the -source-file.
+func writeConfiguration(ctx context.Context, duplicator *iamdup.Duplicator, format string, sourceRoleName string, importPath string, sourceFile string, target targetName) error {
+	snapshot, err := loadSnapshot(ctx, duplicator, sourceRoleName, importPath, sourceFile)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	if format == "cloudformation" {
+		return duplicator.WriteCloudFormation(ctx, snapshot, target.resolve(snapshot.RoleName), os.Stdout)
+	}
+
+	return duplicator.WriteTerraform(ctx, snapshot, target.resolve(snapshot.RoleName), os.Stdout)
 }
 
-func AddInlinePolicies(ctx context.Context, client *iam.Client, targetRoleName string, inlinePolicies []*iam.GetRolePolicyOutput) error {
-	for _, policy := range inlinePolicies {
-		params := iam.PutRolePolicyInput{
-			RoleName:   &targetRoleName,
-			PolicyName: policy.PolicyName,
-		}
+// loadSnapshot reads the source role from the -import file, the
+// -source-file or, without either, the live source role.
+func loadSnapshot(ctx context.Context, duplicator *iamdup.Duplicator, sourceRoleName string, importPath string, sourceFile string) (*iamdup.Snapshot, error) {
+	if importPath != "" {
+		return readSnapshotFile(importPath)
+	} else if sourceFile != "" {
+		return readRoleFile(sourceFile)
+	}
 
-		policyDocument, err := url.PathUnescape(*policy.PolicyDocument)
-		if err != nil {
-			params.PolicyDocument = &policyDocument
-		}
+	return duplicator.Snapshot(ctx, sourceRoleName)
+}
 
-		_, err = client.PutRolePolicy(ctx, &params)
-		if err != nil {
-			fmt.Println(fmt.Errorf("failed to add inline policy, %v", err))
-		}
+// readSnapshotFile reads a file written by -export.
+func readSnapshotFile(path string) (*iamdup.Snapshot, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
 	}
+	defer f.Close()
 
-	return nil
+	return iamdup.ReadSnapshot(f)
 }
 
-func AddManagedPolicies(ctx context.Context, client *iam.Client, targetRoleName string, managedPolicies []types.AttachedPolicy) error {
-	for _, policy := range managedPolicies {
-		params := iam.AttachRolePolicyInput{
-			RoleName:  &targetRoleName,
-			PolicyArn: policy.PolicyArn,
-		}
+// readRoleFile reads the output of aws iam get-role, without policies.
+func readRoleFile(path string) (*iamdup.Snapshot, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
 
-		_, err := client.AttachRolePolicy(ctx, &params)
-		if err != nil {
-			fmt.Println(fmt.Errorf("failed to add managed policy, %v", err))
-		}
+	role, err := iamdup.ReadRole(f)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	return iamdup.NewSnapshot(role, nil, nil)
+}
+
+// printResult writes one line with the ARN of the target role and the
+// number of policies written, followed by each policy when verbose.
+func printResult(result *iamdup.Result, verbose bool) {
+	for _, trusted := range result.TrustedRoles {
+		printResult(trusted, verbose)
+	}
+
+	action := "created"
+	if result.Updated {
+		action = "updated"
+	}
+
+	fmt.Printf("%s %s inline_policies=%d managed_policies=%d\n", result.RoleArn, action, len(result.InlinePolicies), len(result.ManagedPolicies))
+	if !verbose {
+		return
+	}
+
+	for _, policyName := range result.InlinePolicies {
+		fmt.Printf("  inline policy %s\n", policyName)
+	}
+
+	for _, policyArn := range result.ManagedPolicies {
+		fmt.Printf("  managed policy %s\n", policyArn)
+	}
+
+	if result.InstanceProfile != "" {
+		fmt.Printf("  instance profile %s\n", result.InstanceProfile)
+	}
+
+	for _, policyArn := range result.SkippedManagedPolicies {
+		fmt.Printf("  skipped missing managed policy %s\n", policyArn)
+	}
+}
+
+// summary is the JSON description of a run printed with -output json.
+type summary struct {
+	*iamdup.Result
+	Error string `json:"error,omitempty"`
+
+	// APICalls counts the calls made to each IAM API during the run.
+	APICalls map[string]int `json:"apiCalls,omitempty"`
+}
+
+func newSummary(result *iamdup.Result, err error) summary {
+	s := summary{
+		Result: result,
+	}
+
+	if result == nil {
+		s.Result = &iamdup.Result{}
+	}
+
+	if err != nil {
+		s.Error = err.Error()
+	}
+
+	return s
+}
+
+// printSummary writes the result of a run, its error if any and the API
+// calls it made, as JSON to stdout.
+func printSummary(result *iamdup.Result, err error, apiCalls map[string]int) {
+	s := newSummary(result, err)
+	s.APICalls = apiCalls
+	printJSON(s)
+}
+
+func printJSON(v interface{}) {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(v)
 }
@@ -0,0 +1,78 @@
+package iamdup
+
+import (
+	"fmt"
+	"strings"
+)
+
+// IsAWSManagedPolicy reports whether policyArn refers to a policy owned by
+// AWS, such as arn:aws:iam::aws:policy/ReadOnlyAccess. Such policies exist
+// in every account, unlike customer managed policies.
+func IsAWSManagedPolicy(policyArn string) bool {
+	parts := strings.SplitN(policyArn, ":", 6)
+	return len(parts) == 6 && parts[4] == "aws"
+}
+
+// ValidatePolicyArn checks that policyArn has the form of a managed policy
+// ARN, arn:<partition>:iam::<account ID or aws>:policy/<path><name>.
+func ValidatePolicyArn(policyArn string) error {
+	parts := strings.SplitN(policyArn, ":", 6)
+	if len(parts) != 6 || parts[0] != "arn" || parts[1] == "" || parts[2] != "iam" || parts[3] != "" ||
+		(parts[4] != "aws" && !accountIDPattern.MatchString(parts[4])) || !strings.HasPrefix(parts[5], "policy/") || strings.HasSuffix(parts[5], "/") {
+		return fmt.Errorf("invalid policy ARN %q, expected arn:aws:iam::123456789012:policy/name", policyArn)
+	}
+
+	return nil
+}
+
+// isRoleArn reports whether arn is the ARN of an IAM role.
+func isRoleArn(arn string) bool {
+	parts := strings.SplitN(arn, ":", 6)
+	return len(parts) == 6 && parts[2] == "iam" && strings.HasPrefix(parts[5], "role/")
+}
+
+// ParseRoleName returns the role name of value, either a role name or a
+// role ARN such as arn:aws:iam::123456789012:role/path/name, whose path is
+// dropped.
+func ParseRoleName(value string) (string, error) {
+	roleName, _, err := ParseRoleArn(value)
+	return roleName, err
+}
+
+// ParseRoleArn returns the role name and the account ID of value, either a
+// role name, whose account is empty, or a role ARN such as
+// arn:aws:iam::123456789012:role/path/name, whose path is dropped.
+func ParseRoleArn(value string) (roleName string, account string, err error) {
+	if value == "" {
+		return "", "", fmt.Errorf("role name cannot be empty")
+	}
+
+	if !strings.HasPrefix(value, "arn:") {
+		return value, "", nil
+	}
+
+	parts := strings.SplitN(value, ":", 6)
+	if len(parts) != 6 || parts[1] == "" || parts[3] != "" || !accountIDPattern.MatchString(parts[4]) || !isRoleArn(value) || strings.HasSuffix(value, "/") {
+		return "", "", fmt.Errorf("invalid role ARN %q, expected arn:aws:iam::123456789012:role/name", value)
+	}
+
+	return value[strings.LastIndex(value, "/")+1:], parts[4], nil
+}
+
+// ServiceLinkedRolePath is the path prefix of every service-linked role.
+const ServiceLinkedRolePath = "/aws-service-role/"
+
+// IsServiceLinkedRole reports whether rolePath is the path of a role owned
+// by an AWS service, such as /aws-service-role/elasticache.amazonaws.com/.
+func IsServiceLinkedRole(rolePath string) bool {
+	return strings.HasPrefix(rolePath, ServiceLinkedRolePath)
+}
+
+// ServiceRolePath is the path the IAM console gives to the roles it creates
+// for AWS services. Unlike service-linked roles they can be copied.
+const ServiceRolePath = "/service-role/"
+
+// IsServiceRolePath reports whether rolePath is under ServiceRolePath.
+func IsServiceRolePath(rolePath string) bool {
+	return strings.HasPrefix(rolePath, ServiceRolePath)
+}
@@ -0,0 +1,45 @@
+package iamdup
+
+import "testing"
+
+func TestParseRoleArn(t *testing.T) {
+	tests := []struct {
+		name        string
+		value       string
+		wantName    string
+		wantAccount string
+		wantErr     bool
+	}{
+		{name: "plain name", value: "app", wantName: "app"},
+		{name: "ARN", value: "arn:aws:iam::123456789012:role/app", wantName: "app", wantAccount: "123456789012"},
+		{name: "path-qualified ARN", value: "arn:aws:iam::123456789012:role/service/team/app", wantName: "app", wantAccount: "123456789012"},
+		{name: "other partition", value: "arn:aws-us-gov:iam::123456789012:role/app", wantName: "app", wantAccount: "123456789012"},
+		{name: "wrong service", value: "arn:aws:sts::123456789012:role/app", wantErr: true},
+		{name: "assumed role session", value: "arn:aws:sts::123456789012:assumed-role/app/session", wantErr: true},
+		{name: "missing role/", value: "arn:aws:iam::123456789012:app", wantErr: true},
+		{name: "user ARN", value: "arn:aws:iam::123456789012:user/app", wantErr: true},
+		{name: "empty name", value: "", wantErr: true},
+		{name: "empty ARN name", value: "arn:aws:iam::123456789012:role/", wantErr: true},
+		{name: "trailing slash", value: "arn:aws:iam::123456789012:role/service/", wantErr: true},
+		{name: "missing account", value: "arn:aws:iam:::role/app", wantErr: true},
+		{name: "region", value: "arn:aws:iam:us-east-1:123456789012:role/app", wantErr: true},
+		{name: "too few fields", value: "arn:aws:iam::role/app", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			roleName, account, err := ParseRoleArn(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRoleArn(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if roleName != tt.wantName || account != tt.wantAccount {
+				t.Errorf("ParseRoleArn(%q) = %q, %q, want %q, %q", tt.value, roleName, account, tt.wantName, tt.wantAccount)
+			}
+
+			name, err := ParseRoleName(tt.value)
+			if (err != nil) != tt.wantErr || name != tt.wantName {
+				t.Errorf("ParseRoleName(%q) = %q, %v, want %q", tt.value, name, err, tt.wantName)
+			}
+		})
+	}
+}
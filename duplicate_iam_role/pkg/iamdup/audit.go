@@ -0,0 +1,148 @@
+package iamdup
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrAuditFailed is returned in AuditStrict mode when a copied document
+// has a risky statement.
+var ErrAuditFailed = errors.New("audit found risky statements")
+
+// Finding is a risky statement found by AuditDocument.
+type Finding struct {
+	// Policy is the inline policy name, empty for the assume role policy
+	// document.
+	Policy    string
+	Reason    string
+	Statement json.RawMessage
+}
+
+func (f Finding) String() string {
+	if f.Policy == "" {
+		return fmt.Sprintf("assume role policy document %s: %s", f.Reason, f.Statement)
+	}
+	return fmt.Sprintf("inline policy %s %s: %s", f.Policy, f.Reason, f.Statement)
+}
+
+// Audit is told about each Finding of the documents about to be copied.
+type Audit func(finding Finding)
+
+// AuditDocument returns the Allow statements of document that grant every
+// action, apply to every resource or let any principal assume the role.
+// policyName is recorded in the findings, empty for the trust document.
+func AuditDocument(policyName string, document json.RawMessage) ([]Finding, error) {
+	var parsed map[string]json.RawMessage
+	err := json.Unmarshal(document, &parsed)
+	if err != nil {
+		return nil, fmt.Errorf("document is not a valid JSON object, %w", err)
+	}
+
+	var statements []json.RawMessage
+	if trimmed := bytes.TrimSpace(parsed["Statement"]); len(trimmed) > 0 && trimmed[0] == '{' {
+		statements = []json.RawMessage{trimmed}
+	} else if len(trimmed) > 0 {
+		err = json.Unmarshal(trimmed, &statements)
+		if err != nil {
+			return nil, fmt.Errorf("document Statement is not a list, %w", err)
+		}
+	}
+
+	var findings []Finding
+	for _, raw := range statements {
+		var statement map[string]interface{}
+		err = json.Unmarshal(raw, &statement)
+		if err != nil {
+			return nil, fmt.Errorf("document Statement is not an object, %w", err)
+		}
+
+		if statement["Effect"] != "Allow" {
+			continue
+		}
+
+		compact, err := encodeJSON(statement)
+		if err != nil {
+			return nil, err
+		}
+
+		if containsWildcard(statement["Action"]) {
+			findings = append(findings, Finding{Policy: policyName, Reason: "allows every action", Statement: compact})
+		}
+
+		if containsWildcard(statement["Resource"]) {
+			findings = append(findings, Finding{Policy: policyName, Reason: "applies to every resource", Statement: compact})
+		}
+
+		if allowsAssumeRole(statement["Action"]) && anyPrincipal(statement["Principal"]) {
+			findings = append(findings, Finding{Policy: policyName, Reason: "lets any principal assume the role", Statement: compact})
+		}
+	}
+
+	return findings, nil
+}
+
+// audit reports the findings of every document of snapshot to d.Audit and
+// fails in AuditStrict mode when there is any.
+func (d *Duplicator) audit(snapshot *Snapshot) error {
+	if d.Audit == nil && !d.AuditStrict {
+		return nil
+	}
+
+	findings, err := AuditDocument("", snapshot.AssumeRolePolicyDocument)
+	if err != nil {
+		return fmt.Errorf("unable to audit assume role policy document, %w", err)
+	}
+
+	for _, policy := range snapshot.InlinePolicies {
+		policyFindings, err := AuditDocument(policy.Name, policy.Document)
+		if err != nil {
+			return fmt.Errorf("unable to audit inline policy %s, %w", policy.Name, err)
+		}
+		findings = append(findings, policyFindings...)
+	}
+
+	if d.Audit != nil {
+		for _, finding := range findings {
+			d.Audit(finding)
+		}
+	}
+
+	if d.AuditStrict && len(findings) > 0 {
+		return fmt.Errorf("%d findings: %w", len(findings), ErrAuditFailed)
+	}
+
+	return nil
+}
+
+// containsWildcard reports whether value, a string or a list of strings,
+// is or contains "*".
+func containsWildcard(value interface{}) bool {
+	switch v := value.(type) {
+	case string:
+		return v == "*"
+	case []interface{}:
+		for _, s := range v {
+			if s == "*" {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// anyPrincipal reports whether principal is "*" or has "*" as AWS
+// principal.
+func anyPrincipal(principal interface{}) bool {
+	if principal == "*" {
+		return true
+	}
+
+	if principals, ok := principal.(map[string]interface{}); ok {
+		return containsWildcard(principals["AWS"])
+	}
+
+	return false
+}
@@ -0,0 +1,112 @@
+package iamdup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestAuditDocument(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		want     []string
+	}{
+		{
+			name:     "scoped",
+			document: `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:GetObject","Resource":"arn:aws:s3:::bucket/*"}]}`,
+		},
+		{
+			name:     "every action",
+			document: `{"Version":"2012-10-17","Statement":{"Effect":"Allow","Action":"*","Resource":"arn:aws:s3:::bucket"}}`,
+			want:     []string{"allows every action"},
+		},
+		{
+			name:     "every action and resource in a list",
+			document: `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":["s3:GetObject","*"],"Resource":["arn:aws:s3:::bucket","*"]}]}`,
+			want:     []string{"allows every action", "applies to every resource"},
+		},
+		{
+			name:     "deny is not risky",
+			document: `{"Version":"2012-10-17","Statement":[{"Effect":"Deny","Action":"*","Resource":"*"}]}`,
+		},
+		{
+			name:     "anyone assumes",
+			document: `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":"*","Action":"sts:AssumeRole"}]}`,
+			want:     []string{"lets any principal assume the role"},
+		},
+		{
+			name:     "any AWS principal assumes",
+			document: `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"AWS":["arn:aws:iam::111111111111:root","*"]},"Action":["sts:AssumeRole"]}]}`,
+			want:     []string{"lets any principal assume the role"},
+		},
+		{
+			name:     "service principal",
+			document: testTrust,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			findings, err := AuditDocument("policy", json.RawMessage(tt.document))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, finding := range findings {
+				got = append(got, finding.Reason)
+				if finding.Policy != "policy" || len(finding.Statement) == 0 {
+					t.Errorf("finding %+v does not name the policy and statement", finding)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("AuditDocument() reasons = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	_, err := AuditDocument("policy", json.RawMessage(`{"Statement":"*"}`))
+	if err == nil {
+		t.Error("AuditDocument() of a string Statement succeeded, want an error")
+	}
+}
+
+func TestAuditStrictBlocksCopy(t *testing.T) {
+	tests := []struct {
+		name    string
+		strict  bool
+		wantErr error
+	}{
+		{"warn", false, nil},
+		{"strict", true, ErrAuditFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newFakeIAM("111111111111")
+			client.addRole("app", testTrust).putInline("admin", `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"*","Resource":"*"}]}`)
+
+			var findings []Finding
+			d := New(client)
+			d.Audit = func(finding Finding) {
+				findings = append(findings, finding)
+			}
+			d.AuditStrict = tt.strict
+
+			_, err := d.Duplicate(context.Background(), "app", "app-copy")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Duplicate error = %v, want %v", err, tt.wantErr)
+			}
+
+			if len(findings) != 2 {
+				t.Errorf("findings = %v, want two for the admin policy", findings)
+			}
+			if client.hasRole("app-copy") == tt.strict {
+				t.Errorf("target role created %v, want %v", client.hasRole("app-copy"), !tt.strict)
+			}
+		})
+	}
+}
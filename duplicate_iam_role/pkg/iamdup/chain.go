@@ -0,0 +1,191 @@
+package iamdup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrSameAccount is returned by FollowTrust when Target is the source
+// account, where the copies of the trusted roles, which keep their names,
+// would be the trusted roles themselves.
+var ErrSameAccount = errors.New("target account is the source account")
+
+// TrustedRoleArns returns the role ARNs in the AWS principals of the Allow
+// statements of the assume role policy document, in order and without
+// repetition.
+func TrustedRoleArns(document json.RawMessage) ([]string, error) {
+	var parsed struct {
+		Statement json.RawMessage
+	}
+	err := json.Unmarshal(document, &parsed)
+	if err != nil {
+		return nil, fmt.Errorf("document is not a valid JSON object, %w", err)
+	}
+
+	var statements []map[string]interface{}
+	if trimmed := strings.TrimSpace(string(parsed.Statement)); strings.HasPrefix(trimmed, "{") {
+		statements = make([]map[string]interface{}, 1)
+		err = json.Unmarshal(parsed.Statement, &statements[0])
+	} else if trimmed != "" {
+		err = json.Unmarshal(parsed.Statement, &statements)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid document Statement, %w", err)
+	}
+
+	var arns []string
+	seen := make(map[string]bool)
+	for _, statement := range statements {
+		principal, ok := statement["Principal"].(map[string]interface{})
+		if !ok || statement["Effect"] != "Allow" {
+			continue
+		}
+
+		var values []interface{}
+		switch v := principal["AWS"].(type) {
+		case string:
+			values = []interface{}{v}
+		case []interface{}:
+			values = v
+		}
+
+		for _, value := range values {
+			arn, ok := value.(string)
+			if !ok || !isRoleArn(arn) || seen[arn] {
+				continue
+			}
+			seen[arn] = true
+			arns = append(arns, arn)
+		}
+	}
+
+	return arns, nil
+}
+
+// arnAccount returns the account ID of arn.
+func arnAccount(arn string) string {
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) != 6 {
+		return ""
+	}
+
+	return parts[4]
+}
+
+// followTrust duplicates, under their own names, the roles of the source
+// account trusted by snapshot, and the ones they trust in turn, then
+// rewrites the trust principals of snapshot to the ARNs of the copies.
+// visited maps the ARN of every role already handled to the ARN of its
+// copy, empty while the role is still being copied: a role trusted back
+// by one of the roles it trusts keeps the source principal, with a
+// warning, since its copy does not exist yet.
+func (d *Duplicator) followTrust(ctx context.Context, snapshot *Snapshot, visited map[string]string, results *[]*Result) error {
+	role, err := GetRole(ctx, d.Client, snapshot.RoleName)
+	if err != nil {
+		return roleNotFound("source", snapshot.RoleName, err)
+	}
+	account := arnAccount(*role.Role.Arn)
+	if _, ok := visited[*role.Role.Arn]; !ok {
+		visited[*role.Role.Arn] = ""
+	}
+
+	trustedArns, err := TrustedRoleArns(snapshot.AssumeRolePolicyDocument)
+	if err != nil {
+		return fmt.Errorf("unable to read trust principals of role %s, %w", snapshot.RoleName, err)
+	}
+
+	var replacements []Replacement
+	for _, trustedArn := range trustedArns {
+		if arnAccount(trustedArn) != account {
+			continue
+		}
+
+		copiedArn, ok := visited[trustedArn]
+		if !ok {
+			copiedArn, err = d.duplicateTrusted(ctx, trustedArn, visited, results)
+			if err != nil {
+				return fmt.Errorf("unable to duplicate role %s trusted by role %s, %w", trustedArn, snapshot.RoleName, err)
+			}
+		} else if copiedArn == "" {
+			d.warn(fmt.Sprintf("role %s trusts role %s, which trusts it back, the principal is left as is", snapshot.RoleName, trustedArn))
+		}
+
+		if copiedArn != "" && copiedArn != trustedArn {
+			// The quotes keep role/A from matching role/AB.
+			replacements = append(replacements, Replacement{Old: `"` + trustedArn + `"`, New: `"` + copiedArn + `"`})
+		}
+	}
+
+	if len(replacements) > 0 {
+		snapshot.AssumeRolePolicyDocument, err = ReplaceInDocument(snapshot.AssumeRolePolicyDocument, replacements)
+		if err != nil {
+			return fmt.Errorf("unable to rewrite trust principals of role %s, %w", snapshot.RoleName, err)
+		}
+	}
+
+	return nil
+}
+
+// duplicateTrusted copies the role of roleArn under the same name, after
+// the roles it trusts, and returns the ARN of the copy. Only the options
+// that are not specific to the role being duplicated apply to it.
+func (d *Duplicator) duplicateTrusted(ctx context.Context, roleArn string, visited map[string]string, results *[]*Result) (string, error) {
+	visited[roleArn] = ""
+
+	trusted := *d
+	trusted.Description = ""
+	trusted.Path = ""
+	trusted.AssumeRolePolicyDocument = nil
+	trusted.AddTrustPrincipals = nil
+	trusted.MaxSessionDuration = 0
+	trusted.AttachPolicies = nil
+	trusted.InlineManagedPolicies = nil
+	trusted.IncludePolicies = nil
+	trusted.ExcludePolicies = nil
+	trusted.CopyInstanceProfile = false
+	trusted.InstanceProfileName = ""
+	trusted.Lockdown = false
+
+	roleName, err := ParseRoleName(roleArn)
+	if err != nil {
+		return "", err
+	}
+
+	existing, err := GetRole(ctx, d.Target, roleName)
+	if err != nil && !IsNoSuchEntity(err) {
+		return "", fmt.Errorf("unable to check target role, %w", err)
+	}
+	if err == nil && *existing.Role.Arn == roleArn {
+		return "", fmt.Errorf("role %s: %w", roleArn, ErrSameAccount)
+	}
+
+	snapshot, err := trusted.Snapshot(ctx, roleName)
+	if err != nil {
+		return "", err
+	}
+
+	err = trusted.followTrust(ctx, snapshot, visited, results)
+	if err != nil {
+		return "", err
+	}
+
+	result, err := trusted.applyAttempts(ctx, snapshot, roleName)
+	if result != nil {
+		*results = append(*results, result)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// Nothing is created in a dry run, the principal is left as is.
+	copiedArn := result.RoleArn
+	if copiedArn == "" {
+		copiedArn = roleArn
+	}
+
+	visited[roleArn] = copiedArn
+	return copiedArn, nil
+}
@@ -0,0 +1,55 @@
+package iamdup
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+)
+
+func TestFollowTrustRequiresAnotherAccount(t *testing.T) {
+	client := newFakeIAM("111111111111")
+	client.addRole("caller", testTrust)
+	client.addRole("app", `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"AWS":"`+client.roleArn("caller")+`"},"Action":"sts:AssumeRole"}]}`)
+
+	d := New(client)
+	d.FollowTrust = true
+	d.Overwrite = true
+
+	_, err := d.Duplicate(context.Background(), "app", "app-copy")
+	if !errors.Is(err, ErrSameAccount) {
+		t.Fatalf("err = %v, want %v", err, ErrSameAccount)
+	}
+
+	for _, op := range []string{"CreateRole", "UpdateAssumeRolePolicy", "PutRolePolicy", "TagRole"} {
+		if calls := client.callsTo(op); len(calls) != 0 {
+			t.Errorf("%s called for %q", op, calls)
+		}
+	}
+}
+
+func TestFollowTrustCopiesTrustedRoles(t *testing.T) {
+	client := newFakeIAM("111111111111")
+	client.addRole("caller", testTrust)
+	client.addRole("app", `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"AWS":"`+client.roleArn("caller")+`"},"Action":"sts:AssumeRole"}]}`)
+
+	target := newFakeIAM("222222222222")
+	d := New(client)
+	d.Target = target
+	d.FollowTrust = true
+
+	result, err := d.Duplicate(context.Background(), "app", "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.TrustedRoles) != 1 || !target.hasRole("caller") {
+		t.Fatalf("trusted roles = %v, want caller copied", result.TrustedRoles)
+	}
+
+	want := `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"AWS":"` + target.roleArn("caller") + `"},"Action":"sts:AssumeRole"}]}`
+	got, _ := url.PathUnescape(*target.roles["app"].role.AssumeRolePolicyDocument)
+	if got != want {
+		t.Errorf("AssumeRolePolicyDocument = %s, want %s", got, want)
+	}
+}
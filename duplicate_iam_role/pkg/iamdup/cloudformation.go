@@ -0,0 +1,94 @@
+package iamdup
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"regexp"
+)
+
+type cloudFormationTemplate struct {
+	AWSTemplateFormatVersion string                            `json:"AWSTemplateFormatVersion"`
+	Description              string                            `json:"Description,omitempty"`
+	Resources                map[string]cloudFormationResource `json:"Resources"`
+}
+
+type cloudFormationResource struct {
+	Type       string                 `json:"Type"`
+	Properties cloudFormationRoleSpec `json:"Properties"`
+}
+
+type cloudFormationRoleSpec struct {
+	RoleName                 string                 `json:"RoleName"`
+	Path                     string                 `json:"Path,omitempty"`
+	Description              string                 `json:"Description,omitempty"`
+	MaxSessionDuration       int32                  `json:"MaxSessionDuration,omitempty"`
+	PermissionsBoundary      string                 `json:"PermissionsBoundary,omitempty"`
+	AssumeRolePolicyDocument json.RawMessage        `json:"AssumeRolePolicyDocument"`
+	Policies                 []cloudFormationPolicy `json:"Policies,omitempty"`
+	ManagedPolicyArns        []string               `json:"ManagedPolicyArns,omitempty"`
+	Tags                     []cloudFormationTag    `json:"Tags,omitempty"`
+}
+
+type cloudFormationPolicy struct {
+	PolicyName     string          `json:"PolicyName"`
+	PolicyDocument json.RawMessage `json:"PolicyDocument"`
+}
+
+type cloudFormationTag struct {
+	Key   string `json:"Key"`
+	Value string `json:"Value"`
+}
+
+var cloudFormationLogicalIDInvalid = regexp.MustCompile(`[^A-Za-z0-9]`)
+
+// WriteCloudFormation writes to w a JSON CloudFormation template with a
+// single AWS::IAM::Role named targetRoleName matching snapshot, its inline
+// policies and managed policy ARNs included. Nothing is created in the
+// target account.
+func (d *Duplicator) WriteCloudFormation(ctx context.Context, snapshot *Snapshot, targetRoleName string, w io.Writer) error {
+	snapshot, err := d.render(ctx, snapshot, targetRoleName)
+	if err != nil {
+		return err
+	}
+
+	role := cloudFormationRoleSpec{
+		RoleName:                 targetRoleName,
+		Path:                     snapshot.Path,
+		Description:              snapshot.Description,
+		MaxSessionDuration:       snapshot.MaxSessionDuration,
+		PermissionsBoundary:      snapshot.PermissionsBoundaryArn,
+		AssumeRolePolicyDocument: snapshot.AssumeRolePolicyDocument,
+	}
+
+	for _, policy := range snapshot.InlinePolicies {
+		role.Policies = append(role.Policies, cloudFormationPolicy{
+			PolicyName:     policy.Name,
+			PolicyDocument: policy.Document,
+		})
+	}
+
+	for _, policy := range snapshot.ManagedPolicies {
+		role.ManagedPolicyArns = append(role.ManagedPolicyArns, policy.Arn)
+	}
+
+	for _, tag := range snapshot.Tags {
+		role.Tags = append(role.Tags, cloudFormationTag{Key: tag.Key, Value: tag.Value})
+	}
+
+	template := cloudFormationTemplate{
+		AWSTemplateFormatVersion: "2010-09-09",
+		Description:              "IAM role " + targetRoleName + " copied from " + snapshot.RoleName,
+		Resources: map[string]cloudFormationResource{
+			cloudFormationLogicalIDInvalid.ReplaceAllString(targetRoleName, "") + "Role": {
+				Type:       "AWS::IAM::Role",
+				Properties: role,
+			},
+		},
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(template)
+}
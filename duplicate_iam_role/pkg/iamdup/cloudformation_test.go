@@ -0,0 +1,17 @@
+package iamdup
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func TestWriteCloudFormation(t *testing.T) {
+	var out bytes.Buffer
+	err := New(nil).WriteCloudFormation(context.Background(), goldenSnapshot(), "app-copy", &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkGolden(t, "cloudformation.json.golden", out.Bytes())
+}
@@ -0,0 +1,265 @@
+package iamdup
+
+import (
+	"context"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+)
+
+// CallCounter counts the IAM API calls made through the CountingClients
+// sharing it, so that the throttling risk of large runs can be assessed.
+type CallCounter struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func (c *CallCounter) add(op string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.counts == nil {
+		c.counts = make(map[string]int)
+	}
+	c.counts[op]++
+}
+
+// Counts returns the number of calls made to each operation so far.
+func (c *CallCounter) Counts() map[string]int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	counts := make(map[string]int, len(c.counts))
+	for op, count := range c.counts {
+		counts[op] = count
+	}
+
+	return counts
+}
+
+// CountingClient wraps an IAMClient and counts every call made through it
+// in Counter, whether it succeeded or not.
+type CountingClient struct {
+	IAMClient
+	Counter *CallCounter
+}
+
+func (c *CountingClient) GetRole(ctx context.Context, params *iam.GetRoleInput, optFns ...func(*iam.Options)) (*iam.GetRoleOutput, error) {
+	c.Counter.add("GetRole")
+	return c.IAMClient.GetRole(ctx, params, optFns...)
+}
+
+func (c *CountingClient) ListRoles(ctx context.Context, params *iam.ListRolesInput, optFns ...func(*iam.Options)) (*iam.ListRolesOutput, error) {
+	c.Counter.add("ListRoles")
+	return c.IAMClient.ListRoles(ctx, params, optFns...)
+}
+
+func (c *CountingClient) ListRolePolicies(ctx context.Context, params *iam.ListRolePoliciesInput, optFns ...func(*iam.Options)) (*iam.ListRolePoliciesOutput, error) {
+	c.Counter.add("ListRolePolicies")
+	return c.IAMClient.ListRolePolicies(ctx, params, optFns...)
+}
+
+func (c *CountingClient) GetRolePolicy(ctx context.Context, params *iam.GetRolePolicyInput, optFns ...func(*iam.Options)) (*iam.GetRolePolicyOutput, error) {
+	c.Counter.add("GetRolePolicy")
+	return c.IAMClient.GetRolePolicy(ctx, params, optFns...)
+}
+
+func (c *CountingClient) ListAttachedRolePolicies(ctx context.Context, params *iam.ListAttachedRolePoliciesInput, optFns ...func(*iam.Options)) (*iam.ListAttachedRolePoliciesOutput, error) {
+	c.Counter.add("ListAttachedRolePolicies")
+	return c.IAMClient.ListAttachedRolePolicies(ctx, params, optFns...)
+}
+
+func (c *CountingClient) CreateRole(ctx context.Context, params *iam.CreateRoleInput, optFns ...func(*iam.Options)) (*iam.CreateRoleOutput, error) {
+	c.Counter.add("CreateRole")
+	return c.IAMClient.CreateRole(ctx, params, optFns...)
+}
+
+func (c *CountingClient) PutRolePolicy(ctx context.Context, params *iam.PutRolePolicyInput, optFns ...func(*iam.Options)) (*iam.PutRolePolicyOutput, error) {
+	c.Counter.add("PutRolePolicy")
+	return c.IAMClient.PutRolePolicy(ctx, params, optFns...)
+}
+
+func (c *CountingClient) AttachRolePolicy(ctx context.Context, params *iam.AttachRolePolicyInput, optFns ...func(*iam.Options)) (*iam.AttachRolePolicyOutput, error) {
+	c.Counter.add("AttachRolePolicy")
+	return c.IAMClient.AttachRolePolicy(ctx, params, optFns...)
+}
+
+func (c *CountingClient) UpdateAssumeRolePolicy(ctx context.Context, params *iam.UpdateAssumeRolePolicyInput, optFns ...func(*iam.Options)) (*iam.UpdateAssumeRolePolicyOutput, error) {
+	c.Counter.add("UpdateAssumeRolePolicy")
+	return c.IAMClient.UpdateAssumeRolePolicy(ctx, params, optFns...)
+}
+
+func (c *CountingClient) DeleteRolePolicy(ctx context.Context, params *iam.DeleteRolePolicyInput, optFns ...func(*iam.Options)) (*iam.DeleteRolePolicyOutput, error) {
+	c.Counter.add("DeleteRolePolicy")
+	return c.IAMClient.DeleteRolePolicy(ctx, params, optFns...)
+}
+
+func (c *CountingClient) DetachRolePolicy(ctx context.Context, params *iam.DetachRolePolicyInput, optFns ...func(*iam.Options)) (*iam.DetachRolePolicyOutput, error) {
+	c.Counter.add("DetachRolePolicy")
+	return c.IAMClient.DetachRolePolicy(ctx, params, optFns...)
+}
+
+func (c *CountingClient) DeleteRole(ctx context.Context, params *iam.DeleteRoleInput, optFns ...func(*iam.Options)) (*iam.DeleteRoleOutput, error) {
+	c.Counter.add("DeleteRole")
+	return c.IAMClient.DeleteRole(ctx, params, optFns...)
+}
+
+func (c *CountingClient) TagRole(ctx context.Context, params *iam.TagRoleInput, optFns ...func(*iam.Options)) (*iam.TagRoleOutput, error) {
+	c.Counter.add("TagRole")
+	return c.IAMClient.TagRole(ctx, params, optFns...)
+}
+
+func (c *CountingClient) UntagRole(ctx context.Context, params *iam.UntagRoleInput, optFns ...func(*iam.Options)) (*iam.UntagRoleOutput, error) {
+	c.Counter.add("UntagRole")
+	return c.IAMClient.UntagRole(ctx, params, optFns...)
+}
+
+func (c *CountingClient) ListInstanceProfilesForRole(ctx context.Context, params *iam.ListInstanceProfilesForRoleInput, optFns ...func(*iam.Options)) (*iam.ListInstanceProfilesForRoleOutput, error) {
+	c.Counter.add("ListInstanceProfilesForRole")
+	return c.IAMClient.ListInstanceProfilesForRole(ctx, params, optFns...)
+}
+
+func (c *CountingClient) RemoveRoleFromInstanceProfile(ctx context.Context, params *iam.RemoveRoleFromInstanceProfileInput, optFns ...func(*iam.Options)) (*iam.RemoveRoleFromInstanceProfileOutput, error) {
+	c.Counter.add("RemoveRoleFromInstanceProfile")
+	return c.IAMClient.RemoveRoleFromInstanceProfile(ctx, params, optFns...)
+}
+
+func (c *CountingClient) CreateInstanceProfile(ctx context.Context, params *iam.CreateInstanceProfileInput, optFns ...func(*iam.Options)) (*iam.CreateInstanceProfileOutput, error) {
+	c.Counter.add("CreateInstanceProfile")
+	return c.IAMClient.CreateInstanceProfile(ctx, params, optFns...)
+}
+
+func (c *CountingClient) AddRoleToInstanceProfile(ctx context.Context, params *iam.AddRoleToInstanceProfileInput, optFns ...func(*iam.Options)) (*iam.AddRoleToInstanceProfileOutput, error) {
+	c.Counter.add("AddRoleToInstanceProfile")
+	return c.IAMClient.AddRoleToInstanceProfile(ctx, params, optFns...)
+}
+
+func (c *CountingClient) DeleteInstanceProfile(ctx context.Context, params *iam.DeleteInstanceProfileInput, optFns ...func(*iam.Options)) (*iam.DeleteInstanceProfileOutput, error) {
+	c.Counter.add("DeleteInstanceProfile")
+	return c.IAMClient.DeleteInstanceProfile(ctx, params, optFns...)
+}
+
+func (c *CountingClient) GetPolicy(ctx context.Context, params *iam.GetPolicyInput, optFns ...func(*iam.Options)) (*iam.GetPolicyOutput, error) {
+	c.Counter.add("GetPolicy")
+	return c.IAMClient.GetPolicy(ctx, params, optFns...)
+}
+
+func (c *CountingClient) GetPolicyVersion(ctx context.Context, params *iam.GetPolicyVersionInput, optFns ...func(*iam.Options)) (*iam.GetPolicyVersionOutput, error) {
+	c.Counter.add("GetPolicyVersion")
+	return c.IAMClient.GetPolicyVersion(ctx, params, optFns...)
+}
+
+func (c *CountingClient) ListPolicyVersions(ctx context.Context, params *iam.ListPolicyVersionsInput, optFns ...func(*iam.Options)) (*iam.ListPolicyVersionsOutput, error) {
+	c.Counter.add("ListPolicyVersions")
+	return c.IAMClient.ListPolicyVersions(ctx, params, optFns...)
+}
+
+func (c *CountingClient) ListPolicyTags(ctx context.Context, params *iam.ListPolicyTagsInput, optFns ...func(*iam.Options)) (*iam.ListPolicyTagsOutput, error) {
+	c.Counter.add("ListPolicyTags")
+	return c.IAMClient.ListPolicyTags(ctx, params, optFns...)
+}
+
+func (c *CountingClient) ListPolicies(ctx context.Context, params *iam.ListPoliciesInput, optFns ...func(*iam.Options)) (*iam.ListPoliciesOutput, error) {
+	c.Counter.add("ListPolicies")
+	return c.IAMClient.ListPolicies(ctx, params, optFns...)
+}
+
+func (c *CountingClient) CreatePolicy(ctx context.Context, params *iam.CreatePolicyInput, optFns ...func(*iam.Options)) (*iam.CreatePolicyOutput, error) {
+	c.Counter.add("CreatePolicy")
+	return c.IAMClient.CreatePolicy(ctx, params, optFns...)
+}
+
+func (c *CountingClient) CreatePolicyVersion(ctx context.Context, params *iam.CreatePolicyVersionInput, optFns ...func(*iam.Options)) (*iam.CreatePolicyVersionOutput, error) {
+	c.Counter.add("CreatePolicyVersion")
+	return c.IAMClient.CreatePolicyVersion(ctx, params, optFns...)
+}
+
+func (c *CountingClient) DeletePolicyVersion(ctx context.Context, params *iam.DeletePolicyVersionInput, optFns ...func(*iam.Options)) (*iam.DeletePolicyVersionOutput, error) {
+	c.Counter.add("DeletePolicyVersion")
+	return c.IAMClient.DeletePolicyVersion(ctx, params, optFns...)
+}
+
+func (c *CountingClient) DeletePolicy(ctx context.Context, params *iam.DeletePolicyInput, optFns ...func(*iam.Options)) (*iam.DeletePolicyOutput, error) {
+	c.Counter.add("DeletePolicy")
+	return c.IAMClient.DeletePolicy(ctx, params, optFns...)
+}
+
+func (c *CountingClient) GetUser(ctx context.Context, params *iam.GetUserInput, optFns ...func(*iam.Options)) (*iam.GetUserOutput, error) {
+	c.Counter.add("GetUser")
+	return c.IAMClient.GetUser(ctx, params, optFns...)
+}
+
+func (c *CountingClient) ListUserPolicies(ctx context.Context, params *iam.ListUserPoliciesInput, optFns ...func(*iam.Options)) (*iam.ListUserPoliciesOutput, error) {
+	c.Counter.add("ListUserPolicies")
+	return c.IAMClient.ListUserPolicies(ctx, params, optFns...)
+}
+
+func (c *CountingClient) GetUserPolicy(ctx context.Context, params *iam.GetUserPolicyInput, optFns ...func(*iam.Options)) (*iam.GetUserPolicyOutput, error) {
+	c.Counter.add("GetUserPolicy")
+	return c.IAMClient.GetUserPolicy(ctx, params, optFns...)
+}
+
+func (c *CountingClient) ListAttachedUserPolicies(ctx context.Context, params *iam.ListAttachedUserPoliciesInput, optFns ...func(*iam.Options)) (*iam.ListAttachedUserPoliciesOutput, error) {
+	c.Counter.add("ListAttachedUserPolicies")
+	return c.IAMClient.ListAttachedUserPolicies(ctx, params, optFns...)
+}
+
+func (c *CountingClient) CreateUser(ctx context.Context, params *iam.CreateUserInput, optFns ...func(*iam.Options)) (*iam.CreateUserOutput, error) {
+	c.Counter.add("CreateUser")
+	return c.IAMClient.CreateUser(ctx, params, optFns...)
+}
+
+func (c *CountingClient) PutUserPolicy(ctx context.Context, params *iam.PutUserPolicyInput, optFns ...func(*iam.Options)) (*iam.PutUserPolicyOutput, error) {
+	c.Counter.add("PutUserPolicy")
+	return c.IAMClient.PutUserPolicy(ctx, params, optFns...)
+}
+
+func (c *CountingClient) AttachUserPolicy(ctx context.Context, params *iam.AttachUserPolicyInput, optFns ...func(*iam.Options)) (*iam.AttachUserPolicyOutput, error) {
+	c.Counter.add("AttachUserPolicy")
+	return c.IAMClient.AttachUserPolicy(ctx, params, optFns...)
+}
+
+func (c *CountingClient) GetGroup(ctx context.Context, params *iam.GetGroupInput, optFns ...func(*iam.Options)) (*iam.GetGroupOutput, error) {
+	c.Counter.add("GetGroup")
+	return c.IAMClient.GetGroup(ctx, params, optFns...)
+}
+
+func (c *CountingClient) ListGroupPolicies(ctx context.Context, params *iam.ListGroupPoliciesInput, optFns ...func(*iam.Options)) (*iam.ListGroupPoliciesOutput, error) {
+	c.Counter.add("ListGroupPolicies")
+	return c.IAMClient.ListGroupPolicies(ctx, params, optFns...)
+}
+
+func (c *CountingClient) GetGroupPolicy(ctx context.Context, params *iam.GetGroupPolicyInput, optFns ...func(*iam.Options)) (*iam.GetGroupPolicyOutput, error) {
+	c.Counter.add("GetGroupPolicy")
+	return c.IAMClient.GetGroupPolicy(ctx, params, optFns...)
+}
+
+func (c *CountingClient) ListAttachedGroupPolicies(ctx context.Context, params *iam.ListAttachedGroupPoliciesInput, optFns ...func(*iam.Options)) (*iam.ListAttachedGroupPoliciesOutput, error) {
+	c.Counter.add("ListAttachedGroupPolicies")
+	return c.IAMClient.ListAttachedGroupPolicies(ctx, params, optFns...)
+}
+
+func (c *CountingClient) CreateGroup(ctx context.Context, params *iam.CreateGroupInput, optFns ...func(*iam.Options)) (*iam.CreateGroupOutput, error) {
+	c.Counter.add("CreateGroup")
+	return c.IAMClient.CreateGroup(ctx, params, optFns...)
+}
+
+func (c *CountingClient) PutGroupPolicy(ctx context.Context, params *iam.PutGroupPolicyInput, optFns ...func(*iam.Options)) (*iam.PutGroupPolicyOutput, error) {
+	c.Counter.add("PutGroupPolicy")
+	return c.IAMClient.PutGroupPolicy(ctx, params, optFns...)
+}
+
+func (c *CountingClient) AttachGroupPolicy(ctx context.Context, params *iam.AttachGroupPolicyInput, optFns ...func(*iam.Options)) (*iam.AttachGroupPolicyOutput, error) {
+	c.Counter.add("AttachGroupPolicy")
+	return c.IAMClient.AttachGroupPolicy(ctx, params, optFns...)
+}
+
+func (c *CountingClient) AddUserToGroup(ctx context.Context, params *iam.AddUserToGroupInput, optFns ...func(*iam.Options)) (*iam.AddUserToGroupOutput, error) {
+	c.Counter.add("AddUserToGroup")
+	return c.IAMClient.AddUserToGroup(ctx, params, optFns...)
+}
+
+func (c *CountingClient) SimulatePrincipalPolicy(ctx context.Context, params *iam.SimulatePrincipalPolicyInput, optFns ...func(*iam.Options)) (*iam.SimulatePrincipalPolicyOutput, error) {
+	c.Counter.add("SimulatePrincipalPolicy")
+	return c.IAMClient.SimulatePrincipalPolicy(ctx, params, optFns...)
+}
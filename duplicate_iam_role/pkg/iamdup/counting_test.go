@@ -0,0 +1,46 @@
+package iamdup
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestCountingClientCountsCalls(t *testing.T) {
+	client := newFakeIAM("111111111111")
+	source := client.addRole("app", testTrust)
+	source.putInline("s3", testDocument)
+	source.putInline("sqs", testDocument)
+	source.attach("ReadOnlyAccess", "arn:aws:iam::aws:policy/ReadOnlyAccess")
+
+	var counter CallCounter
+	d := New(&CountingClient{IAMClient: client, Counter: &counter})
+
+	_, err := d.Duplicate(context.Background(), "app", "app-copy")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counts := counter.Counts()
+	for op, want := range map[string]int{"CreateRole": 1, "GetRolePolicy": 2, "PutRolePolicy": 2, "AttachRolePolicy": 1} {
+		if counts[op] != want {
+			t.Errorf("%s counted %d times, want %d", op, counts[op], want)
+		}
+	}
+
+	// Failed calls, such as the GetRole of the missing target, are counted
+	// as well.
+	want := make(map[string]int)
+	for _, call := range client.calls {
+		op, _, _ := strings.Cut(call, " ")
+		want[op]++
+	}
+	for op, count := range want {
+		if counts[op] != count {
+			t.Errorf("%s counted %d times, made %d times", op, counts[op], count)
+		}
+	}
+	if len(counts) != len(want) {
+		t.Errorf("counted operations %v, want %v", counts, want)
+	}
+}
@@ -0,0 +1,76 @@
+package iamdup
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+)
+
+// Delete removes roleName through Target. IAM refuses to delete a role that
+// still has policies or instance profiles, so its managed policies are
+// detached, its inline policies deleted and it is removed from its instance
+// profiles first.
+func (d *Duplicator) Delete(ctx context.Context, roleName string) error {
+	managedPolicies, err := GetManagedPolicies(ctx, d.Target, roleName)
+	if err != nil {
+		return fmt.Errorf("unable to get managed policies, %w", err)
+	}
+
+	for _, policy := range managedPolicies {
+		params := iam.DetachRolePolicyInput{
+			RoleName:  &roleName,
+			PolicyArn: policy.PolicyArn,
+		}
+
+		_, err := d.Target.DetachRolePolicy(ctx, &params)
+		if err != nil {
+			return &OpError{Op: "DetachRolePolicy", RoleName: roleName, PolicyName: *policy.PolicyArn, Err: err}
+		}
+	}
+
+	inlinePolicyNames, err := ListInlinePolicyNames(ctx, d.Target, roleName)
+	if err != nil {
+		return fmt.Errorf("unable to get inline policies, %w", err)
+	}
+
+	for _, policyName := range inlinePolicyNames {
+		params := iam.DeleteRolePolicyInput{
+			RoleName:   &roleName,
+			PolicyName: &policyName,
+		}
+
+		_, err := d.Target.DeleteRolePolicy(ctx, &params)
+		if err != nil {
+			return &OpError{Op: "DeleteRolePolicy", RoleName: roleName, PolicyName: policyName, Err: err}
+		}
+	}
+
+	instanceProfiles, err := GetInstanceProfiles(ctx, d.Target, roleName)
+	if err != nil {
+		return fmt.Errorf("unable to get instance profiles, %w", err)
+	}
+
+	for _, instanceProfile := range instanceProfiles {
+		params := iam.RemoveRoleFromInstanceProfileInput{
+			RoleName:            &roleName,
+			InstanceProfileName: instanceProfile.InstanceProfileName,
+		}
+
+		_, err := d.Target.RemoveRoleFromInstanceProfile(ctx, &params)
+		if err != nil {
+			return fmt.Errorf("instance profile %s, %w", *instanceProfile.InstanceProfileName, &OpError{Op: "RemoveRoleFromInstanceProfile", RoleName: roleName, Err: err})
+		}
+	}
+
+	params := iam.DeleteRoleInput{
+		RoleName: &roleName,
+	}
+
+	_, err = d.Target.DeleteRole(ctx, &params)
+	if err != nil {
+		return &OpError{Op: "DeleteRole", RoleName: roleName, Err: err}
+	}
+
+	return nil
+}
@@ -0,0 +1,161 @@
+package iamdup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// Difference is a single way in which two role definitions differ.
+type Difference struct {
+	// Kind is what differs, for example "inline policy" or "tag".
+	Kind string
+	// Name identifies the policy or tag, empty for the trust document.
+	Name string
+	// Change is "only in source", "only in target" or "differs".
+	Change string
+}
+
+func (d Difference) String() string {
+	if d.Name == "" {
+		return fmt.Sprintf("%s %s", d.Kind, d.Change)
+	}
+	return fmt.Sprintf("%s %s %s", d.Kind, d.Name, d.Change)
+}
+
+// Diff compares sourceRoleName, read through Client, with targetRoleName,
+// read through Target.
+func (d *Duplicator) Diff(ctx context.Context, sourceRoleName string, targetRoleName string) ([]Difference, error) {
+	source, err := d.snapshotRole(ctx, d.Client, sourceRoleName)
+	if err != nil {
+		return nil, roleNotFound("source", sourceRoleName, err)
+	}
+
+	target, err := d.snapshotRole(ctx, d.Target, targetRoleName)
+	if err != nil {
+		return nil, roleNotFound("target", targetRoleName, err)
+	}
+
+	return DiffSnapshots(source, target)
+}
+
+// DiffFromSnapshot compares roleName, read through Client, with snapshot,
+// typically a baseline written by Export, to detect drift. The live role is
+// the source of the differences.
+func (d *Duplicator) DiffFromSnapshot(ctx context.Context, roleName string, snapshot *Snapshot) ([]Difference, error) {
+	source, err := d.snapshotRole(ctx, d.Client, roleName)
+	if err != nil {
+		return nil, roleNotFound("source", roleName, err)
+	}
+
+	return DiffSnapshots(source, snapshot)
+}
+
+// DiffSnapshots compares the assume role policy documents, inline policies,
+// managed policies and tags of two snapshots. Documents are compared as
+// parsed JSON so formatting does not produce differences.
+func DiffSnapshots(source *Snapshot, target *Snapshot) ([]Difference, error) {
+	var differences []Difference
+
+	equal, err := EqualDocuments(source.AssumeRolePolicyDocument, target.AssumeRolePolicyDocument)
+	if err != nil {
+		return nil, fmt.Errorf("unable to compare assume role policy documents, %w", err)
+	}
+	if !equal {
+		differences = append(differences, Difference{Kind: "assume role policy document", Change: "differs"})
+	}
+
+	targetInline := make(map[string]json.RawMessage, len(target.InlinePolicies))
+	for _, policy := range target.InlinePolicies {
+		targetInline[policy.Name] = policy.Document
+	}
+
+	sourceInline := make(map[string]bool, len(source.InlinePolicies))
+	for _, policy := range source.InlinePolicies {
+		sourceInline[policy.Name] = true
+
+		document, ok := targetInline[policy.Name]
+		if !ok {
+			differences = append(differences, Difference{Kind: "inline policy", Name: policy.Name, Change: "only in source"})
+			continue
+		}
+
+		equal, err := EqualDocuments(policy.Document, document)
+		if err != nil {
+			return nil, fmt.Errorf("unable to compare inline policy %s, %w", policy.Name, err)
+		}
+		if !equal {
+			differences = append(differences, Difference{Kind: "inline policy", Name: policy.Name, Change: "differs"})
+		}
+	}
+
+	for _, policy := range target.InlinePolicies {
+		if !sourceInline[policy.Name] {
+			differences = append(differences, Difference{Kind: "inline policy", Name: policy.Name, Change: "only in target"})
+		}
+	}
+
+	targetManaged := make(map[string]bool, len(target.ManagedPolicies))
+	for _, policy := range target.ManagedPolicies {
+		targetManaged[policy.Arn] = true
+	}
+
+	sourceManaged := make(map[string]bool, len(source.ManagedPolicies))
+	for _, policy := range source.ManagedPolicies {
+		sourceManaged[policy.Arn] = true
+
+		if !targetManaged[policy.Arn] {
+			differences = append(differences, Difference{Kind: "managed policy", Name: policy.Arn, Change: "only in source"})
+		}
+	}
+
+	for _, policy := range target.ManagedPolicies {
+		if !sourceManaged[policy.Arn] {
+			differences = append(differences, Difference{Kind: "managed policy", Name: policy.Arn, Change: "only in target"})
+		}
+	}
+
+	targetTags := make(map[string]string, len(target.Tags))
+	for _, tag := range target.Tags {
+		targetTags[tag.Key] = tag.Value
+	}
+
+	sourceTags := make(map[string]bool, len(source.Tags))
+	for _, tag := range source.Tags {
+		sourceTags[tag.Key] = true
+
+		value, ok := targetTags[tag.Key]
+		if !ok {
+			differences = append(differences, Difference{Kind: "tag", Name: tag.Key, Change: "only in source"})
+		} else if value != tag.Value {
+			differences = append(differences, Difference{Kind: "tag", Name: tag.Key, Change: "differs"})
+		}
+	}
+
+	for _, tag := range target.Tags {
+		if !sourceTags[tag.Key] {
+			differences = append(differences, Difference{Kind: "tag", Name: tag.Key, Change: "only in target"})
+		}
+	}
+
+	return differences, nil
+}
+
+// EqualDocuments reports whether two JSON policy documents are equal once
+// parsed.
+func EqualDocuments(a json.RawMessage, b json.RawMessage) (bool, error) {
+	var parsedA, parsedB interface{}
+
+	err := json.Unmarshal(a, &parsedA)
+	if err != nil {
+		return false, err
+	}
+
+	err = json.Unmarshal(b, &parsedB)
+	if err != nil {
+		return false, err
+	}
+
+	return reflect.DeepEqual(parsedA, parsedB), nil
+}
@@ -0,0 +1,46 @@
+package iamdup
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestDiffFromSnapshotDetectsDrift(t *testing.T) {
+	client := newFakeIAM("111111111111")
+	role := client.addRole("app", testTrust)
+	role.putInline("read", testDocument)
+
+	var baseline bytes.Buffer
+	d := New(client)
+	err := d.Export(context.Background(), "app", &baseline)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot, err := ReadSnapshot(&baseline)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	differences, err := d.DiffFromSnapshot(context.Background(), "app", snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(differences) != 0 {
+		t.Fatalf("differences before drift = %v, want none", differences)
+	}
+
+	role.putInline("read", `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:*","Resource":"*"}]}`)
+
+	differences, err = d.DiffFromSnapshot(context.Background(), "app", snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Difference{{Kind: "inline policy", Name: "read", Change: "differs"}}
+	if !reflect.DeepEqual(differences, want) {
+		t.Errorf("differences = %v, want %v", differences, want)
+	}
+}
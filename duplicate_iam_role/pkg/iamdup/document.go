@@ -0,0 +1,101 @@
+package iamdup
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+)
+
+// decodeDocument unescapes a URL-encoded policy document and checks that
+// the result is JSON.
+func decodeDocument(document string) (json.RawMessage, error) {
+	decoded, err := url.PathUnescape(document)
+	if err != nil {
+		return nil, err
+	}
+
+	if !json.Valid([]byte(decoded)) {
+		return nil, fmt.Errorf("document is not valid JSON")
+	}
+
+	return json.RawMessage(decoded), nil
+}
+
+// ValidateDocument checks that document parses as a JSON object with a
+// Statement element, as every IAM policy document must have.
+func ValidateDocument(document json.RawMessage) error {
+	var parsed map[string]interface{}
+
+	err := json.Unmarshal(document, &parsed)
+	if err != nil {
+		return fmt.Errorf("document is not a valid JSON object, %w", err)
+	}
+
+	if _, ok := parsed["Statement"]; !ok {
+		return fmt.Errorf("document has no Statement")
+	}
+
+	return nil
+}
+
+// Validate checks every policy document of the snapshot with
+// ValidateDocument and reports the first one that is invalid, then checks
+// the total size of the inline policies.
+func (s *Snapshot) Validate() error {
+	err := ValidateDocument(s.AssumeRolePolicyDocument)
+	if err != nil {
+		return fmt.Errorf("invalid assume role policy document, %w", err)
+	}
+
+	for _, policy := range s.InlinePolicies {
+		err = ValidateDocument(policy.Document)
+		if err != nil {
+			return fmt.Errorf("invalid inline policy %s, %w", policy.Name, err)
+		}
+
+		err = ValidateInlinePolicySize(policy)
+		if err != nil {
+			return err
+		}
+	}
+
+	return ValidateInlinePoliciesSize(s.InlinePolicies)
+}
+
+// NormalizeDocument re-encodes a JSON policy document with sorted keys and
+// indentation. Numbers are kept verbatim so the result is semantically
+// identical to document.
+func NormalizeDocument(document json.RawMessage) (json.RawMessage, error) {
+	decoder := json.NewDecoder(bytes.NewReader(document))
+	decoder.UseNumber()
+
+	var parsed interface{}
+	err := decoder.Decode(&parsed)
+	if err != nil {
+		return nil, fmt.Errorf("document is not valid JSON, %w", err)
+	}
+
+	return json.MarshalIndent(parsed, "", "  ")
+}
+
+// mapDocuments replaces the assume role policy document and every inline
+// policy document of the snapshot with the result of fn. The name passed to
+// fn is empty for the assume role policy document.
+func (s *Snapshot) mapDocuments(fn func(name string, document json.RawMessage) (json.RawMessage, error)) error {
+	document, err := fn("", s.AssumeRolePolicyDocument)
+	if err != nil {
+		return fmt.Errorf("assume role policy document, %w", err)
+	}
+	s.AssumeRolePolicyDocument = document
+
+	for i, policy := range s.InlinePolicies {
+		document, err := fn(policy.Name, policy.Document)
+		if err != nil {
+			return fmt.Errorf("inline policy %s, %w", policy.Name, err)
+		}
+		s.InlinePolicies[i].Document = document
+	}
+
+	return nil
+}
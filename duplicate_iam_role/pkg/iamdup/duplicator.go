@@ -0,0 +1,965 @@
+// Package iamdup duplicates an IAM role, together with its inline and
+// managed policies, into a new role.
+package iamdup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Duplicator reads roles through Client and creates the copies through
+// Target, which may point to a different account.
+type Duplicator struct {
+	Client IAMClient
+	Target IAMClient
+
+	// Overwrite updates the target role in place when it already exists
+	// instead of failing.
+	Overwrite bool
+
+	// ProtectPattern is a regular expression matched against the name of
+	// an existing target role. A matching role is never changed unless
+	// Force is set.
+	ProtectPattern string
+	Force          bool
+
+	// RollbackOnError removes everything created by Duplicate, including the
+	// target role itself, when a step after CreateRole fails.
+	RollbackOnError bool
+
+	// Description and Path replace the source values on the target role
+	// when set.
+	Description string
+	Path        string
+
+	// SkipBoundary creates the target role without a permissions boundary,
+	// whatever the source role has.
+	SkipBoundary bool
+
+	// PermissionsBoundaryArn is the permissions boundary of the target
+	// role, used as is instead of the source one, or added when the source
+	// role has none.
+	PermissionsBoundaryArn string
+
+	// CopyBoundaryPolicy recreates a customer managed permissions boundary
+	// in the target account instead of referencing the source ARN.
+	CopyBoundaryPolicy bool
+
+	// CloneManagedPolicies recreates every customer managed policy attached
+	// to the source role in the target account and attaches the new policy
+	// instead of the source ARN. AWS managed policies are attached as is.
+	CloneManagedPolicies bool
+
+	// CloneAllPolicyVersions also copies the non-default versions of the
+	// policies recreated by CopyBoundaryPolicy and CloneManagedPolicies.
+	// Only the default version is copied otherwise.
+	CloneAllPolicyVersions bool
+
+	// RecordPolicyVersions makes Export pin every customer managed policy
+	// to its current default version, which CloneManagedPolicies then
+	// clones instead of the default version at the time of the import.
+	RecordPolicyVersions bool
+
+	// CopyGroupMembers adds the members of a source group to the duplicated
+	// group in DuplicateGroup.
+	CopyGroupMembers bool
+
+	// CopyInstanceProfile wraps the target role in an instance profile when
+	// the source role is in one. The instance profile is named
+	// InstanceProfileName, or after the target role when empty.
+	CopyInstanceProfile bool
+	InstanceProfileName string
+
+	// AssumeRolePolicyDocument replaces the source trust policy when set.
+	AssumeRolePolicyDocument json.RawMessage
+
+	// AddTrustPrincipals are ARNs or account IDs added to the AWS principals
+	// allowed to assume the target role, on top of the source trust policy.
+	AddTrustPrincipals []string
+
+	// MaxSessionDuration replaces the source maximum session duration, in
+	// seconds, when set.
+	MaxSessionDuration int32
+
+	// AttachPolicies lists extra managed policies attached to the target
+	// role, by ARN or by the name of a customer managed policy of the target
+	// account.
+	AttachPolicies []string
+
+	// TargetPartition rewrites the partition of the ARNs in the trust policy,
+	// the permissions boundary and the managed policy references when the
+	// target account lives in another partition, such as aws-us-gov.
+	TargetPartition string
+
+	// IncludePolicies and ExcludePolicies are glob patterns matched against
+	// inline policy names and managed policy names and ARNs. When includes
+	// are given only matching policies are copied; excludes always win. A
+	// plain name of a customer managed policy of the source account matches
+	// that policy only, not an AWS managed policy of the same name.
+	IncludePolicies []string
+	ExcludePolicies []string
+
+	// SkipInlinePolicies and SkipManagedPolicies leave the corresponding
+	// policies of the source role behind. In overwrite mode the policies
+	// already on the target role are left untouched.
+	SkipInlinePolicies  bool
+	SkipManagedPolicies bool
+
+	// SplitOversize spreads the statements of inline policies larger than
+	// MaxInlinePolicySize over several inline policies. IAM limits their
+	// total as well, which Snapshot.Validate checks before anything is
+	// written.
+	SplitOversize bool
+
+	// NormalizeJSON rewrites policy documents with sorted keys and
+	// indentation before they are written.
+	NormalizeJSON bool
+
+	// SetTags adds tags to the target role, replacing source tags with the
+	// same key. RemoveTags lists source tag keys that are not copied.
+	SetTags    []Tag
+	RemoveTags []string
+
+	// PolicyNameTemplate is a text/template rendering the name of each
+	// inline policy of the target from a PolicyNameData, such as
+	// prod-{{.Name}}. The names are kept when empty.
+	PolicyNameTemplate string
+
+	// FollowTrust makes Duplicate first copy, under their own names, the
+	// roles of the source account allowed to assume the source role by its
+	// assume role policy document, recursively, and point the copied
+	// document to the copies. Target must be another account, Duplicate
+	// fails with ErrSameAccount otherwise.
+	FollowTrust bool
+
+	// SkipMissingPolicies checks that every managed policy of the source
+	// role still exists and leaves out, with a warning, the ones that do
+	// not, instead of failing to attach them.
+	SkipMissingPolicies bool
+
+	// InlineManagedPolicies lists, by name or ARN, managed policies of the
+	// source role written to the target as inline policies named after
+	// them, with the document of their default version, instead of being
+	// attached. This keeps the target under the attached policies quota.
+	// The inlined documents get the same overrides and splitting as the
+	// other inline policies.
+	InlineManagedPolicies []string
+
+	// TrustFrom names the source role whose assume role policy document,
+	// tags and other attributes are given to the target of
+	// DuplicateMerged. The first source role is used when empty.
+	TrustFrom string
+
+	// FailOnCollision makes DuplicateMerged fail when several source roles
+	// have an inline policy with the same name, instead of prefixing the
+	// name with the one of the role.
+	FailOnCollision bool
+
+	// Lockdown creates the target role with LockdownPolicyDocument as its
+	// assume role policy document, so that nobody can assume it until it
+	// is reviewed and given its real document with Activate. The real
+	// document is kept in the LockdownTrustTag tags of the role meanwhile.
+	Lockdown bool
+
+	// Replacements are applied, in order, to the decoded assume role policy
+	// document and inline policy documents.
+	Replacements []Replacement
+
+	// ProvenanceTags adds CopiedFrom, the source role name, and CopiedAt,
+	// the time of the copy, to the target tags. SetTags and RemoveTags
+	// still apply to them.
+	ProvenanceTags bool
+
+	// Concurrency limits how many inline policies are fetched, or managed
+	// policies attached, at once. DefaultConcurrency when zero.
+	Concurrency int
+
+	// WaitTimeout bounds how long a newly created role is polled for before
+	// its policies are added, DefaultWaitTimeout when zero.
+	WaitTimeout time.Duration
+
+	// Attempts is how many times the whole duplication is run before its
+	// error is returned, once when zero. See applyAttempts.
+	Attempts int
+
+	// Verify reads the target role back after writing it and fails when its
+	// trust policy, inline policies or managed policies differ from what
+	// was intended.
+	Verify bool
+
+	// Audit, when not nil, is told about the risky statements of the
+	// documents about to be copied, see AuditDocument. AuditStrict also
+	// refuses to copy them.
+	Audit       Audit
+	AuditStrict bool
+
+	// Warn, when not nil, is told about choices that are allowed but may
+	// surprise, such as copying a role under ServiceRolePath.
+	Warn func(message string)
+
+	// DryRun prints the changes to Out instead of applying them.
+	DryRun bool
+	Out    io.Writer
+
+	// Progress, when set, is told about each policy being written.
+	Progress Progress
+
+	// Confirm, when set, is called with a description of each role, user
+	// or group about to be written. Returning an error stops the run before
+	// anything is changed.
+	Confirm func(ctx context.Context, action string) error
+
+	// policies and sourcePolicies resolve policy names in the target and
+	// source accounts, listing their policies once per run.
+	policies       *PolicyResolver
+	sourcePolicies *PolicyResolver
+}
+
+// New returns a Duplicator that reads and writes through client.
+func New(client IAMClient) *Duplicator {
+	return &Duplicator{
+		Client: client,
+		Target: client,
+		Out:    os.Stdout,
+	}
+}
+
+// WithTarget returns a copy of the duplicator, with the same options,
+// writing through target instead of Target.
+func (d *Duplicator) WithTarget(target IAMClient) *Duplicator {
+	copied := *d
+	copied.Target = target
+	copied.policies = nil
+	return &copied
+}
+
+// Duplicate creates targetRoleName as a copy of sourceRoleName, including
+// its assume role policy document, inline policies and managed policies.
+// The result describes what was written, also when an error is returned.
+func (d *Duplicator) Duplicate(ctx context.Context, sourceRoleName string, targetRoleName string) (*Result, error) {
+	err := ValidateRoleName(targetRoleName)
+	if err != nil {
+		return nil, err
+	}
+
+	err = d.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot, err := d.Snapshot(ctx, sourceRoleName)
+	if err != nil {
+		return nil, err
+	}
+
+	if !d.FollowTrust {
+		return d.applyAttempts(ctx, snapshot, targetRoleName)
+	}
+
+	var trusted []*Result
+	err = d.followTrust(ctx, snapshot, make(map[string]string), &trusted)
+	if err != nil {
+		return &Result{RoleName: targetRoleName, DryRun: d.DryRun, TrustedRoles: trusted}, err
+	}
+
+	result, err := d.applyAttempts(ctx, snapshot, targetRoleName)
+	if result != nil {
+		result.TrustedRoles = trusted
+	}
+
+	return result, err
+}
+
+// Import creates targetRoleName from a snapshot previously written by
+// Export, without reading any live source role.
+func (d *Duplicator) Import(ctx context.Context, snapshot *Snapshot, targetRoleName string) (*Result, error) {
+	err := ValidateRoleName(targetRoleName)
+	if err != nil {
+		return nil, err
+	}
+
+	err = d.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	if snapshot.Version != SnapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %d, expected %d", snapshot.Version, SnapshotVersion)
+	}
+
+	return d.applyAttempts(ctx, snapshot, targetRoleName)
+}
+
+// Validate checks the duplicator's overrides without calling any API.
+func (d *Duplicator) Validate() error {
+	if d.Path != "" {
+		err := ValidatePath(d.Path)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(d.AssumeRolePolicyDocument) > 0 {
+		err := ValidateDocument(d.AssumeRolePolicyDocument)
+		if err != nil {
+			return fmt.Errorf("invalid assume role policy document, %w", err)
+		}
+	}
+
+	for _, principal := range d.AddTrustPrincipals {
+		err := ValidateTrustPrincipal(principal)
+		if err != nil {
+			return err
+		}
+	}
+
+	if d.MaxSessionDuration != 0 {
+		err := ValidateMaxSessionDuration(int(d.MaxSessionDuration))
+		if err != nil {
+			return err
+		}
+	}
+
+	if d.TargetPartition != "" {
+		err := ValidatePartition(d.TargetPartition)
+		if err != nil {
+			return err
+		}
+	}
+
+	if d.PermissionsBoundaryArn != "" {
+		if d.SkipBoundary {
+			return fmt.Errorf("a permissions boundary cannot be both skipped and set")
+		}
+
+		err := ValidatePolicyArn(d.PermissionsBoundaryArn)
+		if err != nil {
+			return fmt.Errorf("invalid permissions boundary, %w", err)
+		}
+	}
+
+	if d.PolicyNameTemplate != "" {
+		_, err := ParsePolicyNameTemplate(d.PolicyNameTemplate)
+		if err != nil {
+			return err
+		}
+	}
+
+	if d.ProtectPattern != "" {
+		err := ValidateProtectPattern(d.ProtectPattern)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := ValidatePatterns(d.IncludePolicies)
+	if err != nil {
+		return err
+	}
+
+	err = ValidateReplacements(d.Replacements)
+	if err != nil {
+		return err
+	}
+
+	err = ValidatePatterns(d.ExcludePolicies)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Snapshot reads roleName and its inline and managed policies through
+// Client.
+func (d *Duplicator) Snapshot(ctx context.Context, roleName string) (*Snapshot, error) {
+	snapshot, err := d.snapshotRole(ctx, d.Client, roleName)
+	if err != nil {
+		return nil, roleNotFound("source", roleName, err)
+	}
+
+	return snapshot, nil
+}
+
+// DefaultAttemptDelay is the pause before the second attempt of a
+// duplication, doubled before each following one.
+const DefaultAttemptDelay = time.Second
+
+// applyAttempts runs apply up to Attempts times. Once an attempt created
+// the target role, the following ones run in overwrite mode so that they
+// reconcile the role it left behind instead of failing because it exists.
+// A role that existed before the run is only overwritten with Overwrite.
+// Errors that another attempt cannot fix are returned right away.
+func (d *Duplicator) applyAttempts(ctx context.Context, snapshot *Snapshot, targetRoleName string) (*Result, error) {
+	result, err := d.apply(ctx, snapshot, targetRoleName)
+	if d.Attempts <= 1 {
+		return result, err
+	}
+
+	retry := *d
+	delay := DefaultAttemptDelay
+
+	for attempt := 2; attempt <= d.Attempts && err != nil && retryable(err); attempt++ {
+		if createdRole(result) {
+			retry.Overwrite = true
+		}
+
+		d.warn(fmt.Sprintf("attempt %d of %d failed, retrying in %s, %v", attempt-1, d.Attempts, delay, err))
+
+		select {
+		case <-ctx.Done():
+			return result, err
+		case <-time.After(delay):
+		}
+		delay *= 2
+
+		result, err = retry.apply(ctx, snapshot, targetRoleName)
+	}
+
+	return result, err
+}
+
+// createdRole reports whether the attempt described by result created the
+// target role and left it in place.
+func createdRole(result *Result) bool {
+	return result != nil && result.RoleArn != "" && !result.Updated && !result.RolledBack
+}
+
+// retryable reports whether running a failed duplication again may
+// succeed. An entity that already exists, such as a policy cloned by
+// CloneManagedPolicies, would already exist for the next attempt as well.
+func retryable(err error) bool {
+	switch {
+	case errors.Is(err, ErrRoleExists), errors.Is(err, ErrNotConfirmed), errors.Is(err, ErrServiceLinkedRole),
+		errors.Is(err, ErrAuditFailed), errors.Is(err, ErrRoleNotFound), errors.Is(err, ErrPolicyNotFound),
+		errors.Is(err, ErrProtectedRole),
+		errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return false
+	}
+
+	return !IsAccessDenied(err) && !IsEntityAlreadyExists(err)
+}
+
+// apply creates or, in overwrite mode, updates targetRoleName so that it
+// matches snapshot.
+func (d *Duplicator) apply(ctx context.Context, snapshot *Snapshot, targetRoleName string) (*Result, error) {
+	if IsServiceLinkedRole(snapshot.Path) {
+		return nil, fmt.Errorf("source role %s: %w", snapshot.RoleName, ErrServiceLinkedRole)
+	}
+
+	snapshot, err := d.inlineManagedPolicies(ctx, snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot, err = d.transform(ctx, snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	err = snapshot.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	err = d.audit(snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	if IsServiceRolePath(snapshot.Path) {
+		d.warn(fmt.Sprintf("role %s keeps the path %s, which the IAM console uses for the roles it creates for AWS services", targetRoleName, snapshot.Path))
+	}
+
+	var skipped []string
+	if d.SkipMissingPolicies {
+		skipped, err = d.skipMissingPolicies(ctx, snapshot)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Only the policies of the source role are cloned, not the extra ones
+	// already living in the target account.
+	sourceManagedPolicies := len(snapshot.ManagedPolicies)
+	err = d.addAttachPolicies(ctx, snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{
+		RoleName:               targetRoleName,
+		DryRun:                 d.DryRun,
+		SkippedManagedPolicies: skipped,
+	}
+
+	targetRole, err := GetRole(ctx, d.Target, targetRoleName)
+	if err != nil && !IsNoSuchEntity(err) {
+		return nil, fmt.Errorf("unable to check target role, %w", err)
+	}
+	targetExists := err == nil
+
+	if targetExists && !d.Overwrite {
+		return nil, fmt.Errorf("target role %s: %w", targetRoleName, ErrRoleExists)
+	}
+
+	if targetExists {
+		err = d.checkProtected(targetRoleName)
+		if err != nil {
+			return nil, err
+		}
+
+		result.RoleArn = *targetRole.Role.Arn
+		result.Updated = true
+	}
+
+	if d.DryRun {
+		if targetExists {
+			err = d.printUpdatePlan(ctx, snapshot, targetRoleName)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			d.printPlan(snapshot, targetRoleName)
+		}
+		result.setPlanned(snapshot)
+		return result, nil
+	}
+
+	action := "create role " + targetRoleName
+	if targetExists {
+		action = "update role " + targetRoleName
+	}
+
+	err = d.confirm(ctx, action)
+	if err != nil {
+		return nil, err
+	}
+
+	// The policies cloned in the target account are created through the
+	// recorder as well, so that a rollback deletes them.
+	rec := &recorder{IAMClient: d.Target}
+	err = d.clonePolicies(ctx, rec, snapshot, sourceManagedPolicies)
+	if err == nil && targetExists {
+		err = d.overwrite(ctx, rec, snapshot, targetRoleName)
+	} else if err == nil {
+		err = d.create(ctx, rec, snapshot, targetRoleName)
+	}
+	result.setWritten(rec)
+
+	if err != nil && d.RollbackOnError && !targetExists {
+		rollbackErr := rec.rollback(ctx)
+		if rollbackErr != nil {
+			return result, fmt.Errorf("%w (rollback failed, %v)", err, rollbackErr)
+		}
+		result.RolledBack = true
+		return result, fmt.Errorf("%w (rolled back)", err)
+	}
+
+	if err == nil && d.Verify {
+		err = d.verify(ctx, snapshot, targetRoleName)
+	}
+
+	return result, err
+}
+
+// verify compares targetRoleName, read through Target, with snapshot.
+func (d *Duplicator) verify(ctx context.Context, snapshot *Snapshot, targetRoleName string) error {
+	target, err := d.snapshotRole(ctx, d.Target, targetRoleName)
+	if err != nil {
+		return fmt.Errorf("unable to verify target role, %w", err)
+	}
+
+	differences, err := DiffSnapshots(snapshot, target)
+	if err != nil {
+		return fmt.Errorf("unable to verify target role, %w", err)
+	}
+
+	var mismatches []string
+	for _, difference := range differences {
+		// Tags are not updated in overwrite mode, they are synced on their
+		// own with SyncTags, and skipped policies are left as they were.
+		switch {
+		case difference.Kind == "tag":
+		case difference.Kind == "inline policy" && d.SkipInlinePolicies:
+		case difference.Kind == "managed policy" && d.SkipManagedPolicies:
+		default:
+			mismatches = append(mismatches, difference.String())
+		}
+	}
+
+	if len(mismatches) > 0 {
+		return fmt.Errorf("target role %s: %w: %s", targetRoleName, ErrVerificationFailed, strings.Join(mismatches, "; "))
+	}
+
+	return nil
+}
+
+// warn passes message to Warn when it is set.
+func (d *Duplicator) warn(message string) {
+	if d.Warn != nil {
+		d.Warn(message)
+	}
+}
+
+// confirm asks Confirm, when set, whether action may go ahead.
+func (d *Duplicator) confirm(ctx context.Context, action string) error {
+	if d.Confirm == nil {
+		return nil
+	}
+
+	return d.Confirm(ctx, action)
+}
+
+// addAttachPolicies adds AttachPolicies to the managed policies of
+// snapshot, resolving policy names in the target account.
+func (d *Duplicator) addAttachPolicies(ctx context.Context, snapshot *Snapshot) error {
+	for _, policy := range d.AttachPolicies {
+		policyName, policyArn := policy, policy
+		if strings.HasPrefix(policy, "arn:") {
+			policyName = policy[strings.LastIndex(policy, "/")+1:]
+		} else {
+			if d.policies == nil {
+				d.policies = &PolicyResolver{Client: d.Target}
+			}
+
+			var err error
+			policyArn, err = d.policies.Resolve(ctx, policy)
+			if err != nil {
+				return fmt.Errorf("unable to resolve managed policy, %w", err)
+			}
+		}
+
+		attached := false
+		for _, managedPolicy := range snapshot.ManagedPolicies {
+			if managedPolicy.Arn == policyArn {
+				attached = true
+			}
+		}
+
+		if !attached {
+			snapshot.ManagedPolicies = append(snapshot.ManagedPolicies, ManagedPolicy{Name: policyName, Arn: policyArn})
+		}
+	}
+
+	return nil
+}
+
+// sourcePolicyArn returns the ARN of the customer managed policy of the
+// source account given by name or ARN.
+func (d *Duplicator) sourcePolicyArn(ctx context.Context, policy string) (string, error) {
+	if strings.HasPrefix(policy, "arn:") {
+		return policy, nil
+	}
+
+	if d.sourcePolicies == nil {
+		d.sourcePolicies = &PolicyResolver{Client: d.Client}
+	}
+
+	return d.sourcePolicies.Resolve(ctx, policy)
+}
+
+// inlineManagedPolicies returns a copy of snapshot whose managed policies
+// listed in InlineManagedPolicies are replaced with inline policies holding
+// the document of their default version, read through Client. It runs
+// before transform, on the source role, so that the inlined documents get
+// the same overrides as the other inline policies. The snapshot itself is
+// left untouched.
+func (d *Duplicator) inlineManagedPolicies(ctx context.Context, snapshot *Snapshot) (*Snapshot, error) {
+	if len(d.InlineManagedPolicies) == 0 {
+		return snapshot, nil
+	}
+
+	inlined := *snapshot
+	inlined.InlinePolicies = append([]InlinePolicy(nil), snapshot.InlinePolicies...)
+	inlined.ManagedPolicies = append([]ManagedPolicy(nil), snapshot.ManagedPolicies...)
+	snapshot = &inlined
+
+	for _, name := range d.InlineManagedPolicies {
+		index := -1
+		for i, policy := range snapshot.ManagedPolicies {
+			if policy.Arn == name || policy.Name == name {
+				index = i
+				break
+			}
+		}
+
+		if index == -1 {
+			return nil, fmt.Errorf("managed policy %s to inline is not attached to role %s", name, snapshot.RoleName)
+		}
+
+		policy := snapshot.ManagedPolicies[index]
+		for _, inlinePolicy := range snapshot.InlinePolicies {
+			if inlinePolicy.Name == policy.Name {
+				return nil, fmt.Errorf("managed policy %s cannot be inlined, role %s already has an inline policy with this name", policy.Arn, snapshot.RoleName)
+			}
+		}
+
+		_, document, err := GetPolicyDocument(ctx, d.Client, policy.Arn, policy.VersionID)
+		if err != nil {
+			return nil, fmt.Errorf("unable to inline managed policy %s, %w", policy.Name, err)
+		}
+
+		snapshot.ManagedPolicies = append(snapshot.ManagedPolicies[:index], snapshot.ManagedPolicies[index+1:]...)
+		snapshot.InlinePolicies = append(snapshot.InlinePolicies, InlinePolicy{Name: policy.Name, Document: json.RawMessage(document)})
+	}
+
+	return snapshot, nil
+}
+
+// uniqueManagedPolicies returns policies without the repeated ARNs, keeping
+// the first occurrence of each.
+func uniqueManagedPolicies(policies []ManagedPolicy) []ManagedPolicy {
+	seen := make(map[string]bool, len(policies))
+	unique := policies[:0:0]
+	for _, policy := range policies {
+		if seen[policy.Arn] {
+			continue
+		}
+		seen[policy.Arn] = true
+		unique = append(unique, policy)
+	}
+
+	return unique
+}
+
+// clonePolicies recreates through client the permissions boundary of
+// snapshot with CopyBoundaryPolicy, and its first sourceManagedPolicies
+// managed policies with CloneManagedPolicies, pointing snapshot to the
+// copies. AWS managed policies are left as they are.
+func (d *Duplicator) clonePolicies(ctx context.Context, client IAMClient, snapshot *Snapshot, sourceManagedPolicies int) error {
+	if d.CopyBoundaryPolicy && d.PermissionsBoundaryArn == "" && snapshot.PermissionsBoundaryArn != "" && !IsAWSManagedPolicy(snapshot.PermissionsBoundaryArn) {
+		boundaryArn, err := d.clonePolicy(ctx, client, snapshot.PermissionsBoundaryArn, "")
+		if err != nil {
+			return fmt.Errorf("unable to copy permissions boundary, %w", err)
+		}
+		snapshot.PermissionsBoundaryArn = boundaryArn
+	}
+
+	if !d.CloneManagedPolicies {
+		return nil
+	}
+
+	for i, policy := range snapshot.ManagedPolicies[:sourceManagedPolicies] {
+		if IsAWSManagedPolicy(policy.Arn) {
+			continue
+		}
+
+		policyArn, err := d.clonePolicy(ctx, client, policy.Arn, policy.VersionID)
+		if err != nil {
+			return fmt.Errorf("unable to clone managed policy %s, %w", policy.Name, err)
+		}
+		snapshot.ManagedPolicies[i].Arn = policyArn
+	}
+
+	// An extra policy may name a copy that only exists now.
+	snapshot.ManagedPolicies = uniqueManagedPolicies(snapshot.ManagedPolicies)
+	return nil
+}
+
+// clonePolicy recreates the customer managed policy policy, given by name or
+// ARN, at version versionID or its default version, through target and
+// returns the ARN of the copy.
+func (d *Duplicator) clonePolicy(ctx context.Context, target IAMClient, policy string, versionID string) (string, error) {
+	policyArn, err := d.sourcePolicyArn(ctx, policy)
+	if err != nil {
+		return "", err
+	}
+
+	clonedArn, err := ClonePolicy(ctx, d.Client, target, policyArn, versionID)
+	if err != nil {
+		return "", err
+	}
+
+	if d.CloneAllPolicyVersions {
+		err = ClonePolicyVersions(ctx, d.Client, target, policyArn, clonedArn)
+		if err != nil {
+			return clonedArn, err
+		}
+	}
+
+	return clonedArn, nil
+}
+
+// snapshotRole reads a role and its inline and managed policies through
+// client.
+func (d *Duplicator) snapshotRole(ctx context.Context, client IAMClient, roleName string) (*Snapshot, error) {
+	snapshot, err := d.snapshotRoleWithoutInlinePolicies(ctx, client, roleName)
+	if err != nil {
+		return nil, err
+	}
+
+	inlinePolicies, err := GetInlinePolicies(ctx, client, roleName, d.Concurrency)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get inline policies, %w", err)
+	}
+
+	err = snapshot.addPolicies(inlinePolicies, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return snapshot, nil
+}
+
+// snapshotRoleWithoutInlinePolicies reads roleName through client like
+// snapshotRole, except for its inline policies.
+func (d *Duplicator) snapshotRoleWithoutInlinePolicies(ctx context.Context, client IAMClient, roleName string) (*Snapshot, error) {
+	snapshot, err := DescribeRole(ctx, client, roleName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get role %s, %w", roleName, err)
+	}
+
+	managedPolicies, err := GetManagedPolicies(ctx, client, roleName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get managed policies, %w", err)
+	}
+
+	err = snapshot.addPolicies(nil, managedPolicies)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.CopyInstanceProfile {
+		instanceProfiles, err := GetInstanceProfiles(ctx, client, roleName)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get instance profiles, %w", err)
+		}
+
+		for _, instanceProfile := range instanceProfiles {
+			snapshot.InstanceProfiles = append(snapshot.InstanceProfiles, *instanceProfile.InstanceProfileName)
+		}
+	}
+
+	return snapshot, nil
+}
+
+// create writes a new target role through client.
+func (d *Duplicator) create(ctx context.Context, client IAMClient, snapshot *Snapshot, targetRoleName string) error {
+	err := CreateRole(ctx, client, snapshot, targetRoleName)
+	if err != nil {
+		return fmt.Errorf("unable to create role, %w", err)
+	}
+
+	err = WaitRoleExists(ctx, client, targetRoleName, d.WaitTimeout)
+	if err != nil {
+		return err
+	}
+
+	if len(snapshot.InlinePolicies) > 0 {
+		err = AddInlinePolicies(ctx, client, targetRoleName, snapshot.InlinePolicies, d.Progress)
+		if err != nil {
+			return fmt.Errorf("unable to add inline policies, %w", err)
+		}
+	}
+
+	if len(snapshot.ManagedPolicies) > 0 {
+		err = AddManagedPolicies(ctx, client, targetRoleName, snapshot.ManagedPolicies, d.Concurrency, d.Progress)
+		if err != nil {
+			return fmt.Errorf("unable to add managed policies, %w", err)
+		}
+	}
+
+	if d.CopyInstanceProfile {
+		err = d.copyInstanceProfile(ctx, client, snapshot, targetRoleName)
+		if err != nil {
+			return fmt.Errorf("unable to copy instance profile, %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (d *Duplicator) printPlan(snapshot *Snapshot, targetRoleName string) {
+	fmt.Fprintf(d.Out, "[dry-run] create role %s\n", targetRoleName)
+
+	fmt.Fprintf(d.Out, "[dry-run]   assume role policy document: %s\n", snapshot.AssumeRolePolicyDocument)
+	if snapshot.PermissionsBoundaryArn != "" && d.CopyBoundaryPolicy && !IsAWSManagedPolicy(snapshot.PermissionsBoundaryArn) {
+		fmt.Fprintf(d.Out, "[dry-run]   copy permissions boundary policy %s\n", snapshot.PermissionsBoundaryArn)
+	} else if snapshot.PermissionsBoundaryArn != "" {
+		fmt.Fprintf(d.Out, "[dry-run]   permissions boundary: %s\n", snapshot.PermissionsBoundaryArn)
+	}
+
+	for _, policy := range snapshot.InlinePolicies {
+		fmt.Fprintf(d.Out, "[dry-run]   put inline policy %s (%d bytes)\n", policy.Name, len(policy.Document))
+	}
+
+	for _, policy := range snapshot.ManagedPolicies {
+		if d.CloneManagedPolicies && !IsAWSManagedPolicy(policy.Arn) {
+			fmt.Fprintf(d.Out, "[dry-run]   clone and attach managed policy %s\n", policy.Arn)
+		} else {
+			fmt.Fprintf(d.Out, "[dry-run]   attach managed policy %s\n", policy.Arn)
+		}
+	}
+
+	if d.CopyInstanceProfile && len(snapshot.InstanceProfiles) > 0 {
+		fmt.Fprintf(d.Out, "[dry-run]   add to instance profile %s\n", d.instanceProfileName(targetRoleName))
+	}
+}
+
+// printUpdatePlan compares snapshot with the existing role targetRoleName
+// and prints only what overwriting it would change.
+func (d *Duplicator) printUpdatePlan(ctx context.Context, snapshot *Snapshot, targetRoleName string) error {
+	target, err := d.snapshotRole(ctx, d.Target, targetRoleName)
+	if err != nil {
+		return fmt.Errorf("unable to read target role, %w", err)
+	}
+
+	differences, err := DiffSnapshots(snapshot, target)
+	if err != nil {
+		return err
+	}
+
+	inlineSizes := make(map[string]int, len(snapshot.InlinePolicies))
+	for _, policy := range snapshot.InlinePolicies {
+		inlineSizes[policy.Name] = len(policy.Document)
+	}
+
+	fmt.Fprintf(d.Out, "[dry-run] update existing role %s\n", targetRoleName)
+
+	changes := 0
+	for _, difference := range differences {
+		switch {
+		case difference.Kind == "assume role policy document":
+			fmt.Fprintf(d.Out, "[dry-run]   update assume role policy document: %s\n", snapshot.AssumeRolePolicyDocument)
+		case difference.Kind == "inline policy" && d.SkipInlinePolicies:
+			continue
+		case difference.Kind == "inline policy" && difference.Change == "only in source":
+			fmt.Fprintf(d.Out, "[dry-run]   put inline policy %s (%d bytes)\n", difference.Name, inlineSizes[difference.Name])
+		case difference.Kind == "inline policy" && difference.Change == "differs":
+			fmt.Fprintf(d.Out, "[dry-run]   update inline policy %s (%d bytes)\n", difference.Name, inlineSizes[difference.Name])
+		case difference.Kind == "inline policy":
+			fmt.Fprintf(d.Out, "[dry-run]   delete inline policy %s\n", difference.Name)
+		case difference.Kind == "managed policy" && d.SkipManagedPolicies:
+			continue
+		case difference.Kind == "managed policy" && difference.Change == "only in source" && d.CloneManagedPolicies && !IsAWSManagedPolicy(difference.Name):
+			fmt.Fprintf(d.Out, "[dry-run]   clone and attach managed policy %s\n", difference.Name)
+		case difference.Kind == "managed policy" && difference.Change == "only in source":
+			fmt.Fprintf(d.Out, "[dry-run]   attach managed policy %s\n", difference.Name)
+		case difference.Kind == "managed policy":
+			fmt.Fprintf(d.Out, "[dry-run]   detach managed policy %s\n", difference.Name)
+		case difference.Kind == "tag":
+			// Tags are not written in overwrite mode, see SyncTags.
+			fmt.Fprintf(d.Out, "[dry-run]   tag %s %s, left as is in overwrite mode\n", difference.Name, difference.Change)
+			continue
+		}
+		changes++
+	}
+
+	if d.CopyInstanceProfile && len(snapshot.InstanceProfiles) > 0 {
+		fmt.Fprintf(d.Out, "[dry-run]   add to instance profile %s\n", d.instanceProfileName(targetRoleName))
+		changes++
+	}
+
+	if changes == 0 {
+		fmt.Fprintf(d.Out, "[dry-run]   no changes\n")
+	}
+
+	return nil
+}
@@ -0,0 +1,456 @@
+package iamdup
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/aws/smithy-go"
+)
+
+const testTrust = `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"Service":"ec2.amazonaws.com"},"Action":"sts:AssumeRole"}]}`
+
+const testDocument = `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:GetObject","Resource":"*"}]}`
+
+func TestDuplicateCalls(t *testing.T) {
+	client := newFakeIAM("111111111111")
+	source := client.addRole("app", testTrust)
+	source.putInline("read", testDocument)
+	source.putInline("write", testDocument)
+	source.attach("ReadOnlyAccess", "arn:aws:iam::aws:policy/ReadOnlyAccess")
+
+	d := New(client)
+	d.Concurrency = 1
+
+	_, err := d.Duplicate(context.Background(), "app", "app-copy")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"GetRole app",
+		"ListAttachedRolePolicies app",
+		"ListRolePolicies app",
+		"GetRolePolicy app/read",
+		"GetRolePolicy app/write",
+		"GetRole app-copy",
+		"CreateRole app-copy",
+		"GetRole app-copy",
+		"PutRolePolicy app-copy/read",
+		"PutRolePolicy app-copy/write",
+		"AttachRolePolicy app-copy arn:aws:iam::aws:policy/ReadOnlyAccess",
+	}
+	if !reflect.DeepEqual(client.calls, want) {
+		t.Errorf("calls = %q, want %q", client.calls, want)
+	}
+}
+
+func TestDuplicateDecodesInlinePolicies(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+	}{
+		{"compact", testDocument},
+		{"white space", `{ "Version": "2012-10-17", "Statement": [ { "Effect": "Allow", "Action": "s3:*", "Resource": "*" } ] }`},
+		{"reserved characters", `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:GetObject","Resource":"arn:aws:s3:::bucket/a+b?c=d&e#f%g"}]}`},
+		{"non-ASCII", `{"Version":"2012-10-17","Statement":[{"Sid":"Lecture","Effect":"Allow","Action":"s3:GetObject","Resource":"arn:aws:s3:::données/*"}]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newFakeIAM("111111111111")
+			client.addRole("app", testTrust).putInline("policy", tt.document)
+
+			_, err := New(client).Duplicate(context.Background(), "app", "app-copy")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := client.roles["app-copy"].inline["policy"]
+			if got != tt.document {
+				t.Errorf("PolicyDocument = %s, want %s", got, tt.document)
+			}
+		})
+	}
+}
+
+func TestApplyAttemptsReconcilesFailedAttempt(t *testing.T) {
+	client := newFakeIAM("111111111111")
+	source := client.addRole("app", testTrust)
+	source.putInline("read", testDocument)
+
+	failed := false
+	client.fail = func(op string, name string) error {
+		if op == "PutRolePolicy" && !failed {
+			failed = true
+			return &smithy.GenericAPIError{Code: "ServiceFailure"}
+		}
+		return nil
+	}
+
+	d := New(client)
+	d.Attempts = 2
+
+	result, err := d.Duplicate(context.Background(), "app", "app-copy")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !result.Updated {
+		t.Error("second attempt did not update the role created by the first one")
+	}
+
+	if got := client.inlineNames("app-copy"); !reflect.DeepEqual(got, []string{"read"}) {
+		t.Errorf("inline policies = %q, want read", got)
+	}
+}
+
+func TestApplyAttemptsKeepsExistingTarget(t *testing.T) {
+	client := newFakeIAM("111111111111")
+	client.addRole("app", testTrust)
+	client.addRole("app-copy", testTrust).putInline("existing", testDocument)
+
+	throttled := false
+	client.fail = func(op string, name string) error {
+		if op == "GetRole" && name == "app-copy" && !throttled {
+			throttled = true
+			return &smithy.GenericAPIError{Code: "Throttling"}
+		}
+		return nil
+	}
+
+	d := New(client)
+	d.Attempts = 2
+
+	_, err := d.Duplicate(context.Background(), "app", "app-copy")
+	if !errors.Is(err, ErrRoleExists) {
+		t.Errorf("err = %v, want %v", err, ErrRoleExists)
+	}
+
+	if got := client.callsTo("UpdateAssumeRolePolicy"); len(got) > 0 {
+		t.Errorf("existing target role was overwritten")
+	}
+
+	if got := client.inlineNames("app-copy"); !reflect.DeepEqual(got, []string{"existing"}) {
+		t.Errorf("inline policies = %q, want existing", got)
+	}
+}
+
+func TestDuplicateInlinesManagedPolicy(t *testing.T) {
+	client := newFakeIAM("111111111111")
+	policyArn := client.addPolicy("shared", testDocument)
+	client.addRole("app", testTrust).attach("shared", policyArn)
+
+	d := New(client)
+	d.InlineManagedPolicies = []string{"shared"}
+	d.Replacements = []Replacement{{Old: "s3:GetObject", New: "s3:PutObject"}}
+
+	_, err := d.Duplicate(context.Background(), "app", "app-copy")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The inlined document gets the overrides of the other inline policies.
+	want := strings.ReplaceAll(testDocument, "s3:GetObject", "s3:PutObject")
+	target := client.roles["app-copy"]
+	if got := target.inline["shared"]; got != want {
+		t.Errorf("inline policy shared = %s, want %s", got, want)
+	}
+	if len(target.attached) != 0 {
+		t.Errorf("attached policies = %v, want none", client.attachedArns("app-copy"))
+	}
+}
+
+func TestDryRunMakesNoWrites(t *testing.T) {
+	tests := []struct {
+		name      string
+		overwrite bool
+	}{
+		{"create", false},
+		{"overwrite", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newFakeIAM("111111111111")
+			source := client.addRole("app", testTrust)
+			source.putInline("read", testDocument)
+			source.attach("ReadOnlyAccess", "arn:aws:iam::aws:policy/ReadOnlyAccess")
+			if tt.overwrite {
+				client.addRole("app-copy", testTrust).putInline("stale", testDocument)
+			}
+
+			var out bytes.Buffer
+			d := New(client)
+			d.DryRun = true
+			d.Overwrite = tt.overwrite
+			d.Out = &out
+
+			result, err := d.Duplicate(context.Background(), "app", "app-copy")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !result.DryRun || !strings.Contains(out.String(), "[dry-run]") {
+				t.Errorf("dry run not reported, result %+v, output %q", result, out.String())
+			}
+
+			for _, call := range client.calls {
+				for _, prefix := range []string{"Create", "Put", "Attach", "Tag", "Untag", "Delete", "Detach", "Update"} {
+					if strings.HasPrefix(call, prefix) {
+						t.Errorf("mutating call %s made in a dry run", call)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestDuplicateRefusesServiceLinkedRole(t *testing.T) {
+	client := newFakeIAM("111111111111")
+	source := client.addRole("AWSServiceRoleForAutoScaling", testTrust)
+	source.role.Path = aws.String("/aws-service-role/autoscaling.amazonaws.com/")
+
+	_, err := New(client).Duplicate(context.Background(), "AWSServiceRoleForAutoScaling", "app-copy")
+	if !errors.Is(err, ErrServiceLinkedRole) {
+		t.Fatalf("Duplicate error = %v, want ErrServiceLinkedRole", err)
+	}
+
+	if got := client.callsTo("CreateRole"); len(got) != 0 {
+		t.Errorf("CreateRole called for %q, want no call", got)
+	}
+}
+
+func TestDuplicateSkipsPolicies(t *testing.T) {
+	tests := []struct {
+		name        string
+		skipInline  bool
+		skipManaged bool
+		wantInline  []string
+		wantManaged []string
+	}{
+		{"copy both", false, false, []string{"read"}, []string{"arn:aws:iam::aws:policy/ReadOnlyAccess"}},
+		{"no inline", true, false, nil, []string{"arn:aws:iam::aws:policy/ReadOnlyAccess"}},
+		{"no managed", false, true, []string{"read"}, nil},
+		{"neither", true, true, nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newFakeIAM("111111111111")
+			source := client.addRole("app", testTrust)
+			source.putInline("read", testDocument)
+			source.attach("ReadOnlyAccess", "arn:aws:iam::aws:policy/ReadOnlyAccess")
+
+			d := New(client)
+			d.SkipInlinePolicies = tt.skipInline
+			d.SkipManagedPolicies = tt.skipManaged
+
+			_, err := d.Duplicate(context.Background(), "app", "app-copy")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := client.inlineNames("app-copy"); !reflect.DeepEqual(got, tt.wantInline) {
+				t.Errorf("inline policies = %q, want %q", got, tt.wantInline)
+			}
+			if got := client.attachedArns("app-copy"); !reflect.DeepEqual(got, tt.wantManaged) {
+				t.Errorf("attached policies = %q, want %q", got, tt.wantManaged)
+			}
+			if tt.skipInline && len(client.callsTo("PutRolePolicy")) != 0 || tt.skipManaged && len(client.callsTo("AttachRolePolicy")) != 0 {
+				t.Errorf("skipped policies were written, calls %q", client.calls)
+			}
+		})
+	}
+}
+
+func TestDuplicatePolicyResolvesName(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  string
+		wantErr error
+	}{
+		{"found", "app-read", nil},
+		{"not found", "missing", ErrPolicyNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newFakeIAM("111111111111")
+			client.addPolicy("app-read", testDocument)
+
+			policyArn, err := New(client).DuplicatePolicy(context.Background(), tt.policy, "app-read-copy")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("DuplicatePolicy error = %v, want %v", err, tt.wantErr)
+			}
+
+			wantArn := ""
+			if tt.wantErr == nil {
+				wantArn = "arn:aws:iam::111111111111:policy/app-read-copy"
+			}
+			if policyArn != wantArn {
+				t.Errorf("DuplicatePolicy = %q, want %q", policyArn, wantArn)
+			}
+			if got := client.callsTo("ListPolicies"); len(got) != 1 {
+				t.Errorf("ListPolicies called for %q, want one call", got)
+			}
+		})
+	}
+}
+
+func TestDuplicatePermissionsBoundary(t *testing.T) {
+	tests := []struct {
+		name         string
+		skipBoundary bool
+		override     string
+		want         string
+	}{
+		{name: "copied", want: "arn:aws:iam::111111111111:policy/boundary"},
+		{name: "no boundary", skipBoundary: true},
+		{name: "override", override: "arn:aws:iam::aws:policy/PowerUserAccess", want: "arn:aws:iam::aws:policy/PowerUserAccess"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newFakeIAM("111111111111")
+			boundaryArn := client.addPolicy("boundary", testDocument)
+			source := client.addRole("app", testTrust)
+			source.role.PermissionsBoundary = &types.AttachedPermissionsBoundary{PermissionsBoundaryArn: aws.String(boundaryArn)}
+
+			d := New(client)
+			d.SkipBoundary = tt.skipBoundary
+			d.PermissionsBoundaryArn = tt.override
+
+			_, err := d.Duplicate(context.Background(), "app", "app-copy")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The fake only sets the boundary from the CreateRoleInput.
+			var got string
+			if boundary := client.roles["app-copy"].role.PermissionsBoundary; boundary != nil {
+				got = *boundary.PermissionsBoundaryArn
+			}
+			if got != tt.want {
+				t.Errorf("permissions boundary = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOnlyTrustPolicyCallsCreateRoleOnly(t *testing.T) {
+	fileTrust := `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"AWS":"arn:aws:iam::222222222222:root"},"Action":"sts:AssumeRole"}]}`
+
+	tests := []struct {
+		name      string
+		trust     string
+		wantTrust string
+	}{
+		{"copied trust", "", testTrust},
+		{"file trust", fileTrust, fileTrust},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newFakeIAM("111111111111")
+			source := client.addRole("app", testTrust)
+			source.putInline("read", testDocument)
+			source.attach("ReadOnlyAccess", "arn:aws:iam::aws:policy/ReadOnlyAccess")
+
+			// The -only-trust-policy flag sets both.
+			d := New(client)
+			d.SkipInlinePolicies = true
+			d.SkipManagedPolicies = true
+			d.AssumeRolePolicyDocument = json.RawMessage(tt.trust)
+
+			_, err := d.Duplicate(context.Background(), "app", "app-copy")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var writes []string
+			for _, call := range client.calls {
+				for _, prefix := range []string{"Create", "Put", "Attach", "Tag", "Untag", "Delete", "Detach", "Update"} {
+					if strings.HasPrefix(call, prefix) {
+						writes = append(writes, call)
+					}
+				}
+			}
+			if want := []string{"CreateRole app-copy"}; !reflect.DeepEqual(writes, want) {
+				t.Errorf("mutating calls = %q, want %q", writes, want)
+			}
+
+			document, err := url.PathUnescape(*client.roles["app-copy"].role.AssumeRolePolicyDocument)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if equal, err := EqualDocuments(json.RawMessage(document), json.RawMessage(tt.wantTrust)); err != nil || !equal {
+				t.Errorf("assume role policy document = %s, want %s", document, tt.wantTrust)
+			}
+		})
+	}
+}
+
+func TestProvenanceTagsOnCreateRole(t *testing.T) {
+	client := newFakeIAM("111111111111")
+	client.addRole("app", testTrust).role.Tags = fromTags([]Tag{{Key: "team", Value: "core"}, {Key: "CopiedFrom", Value: "older"}})
+
+	d := New(client)
+	d.ProvenanceTags = true
+	d.SetTags = []Tag{{Key: "env", Value: "staging"}}
+
+	before := time.Now().UTC().Truncate(time.Second)
+	_, err := d.Duplicate(context.Background(), "app", "app-copy")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tags := toTags(client.roles["app-copy"].role.Tags)
+	if len(tags) != 4 {
+		t.Fatalf("CreateRole tags = %v, want team, CopiedFrom, CopiedAt and env", tags)
+	}
+
+	if want := []Tag{{Key: "team", Value: "core"}, {Key: "CopiedFrom", Value: "app"}}; !reflect.DeepEqual(tags[:2], want) {
+		t.Errorf("CreateRole tags = %v, want %v first", tags, want)
+	}
+
+	copiedAt, err := time.Parse(time.RFC3339, tags[2].Value)
+	if tags[2].Key != "CopiedAt" || err != nil || copiedAt.Before(before) || copiedAt.After(time.Now()) {
+		t.Errorf("CreateRole tag %v, want CopiedAt with the time of the copy", tags[2])
+	}
+
+	if want := (Tag{Key: "env", Value: "staging"}); tags[3] != want {
+		t.Errorf("CreateRole tag %v, want %v", tags[3], want)
+	}
+}
+
+func TestAttachPoliciesAddsExtraPolicies(t *testing.T) {
+	client := newFakeIAM("111111111111")
+	loggingArn := client.addPolicy("logging", testDocument)
+	source := client.addRole("app", testTrust)
+	source.attach("ReadOnlyAccess", "arn:aws:iam::aws:policy/ReadOnlyAccess")
+
+	d := New(client)
+	d.AttachPolicies = []string{"logging", "arn:aws:iam::aws:policy/ReadOnlyAccess", loggingArn, "arn:aws:iam::aws:policy/AmazonSQSReadOnlyAccess"}
+
+	_, err := d.Duplicate(context.Background(), "app", "app-copy")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{loggingArn, "arn:aws:iam::aws:policy/AmazonSQSReadOnlyAccess", "arn:aws:iam::aws:policy/ReadOnlyAccess"}
+	if got := client.attachedArns("app-copy"); !reflect.DeepEqual(got, want) {
+		t.Errorf("attached policies = %q, want %q", got, want)
+	}
+	if got := client.callsTo("AttachRolePolicy"); len(got) != len(want) {
+		t.Errorf("AttachRolePolicy called for %q, want each policy attached once", got)
+	}
+}
@@ -0,0 +1,137 @@
+package iamdup
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/aws/smithy-go"
+)
+
+// ErrRoleExists is returned when the target role already exists and the
+// duplicator is not allowed to overwrite it.
+var ErrRoleExists = errors.New("role already exists")
+
+// ErrRoleNotFound is returned when the source role, or a target role that
+// must already exist, does not exist.
+var ErrRoleNotFound = errors.New("role not found")
+
+// ErrVerificationFailed is returned when the target role read back after
+// writing it does not match what was intended.
+var ErrVerificationFailed = errors.New("verification failed")
+
+// ErrNotConfirmed is returned by a Confirm function when the user declined
+// the change.
+var ErrNotConfirmed = errors.New("not confirmed")
+
+// ErrPolicyNotFound is returned when a managed policy name does not match
+// any customer managed policy of the account.
+var ErrPolicyNotFound = errors.New("no customer managed policy with this name")
+
+// ErrServiceLinkedRole is returned when the source role is service-linked.
+// Such roles are created by the AWS service that owns them, through
+// CreateServiceLinkedRole, and cannot be copied with CreateRole.
+var ErrServiceLinkedRole = errors.New("service-linked roles cannot be duplicated, they are created by their AWS service with iam create-service-linked-role")
+
+// OpError describes a failed IAM API call, naming the operation and the
+// role, user or group and policy it was made for. The SDK error is kept as
+// Err so that errors.Is and errors.As still see it.
+type OpError struct {
+	Op         string
+	RoleName   string
+	UserName   string
+	GroupName  string
+	PolicyName string
+	Err        error
+}
+
+func (e *OpError) Error() string {
+	var msg strings.Builder
+
+	msg.WriteString(e.Op + " failed")
+	sep := " for "
+	for _, entity := range []struct{ kind, name string }{
+		{"role", e.RoleName},
+		{"group", e.GroupName},
+		{"user", e.UserName},
+		{"policy", e.PolicyName},
+	} {
+		if entity.name != "" {
+			msg.WriteString(sep + entity.kind + " " + entity.name)
+			sep = " "
+		}
+	}
+	msg.WriteString(", " + e.Err.Error())
+
+	return msg.String()
+}
+
+func (e *OpError) Unwrap() error {
+	return e.Err
+}
+
+// RequestID returns the AWS request ID of the failed call, see RequestID.
+func (e *OpError) RequestID() string {
+	return RequestID(e.Err)
+}
+
+// RequestID returns the AWS request ID of the call that caused err, to be
+// quoted in support cases, or an empty string when err does not carry one.
+func RequestID(err error) string {
+	var responseErr interface{ ServiceRequestID() string }
+	if errors.As(err, &responseErr) {
+		return responseErr.ServiceRequestID()
+	}
+
+	return ""
+}
+
+// IsNoSuchEntity reports whether err was caused by a missing IAM entity.
+func IsNoSuchEntity(err error) bool {
+	var noSuchEntity *types.NoSuchEntityException
+	return errors.As(err, &noSuchEntity)
+}
+
+// roleNotFound replaces err by ErrRoleNotFound, naming which of the source
+// or target roleName is, when err was caused by the role not existing.
+func roleNotFound(kind string, roleName string, err error) error {
+	if IsNoSuchEntity(err) {
+		if requestID := RequestID(err); requestID != "" {
+			return fmt.Errorf("%s role %s: %w (request ID %s)", kind, roleName, ErrRoleNotFound, requestID)
+		}
+		return fmt.Errorf("%s role %s: %w", kind, roleName, ErrRoleNotFound)
+	}
+
+	return err
+}
+
+// IsEntityAlreadyExists reports whether err was caused by an IAM entity
+// that already exists.
+func IsEntityAlreadyExists(err error) bool {
+	var alreadyExists *types.EntityAlreadyExistsException
+	return errors.As(err, &alreadyExists)
+}
+
+// IsLimitExceeded reports whether err was caused by an IAM quota, such as
+// the number of managed policies attached to a role.
+func IsLimitExceeded(err error) bool {
+	var limitExceeded *types.LimitExceededException
+	return errors.As(err, &limitExceeded)
+}
+
+// IsAccessDenied reports whether err was caused by missing permissions.
+// IAM has no modeled type for it, so the API error code is checked.
+func IsAccessDenied(err error) bool {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+
+	switch apiErr.ErrorCode() {
+	case "AccessDenied", "AccessDeniedException", "UnauthorizedOperation":
+		return true
+	}
+
+	return false
+}
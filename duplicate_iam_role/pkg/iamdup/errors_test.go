@@ -0,0 +1,77 @@
+package iamdup
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+func TestOpError(t *testing.T) {
+	denied := &smithy.GenericAPIError{Code: "AccessDenied", Message: "not allowed"}
+
+	tests := []struct {
+		err    *OpError
+		want   string
+		action string
+	}{
+		{&OpError{Op: "GetRole", RoleName: "app", Err: denied}, "GetRole failed for role app, api error AccessDenied: not allowed", "iam:GetRole"},
+		{&OpError{Op: "PutUserPolicy", UserName: "alice", PolicyName: "read", Err: denied}, "PutUserPolicy failed for user alice policy read, api error AccessDenied: not allowed", "iam:PutUserPolicy"},
+		{&OpError{Op: "AddUserToGroup", GroupName: "admins", UserName: "alice", Err: denied}, "AddUserToGroup failed for group admins user alice, api error AccessDenied: not allowed", "iam:AddUserToGroup"},
+		{&OpError{Op: "GetPolicy", PolicyName: "arn:aws:iam::aws:policy/ReadOnlyAccess", Err: errors.New("failure")}, "GetPolicy failed for policy arn:aws:iam::aws:policy/ReadOnlyAccess, failure", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.err.Op, func(t *testing.T) {
+			if got := tt.err.Error(); got != tt.want {
+				t.Errorf("Error() = %q, want %q", got, tt.want)
+			}
+
+			if got := DeniedAction(errors.Join(errors.New("other"), tt.err)); got != tt.action {
+				t.Errorf("DeniedAction() = %q, want %q", got, tt.action)
+			}
+		})
+	}
+}
+
+// apiError builds err as the SDK returns it for a failed op, with requestID.
+func apiError(op string, requestID string, err error) error {
+	return &smithy.OperationError{
+		ServiceID:     "IAM",
+		OperationName: op,
+		Err: &awshttp.ResponseError{
+			ResponseError: &smithyhttp.ResponseError{
+				Response: &smithyhttp.Response{Response: &http.Response{StatusCode: http.StatusNotFound}},
+				Err:      err,
+			},
+			RequestID: requestID,
+		},
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	notFound := &types.NoSuchEntityException{Message: aws.String("role app not found")}
+
+	err := &OpError{Op: "GetRole", RoleName: "app", Err: apiError("GetRole", "req-1234", notFound)}
+	if got := err.RequestID(); got != "req-1234" {
+		t.Errorf("OpError.RequestID() = %q, want req-1234", got)
+	}
+	if got := RequestID(fmt.Errorf("unable to get role, %w", err)); got != "req-1234" {
+		t.Errorf("RequestID() of a wrapped error = %q, want req-1234", got)
+	}
+	if got := RequestID(errors.New("failure")); got != "" {
+		t.Errorf("RequestID() without response = %q, want none", got)
+	}
+
+	described := roleNotFound("source", "app", err)
+	if !errors.Is(described, ErrRoleNotFound) || !strings.Contains(described.Error(), "(request ID req-1234)") {
+		t.Errorf("roleNotFound() = %v, want ErrRoleNotFound with the request ID", described)
+	}
+}
@@ -0,0 +1,653 @@
+package iamdup
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+// fakeIAM is an in-memory IAMClient holding the roles and managed policies
+// of one account. The calls the tests do not need are left to the nil
+// embedded interface and panic.
+type fakeIAM struct {
+	IAMClient
+
+	account string
+
+	// pageSize splits the role policy and policy tag listings in pages of
+	// that many items when set. truncateWithoutMarker makes their first
+	// page claim to be truncated without giving a marker.
+	pageSize              int
+	truncateWithoutMarker bool
+
+	// fail, when set, is called before every call with its operation and
+	// the role or policy it is made for. The call returns the error
+	// instead when it is not nil.
+	fail func(op string, name string) error
+
+	// delay is how long each GetRolePolicy call takes. peak is the largest
+	// number of them seen running at once.
+	delay    time.Duration
+	inFlight int
+	peak     int
+
+	mu       sync.Mutex
+	calls    []string
+	roles    map[string]*fakeRole
+	policies map[string]*fakePolicy
+}
+
+type fakeRole struct {
+	role     types.Role
+	inline   map[string]string
+	order    []string
+	attached []types.AttachedPolicy
+}
+
+type fakePolicy struct {
+	policy   types.Policy
+	document string
+	tags     []types.Tag
+}
+
+func newFakeIAM(account string) *fakeIAM {
+	return &fakeIAM{
+		account:  account,
+		roles:    make(map[string]*fakeRole),
+		policies: make(map[string]*fakePolicy),
+	}
+}
+
+// addRole adds roleName with the assume role policy document trust.
+func (f *fakeIAM) addRole(roleName string, trust string) *fakeRole {
+	role := &fakeRole{
+		role: types.Role{
+			RoleName:                 aws.String(roleName),
+			Arn:                      aws.String(f.roleArn(roleName)),
+			Path:                     aws.String("/"),
+			AssumeRolePolicyDocument: aws.String(url.PathEscape(trust)),
+		},
+		inline: make(map[string]string),
+	}
+	f.roles[roleName] = role
+	return role
+}
+
+// addPolicy adds the customer managed policy policyName with document and
+// returns its ARN.
+func (f *fakeIAM) addPolicy(policyName string, document string) string {
+	policyArn := fmt.Sprintf("arn:aws:iam::%s:policy/%s", f.account, policyName)
+	f.policies[policyArn] = &fakePolicy{
+		policy: types.Policy{
+			PolicyName:       aws.String(policyName),
+			Arn:              aws.String(policyArn),
+			Path:             aws.String("/"),
+			DefaultVersionId: aws.String("v1"),
+		},
+		document: document,
+	}
+	return policyArn
+}
+
+func (f *fakeIAM) roleArn(roleName string) string {
+	return fmt.Sprintf("arn:aws:iam::%s:role/%s", f.account, roleName)
+}
+
+// putInline adds the inline policy policyName to the role, in the order
+// ListRolePolicies returns them.
+func (r *fakeRole) putInline(policyName string, document string) {
+	if _, ok := r.inline[policyName]; !ok {
+		r.order = append(r.order, policyName)
+	}
+	r.inline[policyName] = document
+}
+
+func (r *fakeRole) attach(policyName string, policyArn string) {
+	r.attached = append(r.attached, types.AttachedPolicy{PolicyName: aws.String(policyName), PolicyArn: aws.String(policyArn)})
+}
+
+// call records op for name and returns the error of ctx or of fail, if
+// any, as the SDK fails right away once ctx is done.
+func (f *fakeIAM) call(ctx context.Context, op string, name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls = append(f.calls, op+" "+name)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if f.fail != nil {
+		return f.fail(op, name)
+	}
+
+	return nil
+}
+
+// callsTo returns the recorded calls of op, without their operation.
+func (f *fakeIAM) callsTo(op string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var names []string
+	for _, call := range f.calls {
+		if strings.HasPrefix(call, op+" ") {
+			names = append(names, strings.TrimPrefix(call, op+" "))
+		}
+	}
+
+	return names
+}
+
+// page returns the bounds of the page of n items starting at marker, and
+// the marker of the next page.
+func (f *fakeIAM) page(n int, marker *string) (int, int, *string, bool) {
+	start := 0
+	if marker != nil {
+		start, _ = strconv.Atoi(*marker)
+	}
+
+	if f.pageSize == 0 || start+f.pageSize >= n {
+		return start, n, nil, false
+	}
+
+	end := start + f.pageSize
+	if f.truncateWithoutMarker {
+		return start, end, nil, true
+	}
+
+	return start, end, aws.String(strconv.Itoa(end)), true
+}
+
+func (f *fakeIAM) role(roleName string) (*fakeRole, error) {
+	role, ok := f.roles[roleName]
+	if !ok {
+		return nil, &types.NoSuchEntityException{Message: aws.String("role " + roleName + " not found")}
+	}
+
+	return role, nil
+}
+
+func (f *fakeIAM) policy(policyArn string) (*fakePolicy, error) {
+	policy, ok := f.policies[policyArn]
+	if !ok {
+		return nil, &types.NoSuchEntityException{Message: aws.String("policy " + policyArn + " not found")}
+	}
+
+	return policy, nil
+}
+
+func (f *fakeIAM) GetRole(ctx context.Context, params *iam.GetRoleInput, optFns ...func(*iam.Options)) (*iam.GetRoleOutput, error) {
+	if err := f.call(ctx, "GetRole", *params.RoleName); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	role, err := f.role(*params.RoleName)
+	if err != nil {
+		return nil, err
+	}
+
+	copied := role.role
+	return &iam.GetRoleOutput{Role: &copied}, nil
+}
+
+func (f *fakeIAM) CreateRole(ctx context.Context, params *iam.CreateRoleInput, optFns ...func(*iam.Options)) (*iam.CreateRoleOutput, error) {
+	if err := f.call(ctx, "CreateRole", *params.RoleName); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.roles[*params.RoleName]; ok {
+		return nil, &types.EntityAlreadyExistsException{Message: aws.String("role " + *params.RoleName + " already exists")}
+	}
+
+	role := f.addRole(*params.RoleName, *params.AssumeRolePolicyDocument)
+	role.role.Tags = params.Tags
+	role.role.Description = params.Description
+	role.role.MaxSessionDuration = params.MaxSessionDuration
+	if params.PermissionsBoundary != nil {
+		role.role.PermissionsBoundary = &types.AttachedPermissionsBoundary{PermissionsBoundaryArn: params.PermissionsBoundary}
+	}
+
+	copied := role.role
+	return &iam.CreateRoleOutput{Role: &copied}, nil
+}
+
+func (f *fakeIAM) DeleteRole(ctx context.Context, params *iam.DeleteRoleInput, optFns ...func(*iam.Options)) (*iam.DeleteRoleOutput, error) {
+	if err := f.call(ctx, "DeleteRole", *params.RoleName); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	role, err := f.role(*params.RoleName)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(role.inline) > 0 || len(role.attached) > 0 {
+		return nil, &types.DeleteConflictException{Message: aws.String("role " + *params.RoleName + " still has policies")}
+	}
+
+	delete(f.roles, *params.RoleName)
+	return &iam.DeleteRoleOutput{}, nil
+}
+
+func (f *fakeIAM) UpdateAssumeRolePolicy(ctx context.Context, params *iam.UpdateAssumeRolePolicyInput, optFns ...func(*iam.Options)) (*iam.UpdateAssumeRolePolicyOutput, error) {
+	if err := f.call(ctx, "UpdateAssumeRolePolicy", *params.RoleName); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	role, err := f.role(*params.RoleName)
+	if err != nil {
+		return nil, err
+	}
+
+	role.role.AssumeRolePolicyDocument = aws.String(url.PathEscape(*params.PolicyDocument))
+	return &iam.UpdateAssumeRolePolicyOutput{}, nil
+}
+
+func (f *fakeIAM) TagRole(ctx context.Context, params *iam.TagRoleInput, optFns ...func(*iam.Options)) (*iam.TagRoleOutput, error) {
+	if err := f.call(ctx, "TagRole", *params.RoleName); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	role, err := f.role(*params.RoleName)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := toTags(role.role.Tags)
+	tags = EditTags(tags, toTags(params.Tags), nil)
+	role.role.Tags = fromTags(tags)
+	return &iam.TagRoleOutput{}, nil
+}
+
+func (f *fakeIAM) UntagRole(ctx context.Context, params *iam.UntagRoleInput, optFns ...func(*iam.Options)) (*iam.UntagRoleOutput, error) {
+	if err := f.call(ctx, "UntagRole", *params.RoleName); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	role, err := f.role(*params.RoleName)
+	if err != nil {
+		return nil, err
+	}
+
+	role.role.Tags = fromTags(EditTags(toTags(role.role.Tags), nil, params.TagKeys))
+	return &iam.UntagRoleOutput{}, nil
+}
+
+func (f *fakeIAM) ListRolePolicies(ctx context.Context, params *iam.ListRolePoliciesInput, optFns ...func(*iam.Options)) (*iam.ListRolePoliciesOutput, error) {
+	if err := f.call(ctx, "ListRolePolicies", *params.RoleName); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	role, err := f.role(*params.RoleName)
+	if err != nil {
+		return nil, err
+	}
+
+	start, end, marker, truncated := f.page(len(role.order), params.Marker)
+	return &iam.ListRolePoliciesOutput{
+		PolicyNames: append([]string(nil), role.order[start:end]...),
+		Marker:      marker,
+		IsTruncated: truncated,
+	}, nil
+}
+
+func (f *fakeIAM) GetRolePolicy(ctx context.Context, params *iam.GetRolePolicyInput, optFns ...func(*iam.Options)) (*iam.GetRolePolicyOutput, error) {
+	if err := f.call(ctx, "GetRolePolicy", *params.RoleName+"/"+*params.PolicyName); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	f.inFlight++
+	if f.inFlight > f.peak {
+		f.peak = f.inFlight
+	}
+	f.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(f.delay):
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.inFlight--
+
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	role, err := f.role(*params.RoleName)
+	if err != nil {
+		return nil, err
+	}
+
+	document, ok := role.inline[*params.PolicyName]
+	if !ok {
+		return nil, &types.NoSuchEntityException{Message: aws.String("policy " + *params.PolicyName + " not found")}
+	}
+
+	return &iam.GetRolePolicyOutput{
+		RoleName:       params.RoleName,
+		PolicyName:     params.PolicyName,
+		PolicyDocument: aws.String(url.PathEscape(document)),
+	}, nil
+}
+
+func (f *fakeIAM) PutRolePolicy(ctx context.Context, params *iam.PutRolePolicyInput, optFns ...func(*iam.Options)) (*iam.PutRolePolicyOutput, error) {
+	if err := f.call(ctx, "PutRolePolicy", *params.RoleName+"/"+*params.PolicyName); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	role, err := f.role(*params.RoleName)
+	if err != nil {
+		return nil, err
+	}
+
+	role.putInline(*params.PolicyName, aws.ToString(params.PolicyDocument))
+	return &iam.PutRolePolicyOutput{}, nil
+}
+
+func (f *fakeIAM) DeleteRolePolicy(ctx context.Context, params *iam.DeleteRolePolicyInput, optFns ...func(*iam.Options)) (*iam.DeleteRolePolicyOutput, error) {
+	if err := f.call(ctx, "DeleteRolePolicy", *params.RoleName+"/"+*params.PolicyName); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	role, err := f.role(*params.RoleName)
+	if err != nil {
+		return nil, err
+	}
+
+	delete(role.inline, *params.PolicyName)
+	for i, policyName := range role.order {
+		if policyName == *params.PolicyName {
+			role.order = append(role.order[:i:i], role.order[i+1:]...)
+			break
+		}
+	}
+
+	return &iam.DeleteRolePolicyOutput{}, nil
+}
+
+func (f *fakeIAM) ListAttachedRolePolicies(ctx context.Context, params *iam.ListAttachedRolePoliciesInput, optFns ...func(*iam.Options)) (*iam.ListAttachedRolePoliciesOutput, error) {
+	if err := f.call(ctx, "ListAttachedRolePolicies", *params.RoleName); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	role, err := f.role(*params.RoleName)
+	if err != nil {
+		return nil, err
+	}
+
+	start, end, marker, truncated := f.page(len(role.attached), params.Marker)
+	return &iam.ListAttachedRolePoliciesOutput{
+		AttachedPolicies: append([]types.AttachedPolicy(nil), role.attached[start:end]...),
+		Marker:           marker,
+		IsTruncated:      truncated,
+	}, nil
+}
+
+func (f *fakeIAM) AttachRolePolicy(ctx context.Context, params *iam.AttachRolePolicyInput, optFns ...func(*iam.Options)) (*iam.AttachRolePolicyOutput, error) {
+	if err := f.call(ctx, "AttachRolePolicy", *params.RoleName+" "+*params.PolicyArn); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	role, err := f.role(*params.RoleName)
+	if err != nil {
+		return nil, err
+	}
+
+	policyName := (*params.PolicyArn)[strings.LastIndex(*params.PolicyArn, "/")+1:]
+	if !IsAWSManagedPolicy(*params.PolicyArn) {
+		policy, err := f.policy(*params.PolicyArn)
+		if err != nil {
+			return nil, err
+		}
+		policyName = *policy.policy.PolicyName
+	}
+
+	role.attach(policyName, *params.PolicyArn)
+	return &iam.AttachRolePolicyOutput{}, nil
+}
+
+func (f *fakeIAM) DetachRolePolicy(ctx context.Context, params *iam.DetachRolePolicyInput, optFns ...func(*iam.Options)) (*iam.DetachRolePolicyOutput, error) {
+	if err := f.call(ctx, "DetachRolePolicy", *params.RoleName+" "+*params.PolicyArn); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	role, err := f.role(*params.RoleName)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, policy := range role.attached {
+		if *policy.PolicyArn == *params.PolicyArn {
+			role.attached = append(role.attached[:i:i], role.attached[i+1:]...)
+			return &iam.DetachRolePolicyOutput{}, nil
+		}
+	}
+
+	return nil, &types.NoSuchEntityException{Message: aws.String("policy " + *params.PolicyArn + " is not attached")}
+}
+
+// ListPolicies lists the customer managed policies, the only ones the fake
+// holds, in a single page.
+func (f *fakeIAM) ListPolicies(ctx context.Context, params *iam.ListPoliciesInput, optFns ...func(*iam.Options)) (*iam.ListPoliciesOutput, error) {
+	if err := f.call(ctx, "ListPolicies", string(params.Scope)); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	out := iam.ListPoliciesOutput{}
+	if params.Scope == types.PolicyScopeTypeLocal {
+		for _, policy := range f.policies {
+			out.Policies = append(out.Policies, policy.policy)
+		}
+		sort.Slice(out.Policies, func(i, j int) bool { return *out.Policies[i].Arn < *out.Policies[j].Arn })
+	}
+
+	return &out, nil
+}
+
+func (f *fakeIAM) GetPolicy(ctx context.Context, params *iam.GetPolicyInput, optFns ...func(*iam.Options)) (*iam.GetPolicyOutput, error) {
+	if err := f.call(ctx, "GetPolicy", *params.PolicyArn); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	policy, err := f.policy(*params.PolicyArn)
+	if err != nil {
+		return nil, err
+	}
+
+	copied := policy.policy
+	return &iam.GetPolicyOutput{Policy: &copied}, nil
+}
+
+func (f *fakeIAM) GetPolicyVersion(ctx context.Context, params *iam.GetPolicyVersionInput, optFns ...func(*iam.Options)) (*iam.GetPolicyVersionOutput, error) {
+	if err := f.call(ctx, "GetPolicyVersion", *params.PolicyArn); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	policy, err := f.policy(*params.PolicyArn)
+	if err != nil {
+		return nil, err
+	}
+
+	return &iam.GetPolicyVersionOutput{
+		PolicyVersion: &types.PolicyVersion{
+			VersionId:        params.VersionId,
+			Document:         aws.String(url.PathEscape(policy.document)),
+			IsDefaultVersion: *params.VersionId == *policy.policy.DefaultVersionId,
+		},
+	}, nil
+}
+
+func (f *fakeIAM) ListPolicyTags(ctx context.Context, params *iam.ListPolicyTagsInput, optFns ...func(*iam.Options)) (*iam.ListPolicyTagsOutput, error) {
+	if err := f.call(ctx, "ListPolicyTags", *params.PolicyArn); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	policy, err := f.policy(*params.PolicyArn)
+	if err != nil {
+		return nil, err
+	}
+
+	start, end, marker, truncated := f.page(len(policy.tags), params.Marker)
+	return &iam.ListPolicyTagsOutput{
+		Tags:        append([]types.Tag(nil), policy.tags[start:end]...),
+		Marker:      marker,
+		IsTruncated: truncated,
+	}, nil
+}
+
+func (f *fakeIAM) CreatePolicy(ctx context.Context, params *iam.CreatePolicyInput, optFns ...func(*iam.Options)) (*iam.CreatePolicyOutput, error) {
+	if err := f.call(ctx, "CreatePolicy", *params.PolicyName); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, policy := range f.policies {
+		if *policy.policy.PolicyName == *params.PolicyName {
+			return nil, &types.EntityAlreadyExistsException{Message: aws.String("policy " + *params.PolicyName + " already exists")}
+		}
+	}
+
+	policyArn := f.addPolicy(*params.PolicyName, *params.PolicyDocument)
+	f.policies[policyArn].tags = params.Tags
+
+	copied := f.policies[policyArn].policy
+	return &iam.CreatePolicyOutput{Policy: &copied}, nil
+}
+
+func (f *fakeIAM) DeletePolicy(ctx context.Context, params *iam.DeletePolicyInput, optFns ...func(*iam.Options)) (*iam.DeletePolicyOutput, error) {
+	if err := f.call(ctx, "DeletePolicy", *params.PolicyArn); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, err := f.policy(*params.PolicyArn); err != nil {
+		return nil, err
+	}
+
+	for _, role := range f.roles {
+		for _, policy := range role.attached {
+			if *policy.PolicyArn == *params.PolicyArn {
+				return nil, &types.DeleteConflictException{Message: aws.String("policy " + *params.PolicyArn + " is still attached")}
+			}
+		}
+	}
+
+	delete(f.policies, *params.PolicyArn)
+	return &iam.DeletePolicyOutput{}, nil
+}
+
+// inlineNames returns the inline policy names of roleName, sorted.
+func (f *fakeIAM) inlineNames(roleName string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	role, ok := f.roles[roleName]
+	if !ok {
+		return nil
+	}
+
+	names := append([]string(nil), role.order...)
+	sort.Strings(names)
+	return names
+}
+
+// attachedArns returns the ARNs of the managed policies attached to
+// roleName, sorted.
+func (f *fakeIAM) attachedArns(roleName string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	role, ok := f.roles[roleName]
+	if !ok {
+		return nil
+	}
+
+	var arns []string
+	for _, policy := range role.attached {
+		arns = append(arns, *policy.PolicyArn)
+	}
+	sort.Strings(arns)
+	return arns
+}
+
+// hasRole reports whether roleName exists.
+func (f *fakeIAM) hasRole(roleName string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	_, ok := f.roles[roleName]
+	return ok
+}
+
+func fromTags(tags []Tag) []types.Tag {
+	var converted []types.Tag
+	for _, tag := range tags {
+		converted = append(converted, types.Tag{Key: aws.String(tag.Key), Value: aws.String(tag.Value)})
+	}
+
+	return converted
+}
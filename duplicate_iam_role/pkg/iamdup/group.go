@@ -0,0 +1,181 @@
+package iamdup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+)
+
+// DuplicateGroup creates targetGroupName as a copy of sourceGroupName,
+// including its path, inline policies and managed policies. Members are
+// only added to the new group when CopyGroupMembers is set.
+func (d *Duplicator) DuplicateGroup(ctx context.Context, sourceGroupName string, targetGroupName string) error {
+	err := d.Validate()
+	if err != nil {
+		return err
+	}
+
+	var sourceGroup *iam.GetGroupOutput
+	var memberNames []string
+
+	paginator := iam.NewGetGroupPaginator(d.Client, &iam.GetGroupInput{
+		GroupName: &sourceGroupName,
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("unable to get source group, %w", &OpError{Op: "GetGroup", GroupName: sourceGroupName, Err: err})
+		}
+
+		sourceGroup = page
+		for _, user := range page.Users {
+			memberNames = append(memberNames, *user.UserName)
+		}
+	}
+
+	inlinePolicies, err := GetGroupInlinePolicies(ctx, d.Client, sourceGroupName)
+	if err != nil {
+		return fmt.Errorf("unable to get inline policies, %w", err)
+	}
+
+	managedPolicies, err := GetGroupManagedPolicies(ctx, d.Client, sourceGroupName)
+	if err != nil {
+		return fmt.Errorf("unable to get managed policies, %w", err)
+	}
+
+	for _, policy := range inlinePolicies {
+		err = ValidateDocument(policy.Document)
+		if err != nil {
+			return fmt.Errorf("invalid inline policy %s, %w", policy.Name, err)
+		}
+	}
+
+	params := iam.CreateGroupInput{
+		GroupName: &targetGroupName,
+		Path:      sourceGroup.Group.Path,
+	}
+
+	if d.Path != "" {
+		params.Path = &d.Path
+	}
+
+	if d.DryRun {
+		fmt.Fprintf(d.Out, "[dry-run] create group %s\n", targetGroupName)
+		for _, policy := range inlinePolicies {
+			fmt.Fprintf(d.Out, "[dry-run]   put inline policy %s (%d bytes)\n", policy.Name, len(policy.Document))
+		}
+		for _, policy := range managedPolicies {
+			fmt.Fprintf(d.Out, "[dry-run]   attach managed policy %s\n", policy.Arn)
+		}
+		if d.CopyGroupMembers {
+			for _, userName := range memberNames {
+				fmt.Fprintf(d.Out, "[dry-run]   add user %s\n", userName)
+			}
+		}
+		return nil
+	}
+
+	err = d.confirm(ctx, "create group "+targetGroupName)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.Target.CreateGroup(ctx, &params)
+	if err != nil {
+		return fmt.Errorf("unable to create group, %w", &OpError{Op: "CreateGroup", GroupName: targetGroupName, Err: err})
+	}
+
+	// A failing policy or member does not stop the others, as for roles.
+	var errs []error
+	for _, policy := range inlinePolicies {
+		policyDocument := string(policy.Document)
+
+		_, err = d.Target.PutGroupPolicy(ctx, &iam.PutGroupPolicyInput{
+			GroupName:      &targetGroupName,
+			PolicyName:     aws.String(policy.Name),
+			PolicyDocument: &policyDocument,
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to add inline policy %s, %w", policy.Name, &OpError{Op: "PutGroupPolicy", GroupName: targetGroupName, PolicyName: policy.Name, Err: err}))
+		}
+	}
+
+	for _, policy := range managedPolicies {
+		_, err = d.Target.AttachGroupPolicy(ctx, &iam.AttachGroupPolicyInput{
+			GroupName: &targetGroupName,
+			PolicyArn: aws.String(policy.Arn),
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to add managed policy %s, %w", policy.Arn, &OpError{Op: "AttachGroupPolicy", GroupName: targetGroupName, PolicyName: policy.Arn, Err: err}))
+		}
+	}
+
+	if !d.CopyGroupMembers {
+		return errors.Join(errs...)
+	}
+
+	for _, userName := range memberNames {
+		_, err = d.Target.AddUserToGroup(ctx, &iam.AddUserToGroupInput{
+			GroupName: &targetGroupName,
+			UserName:  aws.String(userName),
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to add user %s to group, %w", userName, &OpError{Op: "AddUserToGroup", GroupName: targetGroupName, UserName: userName, Err: err}))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func GetGroupInlinePolicies(ctx context.Context, client IAMClient, groupName string) ([]InlinePolicy, error) {
+	params := iam.ListGroupPoliciesInput{
+		GroupName: &groupName,
+	}
+
+	var policyNames []string
+
+	paginator := iam.NewListGroupPoliciesPaginator(client, &params)
+	for paginator.HasMorePages() {
+		groupPolicies, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, &OpError{Op: "ListGroupPolicies", GroupName: groupName, Err: err}
+		}
+
+		policyNames = append(policyNames, groupPolicies.PolicyNames...)
+	}
+
+	return getInlinePolicies(policyNames, func(policyName string) (*string, error) {
+		groupPolicy, err := client.GetGroupPolicy(ctx, &iam.GetGroupPolicyInput{
+			GroupName:  &groupName,
+			PolicyName: &policyName,
+		})
+		if err != nil {
+			return nil, &OpError{Op: "GetGroupPolicy", GroupName: groupName, PolicyName: policyName, Err: err}
+		}
+
+		return groupPolicy.PolicyDocument, nil
+	})
+}
+
+func GetGroupManagedPolicies(ctx context.Context, client IAMClient, groupName string) ([]ManagedPolicy, error) {
+	params := iam.ListAttachedGroupPoliciesInput{
+		GroupName: &groupName,
+	}
+
+	var managedPolicies []ManagedPolicy
+
+	paginator := iam.NewListAttachedGroupPoliciesPaginator(client, &params)
+	for paginator.HasMorePages() {
+		attachedGroupPolicies, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, &OpError{Op: "ListAttachedGroupPolicies", GroupName: groupName, Err: err}
+		}
+
+		managedPolicies = append(managedPolicies, toManagedPolicies(attachedGroupPolicies.AttachedPolicies)...)
+	}
+
+	return managedPolicies, nil
+}
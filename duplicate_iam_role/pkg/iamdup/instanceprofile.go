@@ -0,0 +1,87 @@
+package iamdup
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+func GetInstanceProfiles(ctx context.Context, client IAMClient, roleName string) ([]types.InstanceProfile, error) {
+	params := iam.ListInstanceProfilesForRoleInput{
+		RoleName: &roleName,
+	}
+
+	var instanceProfiles []types.InstanceProfile
+
+	paginator := iam.NewListInstanceProfilesForRolePaginator(client, &params)
+	for paginator.HasMorePages() {
+		roleInstanceProfiles, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, &OpError{Op: "ListInstanceProfilesForRole", RoleName: roleName, Err: err}
+		}
+
+		instanceProfiles = append(instanceProfiles, roleInstanceProfiles.InstanceProfiles...)
+	}
+
+	return instanceProfiles, nil
+}
+
+// instanceProfileName returns the name of the instance profile wrapping
+// targetRoleName.
+func (d *Duplicator) instanceProfileName(targetRoleName string) string {
+	if d.InstanceProfileName != "" {
+		return d.InstanceProfileName
+	}
+
+	return targetRoleName
+}
+
+// copyInstanceProfile creates the instance profile of targetRoleName, when
+// the source role had one, and adds the role to it. An instance profile
+// that already exists is reused.
+func (d *Duplicator) copyInstanceProfile(ctx context.Context, client IAMClient, snapshot *Snapshot, targetRoleName string) error {
+	if len(snapshot.InstanceProfiles) == 0 {
+		d.warn(fmt.Sprintf("source role %s is not in any instance profile, skipping", snapshot.RoleName))
+		return nil
+	}
+
+	instanceProfileName := d.instanceProfileName(targetRoleName)
+
+	instanceProfiles, err := GetInstanceProfiles(ctx, client, targetRoleName)
+	if err != nil {
+		return err
+	}
+
+	for _, instanceProfile := range instanceProfiles {
+		if *instanceProfile.InstanceProfileName == instanceProfileName {
+			return nil
+		}
+	}
+
+	createParams := iam.CreateInstanceProfileInput{
+		InstanceProfileName: &instanceProfileName,
+	}
+
+	if snapshot.Path != "" {
+		createParams.Path = &snapshot.Path
+	}
+
+	_, err = client.CreateInstanceProfile(ctx, &createParams)
+	if err != nil && !IsEntityAlreadyExists(err) {
+		return fmt.Errorf("instance profile %s, %w", instanceProfileName, &OpError{Op: "CreateInstanceProfile", Err: err})
+	}
+
+	addParams := iam.AddRoleToInstanceProfileInput{
+		InstanceProfileName: &instanceProfileName,
+		RoleName:            &targetRoleName,
+	}
+
+	_, err = client.AddRoleToInstanceProfile(ctx, &addParams)
+	if err != nil {
+		return fmt.Errorf("instance profile %s, %w", instanceProfileName, &OpError{Op: "AddRoleToInstanceProfile", RoleName: targetRoleName, Err: err})
+	}
+
+	return nil
+}
@@ -0,0 +1,174 @@
+package iamdup
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+)
+
+// LockdownPolicyDocument is the assume role policy document of a role
+// created with Lockdown. It denies sts:AssumeRole to everyone.
+var LockdownPolicyDocument = json.RawMessage(`{"Version":"2012-10-17","Statement":[{"Effect":"Deny","Principal":{"AWS":"*"},"Action":"sts:AssumeRole"}]}`)
+
+// LockdownTag is the tag key naming the source role of a role created with
+// Lockdown, removed by Activate.
+const LockdownTag = "LockdownSource"
+
+// LockdownTrustTag prefixes the keys of the tags in which Lockdown stores
+// the assume role policy document Activate gives the role. IAM tag values
+// cannot hold JSON, so the document is base64 encoded and split across
+// LockdownTrustTag1, LockdownTrustTag2 and so on.
+const LockdownTrustTag = "LockdownTrust"
+
+// maxTagValueLength is the longest tag value IAM accepts.
+const maxTagValueLength = 256
+
+// ErrNotLockedDown is returned by Activate when the target role was not
+// created with Lockdown from the given source role.
+var ErrNotLockedDown = errors.New("role is not locked down")
+
+// lockdown replaces the assume role policy document of snapshot with
+// LockdownPolicyDocument, records its source role in LockdownTag and
+// stores the replaced document in the LockdownTrustTag tags.
+func lockdown(snapshot *Snapshot) error {
+	var document bytes.Buffer
+	err := json.Compact(&document, snapshot.AssumeRolePolicyDocument)
+	if err != nil {
+		return fmt.Errorf("invalid assume role policy document, %w", err)
+	}
+
+	tags := []Tag{{Key: LockdownTag, Value: snapshot.RoleName}}
+	encoded := base64.StdEncoding.EncodeToString(document.Bytes())
+	for i := 1; encoded != ""; i++ {
+		n := min(len(encoded), maxTagValueLength)
+		tags = append(tags, Tag{Key: LockdownTrustTag + strconv.Itoa(i), Value: encoded[:n]})
+		encoded = encoded[n:]
+	}
+
+	snapshot.AssumeRolePolicyDocument = LockdownPolicyDocument
+	snapshot.Tags = EditTags(snapshot.Tags, tags, nil)
+
+	return nil
+}
+
+// lockdownTrust returns the assume role policy document stored by
+// lockdown in tags, and the keys of the tags holding it.
+func lockdownTrust(tags []Tag) (json.RawMessage, []string, error) {
+	parts := make(map[int]string)
+	var keys []string
+	for _, tag := range tags {
+		suffix, ok := strings.CutPrefix(tag.Key, LockdownTrustTag)
+		if !ok {
+			continue
+		}
+
+		i, err := strconv.Atoi(suffix)
+		if err != nil || i < 1 {
+			continue
+		}
+
+		parts[i] = tag.Value
+		keys = append(keys, tag.Key)
+	}
+
+	if len(parts) == 0 {
+		return nil, nil, fmt.Errorf("no %s tags", LockdownTrustTag)
+	}
+
+	var encoded strings.Builder
+	for i := 1; i <= len(parts); i++ {
+		part, ok := parts[i]
+		if !ok {
+			return nil, nil, fmt.Errorf("missing tag %s%d", LockdownTrustTag, i)
+		}
+		encoded.WriteString(part)
+	}
+
+	document, err := base64.StdEncoding.DecodeString(encoded.String())
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid %s tags, %w", LockdownTrustTag, err)
+	}
+	sort.Strings(keys)
+
+	return document, keys, nil
+}
+
+// Activate gives targetRoleName, created with Lockdown from sourceRoleName,
+// the assume role policy document it was locked down with, as stored in its
+// LockdownTrustTag tags. This is the document that was reviewed at lockdown
+// time, even if the source role changed since. The lockdown tags are then
+// removed. ErrNotLockedDown is returned when LockdownTag of targetRoleName
+// does not name sourceRoleName.
+func (d *Duplicator) Activate(ctx context.Context, sourceRoleName string, targetRoleName string) error {
+	err := d.Validate()
+	if err != nil {
+		return err
+	}
+
+	target, err := DescribeRole(ctx, d.Target, targetRoleName)
+	if err != nil {
+		return roleNotFound("target", targetRoleName, err)
+	}
+
+	lockdownSource, ok := "", false
+	for _, tag := range target.Tags {
+		if tag.Key == LockdownTag {
+			lockdownSource, ok = tag.Value, true
+		}
+	}
+	if !ok {
+		return fmt.Errorf("target role %s has no %s tag: %w", targetRoleName, LockdownTag, ErrNotLockedDown)
+	}
+	if lockdownSource != sourceRoleName {
+		return fmt.Errorf("target role %s was locked down from %s, not %s: %w", targetRoleName, lockdownSource, sourceRoleName, ErrNotLockedDown)
+	}
+
+	document, trustKeys, err := lockdownTrust(target.Tags)
+	if err != nil {
+		return fmt.Errorf("unable to read the locked down assume role policy document of %s, %w", targetRoleName, err)
+	}
+
+	err = ValidateDocument(document)
+	if err != nil {
+		return fmt.Errorf("invalid assume role policy document, %w", err)
+	}
+
+	err = d.checkProtected(targetRoleName)
+	if err != nil {
+		return err
+	}
+
+	if d.DryRun {
+		fmt.Fprintf(d.Out, "[dry-run] activate role %s\n", targetRoleName)
+		fmt.Fprintf(d.Out, "[dry-run]   assume role policy document: %s\n", document)
+		return nil
+	}
+
+	err = d.confirm(ctx, "activate role "+targetRoleName)
+	if err != nil {
+		return err
+	}
+
+	err = UpdateAssumeRolePolicy(ctx, d.Target, &Snapshot{AssumeRolePolicyDocument: document}, targetRoleName)
+	if err != nil {
+		return roleNotFound("target", targetRoleName, err)
+	}
+
+	_, err = d.Target.UntagRole(ctx, &iam.UntagRoleInput{
+		RoleName: &targetRoleName,
+		TagKeys:  append([]string{LockdownTag}, trustKeys...),
+	})
+	if err != nil {
+		return &OpError{Op: "UntagRole", RoleName: targetRoleName, Err: err}
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+package iamdup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func TestLockdownThenActivate(t *testing.T) {
+	// Enough principals for the encoded document to need several tags.
+	var principals []string
+	for i := 0; i < 20; i++ {
+		principals = append(principals, fmt.Sprintf(`"arn:aws:iam::111111111111:role/caller-%d"`, i))
+	}
+	trust := `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"AWS":[` + strings.Join(principals, ",") + `]},"Action":"sts:AssumeRole"}]}`
+
+	client := newFakeIAM("111111111111")
+	source := client.addRole("app", trust)
+
+	d := New(client)
+	d.Lockdown = true
+	_, err := d.Duplicate(context.Background(), "app", "app-copy")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target := client.roles["app-copy"]
+	if got, _ := url.PathUnescape(*target.role.AssumeRolePolicyDocument); got != string(LockdownPolicyDocument) {
+		t.Errorf("locked down AssumeRolePolicyDocument = %s, want %s", got, LockdownPolicyDocument)
+	}
+	trustTags := 0
+	for _, tag := range toTags(target.role.Tags) {
+		if strings.HasPrefix(tag.Key, LockdownTrustTag) {
+			trustTags++
+		}
+	}
+	if trustTags < 2 {
+		t.Errorf("document stored in %d %s tags, want several", trustTags, LockdownTrustTag)
+	}
+
+	// Activate applies the document reviewed at lockdown, not the current
+	// one of the source.
+	source.role.AssumeRolePolicyDocument = aws.String(url.PathEscape(testTrust))
+
+	err = New(client).Activate(context.Background(), "app", "app-copy")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, _ := url.PathUnescape(*target.role.AssumeRolePolicyDocument); got != trust {
+		t.Errorf("activated AssumeRolePolicyDocument = %s, want %s", got, trust)
+	}
+	for _, tag := range toTags(target.role.Tags) {
+		if tag.Key == LockdownTag || strings.HasPrefix(tag.Key, LockdownTrustTag) {
+			t.Errorf("tag %s left after activation", tag.Key)
+		}
+	}
+}
+
+func TestActivateRequiresLockdownTag(t *testing.T) {
+	tests := []struct {
+		name string
+		tags []Tag
+	}{
+		{"no tag", nil},
+		{"other source", []Tag{{Key: LockdownTag, Value: "other"}, {Key: LockdownTrustTag + "1", Value: "e30="}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newFakeIAM("111111111111")
+			client.addRole("app", testTrust)
+			target := client.addRole("app-copy", string(LockdownPolicyDocument))
+			target.role.Tags = fromTags(tt.tags)
+
+			err := New(client).Activate(context.Background(), "app", "app-copy")
+			if !errors.Is(err, ErrNotLockedDown) {
+				t.Fatalf("Activate() error = %v, want %v", err, ErrNotLockedDown)
+			}
+			if n := len(client.callsTo("UpdateAssumeRolePolicy")); n != 0 {
+				t.Errorf("UpdateAssumeRolePolicy called %d times", n)
+			}
+		})
+	}
+}
@@ -0,0 +1,367 @@
+package iamdup
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+)
+
+// LoggingClient wraps an IAMClient and logs every call made through it,
+// one key=value line per call with its result, so that a run can be
+// followed step by step and grepped afterwards. Listing calls also log
+// each policy they discovered.
+//
+// When StructuredLogger is set, each call is logged through it instead, as
+// an event with the same fields as attributes.
+type LoggingClient struct {
+	IAMClient
+	Logger           *log.Logger
+	StructuredLogger *slog.Logger
+}
+
+func (c *LoggingClient) log(op string, err error, fields ...string) {
+	if c.StructuredLogger != nil {
+		c.logStructured(op, err, fields...)
+		return
+	}
+
+	var line strings.Builder
+
+	line.WriteString("op=" + op)
+	for i := 0; i+1 < len(fields); i += 2 {
+		if fields[i+1] != "" {
+			fmt.Fprintf(&line, " %s=%s", fields[i], quoteValue(fields[i+1]))
+		}
+	}
+
+	if err != nil {
+		fmt.Fprintf(&line, " result=error error=%s", strconv.Quote(err.Error()))
+	} else {
+		line.WriteString(" result=ok")
+	}
+
+	c.Logger.Print(line.String())
+}
+
+func (c *LoggingClient) logStructured(op string, err error, fields ...string) {
+	attrs := []interface{}{slog.String("op", op)}
+	for i := 0; i+1 < len(fields); i += 2 {
+		if fields[i+1] != "" {
+			attrs = append(attrs, slog.String(fields[i], fields[i+1]))
+		}
+	}
+
+	if err != nil {
+		c.StructuredLogger.Error("api call", append(attrs, slog.String("result", "error"), slog.String("error", err.Error()))...)
+		return
+	}
+
+	c.StructuredLogger.Info("api call", append(attrs, slog.String("result", "ok"))...)
+}
+
+func quoteValue(value string) string {
+	if strings.ContainsAny(value, " \"=") {
+		return strconv.Quote(value)
+	}
+	return value
+}
+
+func (c *LoggingClient) GetRole(ctx context.Context, params *iam.GetRoleInput, optFns ...func(*iam.Options)) (*iam.GetRoleOutput, error) {
+	out, err := c.IAMClient.GetRole(ctx, params, optFns...)
+	c.log("GetRole", err, "role", aws.ToString(params.RoleName))
+	return out, err
+}
+
+func (c *LoggingClient) ListRoles(ctx context.Context, params *iam.ListRolesInput, optFns ...func(*iam.Options)) (*iam.ListRolesOutput, error) {
+	out, err := c.IAMClient.ListRoles(ctx, params, optFns...)
+	c.log("ListRoles", err, "path_prefix", aws.ToString(params.PathPrefix))
+	return out, err
+}
+
+func (c *LoggingClient) ListRolePolicies(ctx context.Context, params *iam.ListRolePoliciesInput, optFns ...func(*iam.Options)) (*iam.ListRolePoliciesOutput, error) {
+	out, err := c.IAMClient.ListRolePolicies(ctx, params, optFns...)
+	c.log("ListRolePolicies", err, "role", aws.ToString(params.RoleName))
+	if err == nil {
+		for _, policyName := range out.PolicyNames {
+			c.log("ListRolePolicies", nil, "role", aws.ToString(params.RoleName), "found", policyName)
+		}
+	}
+	return out, err
+}
+
+func (c *LoggingClient) GetRolePolicy(ctx context.Context, params *iam.GetRolePolicyInput, optFns ...func(*iam.Options)) (*iam.GetRolePolicyOutput, error) {
+	out, err := c.IAMClient.GetRolePolicy(ctx, params, optFns...)
+	c.log("GetRolePolicy", err, "role", aws.ToString(params.RoleName), "policy", aws.ToString(params.PolicyName))
+	return out, err
+}
+
+func (c *LoggingClient) ListAttachedRolePolicies(ctx context.Context, params *iam.ListAttachedRolePoliciesInput, optFns ...func(*iam.Options)) (*iam.ListAttachedRolePoliciesOutput, error) {
+	out, err := c.IAMClient.ListAttachedRolePolicies(ctx, params, optFns...)
+	c.log("ListAttachedRolePolicies", err, "role", aws.ToString(params.RoleName), "path_prefix", aws.ToString(params.PathPrefix))
+	if err == nil {
+		for _, policy := range out.AttachedPolicies {
+			c.log("ListAttachedRolePolicies", nil, "role", aws.ToString(params.RoleName), "path_prefix", aws.ToString(params.PathPrefix), "found", aws.ToString(policy.PolicyArn))
+		}
+	}
+	return out, err
+}
+
+func (c *LoggingClient) CreateRole(ctx context.Context, params *iam.CreateRoleInput, optFns ...func(*iam.Options)) (*iam.CreateRoleOutput, error) {
+	out, err := c.IAMClient.CreateRole(ctx, params, optFns...)
+	c.log("CreateRole", err, "role", aws.ToString(params.RoleName))
+	return out, err
+}
+
+func (c *LoggingClient) PutRolePolicy(ctx context.Context, params *iam.PutRolePolicyInput, optFns ...func(*iam.Options)) (*iam.PutRolePolicyOutput, error) {
+	out, err := c.IAMClient.PutRolePolicy(ctx, params, optFns...)
+	c.log("PutRolePolicy", err, "role", aws.ToString(params.RoleName), "policy", aws.ToString(params.PolicyName))
+	return out, err
+}
+
+func (c *LoggingClient) AttachRolePolicy(ctx context.Context, params *iam.AttachRolePolicyInput, optFns ...func(*iam.Options)) (*iam.AttachRolePolicyOutput, error) {
+	out, err := c.IAMClient.AttachRolePolicy(ctx, params, optFns...)
+	c.log("AttachRolePolicy", err, "role", aws.ToString(params.RoleName), "policy_arn", aws.ToString(params.PolicyArn))
+	return out, err
+}
+
+func (c *LoggingClient) UpdateAssumeRolePolicy(ctx context.Context, params *iam.UpdateAssumeRolePolicyInput, optFns ...func(*iam.Options)) (*iam.UpdateAssumeRolePolicyOutput, error) {
+	out, err := c.IAMClient.UpdateAssumeRolePolicy(ctx, params, optFns...)
+	c.log("UpdateAssumeRolePolicy", err, "role", aws.ToString(params.RoleName))
+	return out, err
+}
+
+func (c *LoggingClient) DeleteRolePolicy(ctx context.Context, params *iam.DeleteRolePolicyInput, optFns ...func(*iam.Options)) (*iam.DeleteRolePolicyOutput, error) {
+	out, err := c.IAMClient.DeleteRolePolicy(ctx, params, optFns...)
+	c.log("DeleteRolePolicy", err, "role", aws.ToString(params.RoleName), "policy", aws.ToString(params.PolicyName))
+	return out, err
+}
+
+func (c *LoggingClient) DetachRolePolicy(ctx context.Context, params *iam.DetachRolePolicyInput, optFns ...func(*iam.Options)) (*iam.DetachRolePolicyOutput, error) {
+	out, err := c.IAMClient.DetachRolePolicy(ctx, params, optFns...)
+	c.log("DetachRolePolicy", err, "role", aws.ToString(params.RoleName), "policy_arn", aws.ToString(params.PolicyArn))
+	return out, err
+}
+
+func (c *LoggingClient) DeleteRole(ctx context.Context, params *iam.DeleteRoleInput, optFns ...func(*iam.Options)) (*iam.DeleteRoleOutput, error) {
+	out, err := c.IAMClient.DeleteRole(ctx, params, optFns...)
+	c.log("DeleteRole", err, "role", aws.ToString(params.RoleName))
+	return out, err
+}
+
+func (c *LoggingClient) TagRole(ctx context.Context, params *iam.TagRoleInput, optFns ...func(*iam.Options)) (*iam.TagRoleOutput, error) {
+	out, err := c.IAMClient.TagRole(ctx, params, optFns...)
+	c.log("TagRole", err, "role", aws.ToString(params.RoleName))
+	return out, err
+}
+
+func (c *LoggingClient) UntagRole(ctx context.Context, params *iam.UntagRoleInput, optFns ...func(*iam.Options)) (*iam.UntagRoleOutput, error) {
+	out, err := c.IAMClient.UntagRole(ctx, params, optFns...)
+	c.log("UntagRole", err, "role", aws.ToString(params.RoleName))
+	return out, err
+}
+
+func (c *LoggingClient) ListInstanceProfilesForRole(ctx context.Context, params *iam.ListInstanceProfilesForRoleInput, optFns ...func(*iam.Options)) (*iam.ListInstanceProfilesForRoleOutput, error) {
+	out, err := c.IAMClient.ListInstanceProfilesForRole(ctx, params, optFns...)
+	c.log("ListInstanceProfilesForRole", err, "role", aws.ToString(params.RoleName))
+	return out, err
+}
+
+func (c *LoggingClient) RemoveRoleFromInstanceProfile(ctx context.Context, params *iam.RemoveRoleFromInstanceProfileInput, optFns ...func(*iam.Options)) (*iam.RemoveRoleFromInstanceProfileOutput, error) {
+	out, err := c.IAMClient.RemoveRoleFromInstanceProfile(ctx, params, optFns...)
+	c.log("RemoveRoleFromInstanceProfile", err, "role", aws.ToString(params.RoleName), "instance_profile", aws.ToString(params.InstanceProfileName))
+	return out, err
+}
+
+func (c *LoggingClient) CreateInstanceProfile(ctx context.Context, params *iam.CreateInstanceProfileInput, optFns ...func(*iam.Options)) (*iam.CreateInstanceProfileOutput, error) {
+	out, err := c.IAMClient.CreateInstanceProfile(ctx, params, optFns...)
+	c.log("CreateInstanceProfile", err, "instance_profile", aws.ToString(params.InstanceProfileName))
+	return out, err
+}
+
+func (c *LoggingClient) AddRoleToInstanceProfile(ctx context.Context, params *iam.AddRoleToInstanceProfileInput, optFns ...func(*iam.Options)) (*iam.AddRoleToInstanceProfileOutput, error) {
+	out, err := c.IAMClient.AddRoleToInstanceProfile(ctx, params, optFns...)
+	c.log("AddRoleToInstanceProfile", err, "role", aws.ToString(params.RoleName), "instance_profile", aws.ToString(params.InstanceProfileName))
+	return out, err
+}
+
+func (c *LoggingClient) DeleteInstanceProfile(ctx context.Context, params *iam.DeleteInstanceProfileInput, optFns ...func(*iam.Options)) (*iam.DeleteInstanceProfileOutput, error) {
+	out, err := c.IAMClient.DeleteInstanceProfile(ctx, params, optFns...)
+	c.log("DeleteInstanceProfile", err, "instance_profile", aws.ToString(params.InstanceProfileName))
+	return out, err
+}
+
+func (c *LoggingClient) GetPolicy(ctx context.Context, params *iam.GetPolicyInput, optFns ...func(*iam.Options)) (*iam.GetPolicyOutput, error) {
+	out, err := c.IAMClient.GetPolicy(ctx, params, optFns...)
+	c.log("GetPolicy", err, "policy_arn", aws.ToString(params.PolicyArn))
+	return out, err
+}
+
+func (c *LoggingClient) GetPolicyVersion(ctx context.Context, params *iam.GetPolicyVersionInput, optFns ...func(*iam.Options)) (*iam.GetPolicyVersionOutput, error) {
+	out, err := c.IAMClient.GetPolicyVersion(ctx, params, optFns...)
+	c.log("GetPolicyVersion", err, "policy_arn", aws.ToString(params.PolicyArn), "version", aws.ToString(params.VersionId))
+	return out, err
+}
+
+func (c *LoggingClient) ListPolicyVersions(ctx context.Context, params *iam.ListPolicyVersionsInput, optFns ...func(*iam.Options)) (*iam.ListPolicyVersionsOutput, error) {
+	out, err := c.IAMClient.ListPolicyVersions(ctx, params, optFns...)
+	c.log("ListPolicyVersions", err, "policy_arn", aws.ToString(params.PolicyArn))
+	return out, err
+}
+
+func (c *LoggingClient) ListPolicyTags(ctx context.Context, params *iam.ListPolicyTagsInput, optFns ...func(*iam.Options)) (*iam.ListPolicyTagsOutput, error) {
+	out, err := c.IAMClient.ListPolicyTags(ctx, params, optFns...)
+	c.log("ListPolicyTags", err, "policy_arn", aws.ToString(params.PolicyArn))
+	return out, err
+}
+
+func (c *LoggingClient) ListPolicies(ctx context.Context, params *iam.ListPoliciesInput, optFns ...func(*iam.Options)) (*iam.ListPoliciesOutput, error) {
+	out, err := c.IAMClient.ListPolicies(ctx, params, optFns...)
+	c.log("ListPolicies", err, "path_prefix", aws.ToString(params.PathPrefix), "scope", string(params.Scope))
+	return out, err
+}
+
+func (c *LoggingClient) CreatePolicy(ctx context.Context, params *iam.CreatePolicyInput, optFns ...func(*iam.Options)) (*iam.CreatePolicyOutput, error) {
+	out, err := c.IAMClient.CreatePolicy(ctx, params, optFns...)
+	c.log("CreatePolicy", err, "policy", aws.ToString(params.PolicyName))
+	return out, err
+}
+
+func (c *LoggingClient) CreatePolicyVersion(ctx context.Context, params *iam.CreatePolicyVersionInput, optFns ...func(*iam.Options)) (*iam.CreatePolicyVersionOutput, error) {
+	out, err := c.IAMClient.CreatePolicyVersion(ctx, params, optFns...)
+	c.log("CreatePolicyVersion", err, "policy_arn", aws.ToString(params.PolicyArn))
+	return out, err
+}
+
+func (c *LoggingClient) DeletePolicyVersion(ctx context.Context, params *iam.DeletePolicyVersionInput, optFns ...func(*iam.Options)) (*iam.DeletePolicyVersionOutput, error) {
+	out, err := c.IAMClient.DeletePolicyVersion(ctx, params, optFns...)
+	c.log("DeletePolicyVersion", err, "policy_arn", aws.ToString(params.PolicyArn), "version", aws.ToString(params.VersionId))
+	return out, err
+}
+
+func (c *LoggingClient) DeletePolicy(ctx context.Context, params *iam.DeletePolicyInput, optFns ...func(*iam.Options)) (*iam.DeletePolicyOutput, error) {
+	out, err := c.IAMClient.DeletePolicy(ctx, params, optFns...)
+	c.log("DeletePolicy", err, "policy_arn", aws.ToString(params.PolicyArn))
+	return out, err
+}
+
+func (c *LoggingClient) GetUser(ctx context.Context, params *iam.GetUserInput, optFns ...func(*iam.Options)) (*iam.GetUserOutput, error) {
+	out, err := c.IAMClient.GetUser(ctx, params, optFns...)
+	c.log("GetUser", err, "user", aws.ToString(params.UserName))
+	return out, err
+}
+
+func (c *LoggingClient) ListUserPolicies(ctx context.Context, params *iam.ListUserPoliciesInput, optFns ...func(*iam.Options)) (*iam.ListUserPoliciesOutput, error) {
+	out, err := c.IAMClient.ListUserPolicies(ctx, params, optFns...)
+	c.log("ListUserPolicies", err, "user", aws.ToString(params.UserName))
+	if err == nil {
+		for _, policyName := range out.PolicyNames {
+			c.log("ListUserPolicies", nil, "user", aws.ToString(params.UserName), "found", policyName)
+		}
+	}
+	return out, err
+}
+
+func (c *LoggingClient) GetUserPolicy(ctx context.Context, params *iam.GetUserPolicyInput, optFns ...func(*iam.Options)) (*iam.GetUserPolicyOutput, error) {
+	out, err := c.IAMClient.GetUserPolicy(ctx, params, optFns...)
+	c.log("GetUserPolicy", err, "user", aws.ToString(params.UserName), "policy", aws.ToString(params.PolicyName))
+	return out, err
+}
+
+func (c *LoggingClient) ListAttachedUserPolicies(ctx context.Context, params *iam.ListAttachedUserPoliciesInput, optFns ...func(*iam.Options)) (*iam.ListAttachedUserPoliciesOutput, error) {
+	out, err := c.IAMClient.ListAttachedUserPolicies(ctx, params, optFns...)
+	c.log("ListAttachedUserPolicies", err, "user", aws.ToString(params.UserName), "path_prefix", aws.ToString(params.PathPrefix))
+	if err == nil {
+		for _, policy := range out.AttachedPolicies {
+			c.log("ListAttachedUserPolicies", nil, "user", aws.ToString(params.UserName), "path_prefix", aws.ToString(params.PathPrefix), "found", aws.ToString(policy.PolicyArn))
+		}
+	}
+	return out, err
+}
+
+func (c *LoggingClient) CreateUser(ctx context.Context, params *iam.CreateUserInput, optFns ...func(*iam.Options)) (*iam.CreateUserOutput, error) {
+	out, err := c.IAMClient.CreateUser(ctx, params, optFns...)
+	c.log("CreateUser", err, "user", aws.ToString(params.UserName))
+	return out, err
+}
+
+func (c *LoggingClient) PutUserPolicy(ctx context.Context, params *iam.PutUserPolicyInput, optFns ...func(*iam.Options)) (*iam.PutUserPolicyOutput, error) {
+	out, err := c.IAMClient.PutUserPolicy(ctx, params, optFns...)
+	c.log("PutUserPolicy", err, "user", aws.ToString(params.UserName), "policy", aws.ToString(params.PolicyName))
+	return out, err
+}
+
+func (c *LoggingClient) AttachUserPolicy(ctx context.Context, params *iam.AttachUserPolicyInput, optFns ...func(*iam.Options)) (*iam.AttachUserPolicyOutput, error) {
+	out, err := c.IAMClient.AttachUserPolicy(ctx, params, optFns...)
+	c.log("AttachUserPolicy", err, "user", aws.ToString(params.UserName), "policy_arn", aws.ToString(params.PolicyArn))
+	return out, err
+}
+
+func (c *LoggingClient) GetGroup(ctx context.Context, params *iam.GetGroupInput, optFns ...func(*iam.Options)) (*iam.GetGroupOutput, error) {
+	out, err := c.IAMClient.GetGroup(ctx, params, optFns...)
+	c.log("GetGroup", err, "group", aws.ToString(params.GroupName))
+	return out, err
+}
+
+func (c *LoggingClient) ListGroupPolicies(ctx context.Context, params *iam.ListGroupPoliciesInput, optFns ...func(*iam.Options)) (*iam.ListGroupPoliciesOutput, error) {
+	out, err := c.IAMClient.ListGroupPolicies(ctx, params, optFns...)
+	c.log("ListGroupPolicies", err, "group", aws.ToString(params.GroupName))
+	if err == nil {
+		for _, policyName := range out.PolicyNames {
+			c.log("ListGroupPolicies", nil, "group", aws.ToString(params.GroupName), "found", policyName)
+		}
+	}
+	return out, err
+}
+
+func (c *LoggingClient) GetGroupPolicy(ctx context.Context, params *iam.GetGroupPolicyInput, optFns ...func(*iam.Options)) (*iam.GetGroupPolicyOutput, error) {
+	out, err := c.IAMClient.GetGroupPolicy(ctx, params, optFns...)
+	c.log("GetGroupPolicy", err, "group", aws.ToString(params.GroupName), "policy", aws.ToString(params.PolicyName))
+	return out, err
+}
+
+func (c *LoggingClient) ListAttachedGroupPolicies(ctx context.Context, params *iam.ListAttachedGroupPoliciesInput, optFns ...func(*iam.Options)) (*iam.ListAttachedGroupPoliciesOutput, error) {
+	out, err := c.IAMClient.ListAttachedGroupPolicies(ctx, params, optFns...)
+	c.log("ListAttachedGroupPolicies", err, "group", aws.ToString(params.GroupName), "path_prefix", aws.ToString(params.PathPrefix))
+	if err == nil {
+		for _, policy := range out.AttachedPolicies {
+			c.log("ListAttachedGroupPolicies", nil, "group", aws.ToString(params.GroupName), "path_prefix", aws.ToString(params.PathPrefix), "found", aws.ToString(policy.PolicyArn))
+		}
+	}
+	return out, err
+}
+
+func (c *LoggingClient) CreateGroup(ctx context.Context, params *iam.CreateGroupInput, optFns ...func(*iam.Options)) (*iam.CreateGroupOutput, error) {
+	out, err := c.IAMClient.CreateGroup(ctx, params, optFns...)
+	c.log("CreateGroup", err, "group", aws.ToString(params.GroupName))
+	return out, err
+}
+
+func (c *LoggingClient) PutGroupPolicy(ctx context.Context, params *iam.PutGroupPolicyInput, optFns ...func(*iam.Options)) (*iam.PutGroupPolicyOutput, error) {
+	out, err := c.IAMClient.PutGroupPolicy(ctx, params, optFns...)
+	c.log("PutGroupPolicy", err, "group", aws.ToString(params.GroupName), "policy", aws.ToString(params.PolicyName))
+	return out, err
+}
+
+func (c *LoggingClient) AttachGroupPolicy(ctx context.Context, params *iam.AttachGroupPolicyInput, optFns ...func(*iam.Options)) (*iam.AttachGroupPolicyOutput, error) {
+	out, err := c.IAMClient.AttachGroupPolicy(ctx, params, optFns...)
+	c.log("AttachGroupPolicy", err, "group", aws.ToString(params.GroupName), "policy_arn", aws.ToString(params.PolicyArn))
+	return out, err
+}
+
+func (c *LoggingClient) AddUserToGroup(ctx context.Context, params *iam.AddUserToGroupInput, optFns ...func(*iam.Options)) (*iam.AddUserToGroupOutput, error) {
+	out, err := c.IAMClient.AddUserToGroup(ctx, params, optFns...)
+	c.log("AddUserToGroup", err, "user", aws.ToString(params.UserName), "group", aws.ToString(params.GroupName))
+	return out, err
+}
+
+func (c *LoggingClient) SimulatePrincipalPolicy(ctx context.Context, params *iam.SimulatePrincipalPolicyInput, optFns ...func(*iam.Options)) (*iam.SimulatePrincipalPolicyOutput, error) {
+	out, err := c.IAMClient.SimulatePrincipalPolicy(ctx, params, optFns...)
+	c.log("SimulatePrincipalPolicy", err)
+	return out, err
+}
@@ -0,0 +1,53 @@
+package iamdup
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestLoggingClientWritesJSONLines(t *testing.T) {
+	client := newFakeIAM("111111111111")
+	client.addRole("app", testTrust).putInline("read", testDocument)
+
+	var logs bytes.Buffer
+	logging := &LoggingClient{IAMClient: client, StructuredLogger: slog.New(slog.NewJSONHandler(&logs, nil))}
+
+	_, err := New(logging).Duplicate(context.Background(), "app", "app-copy")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	seen := make(map[string]bool)
+	for _, line := range lines {
+		var event map[string]interface{}
+		err := json.Unmarshal([]byte(line), &event)
+		if err != nil {
+			t.Fatalf("log line %q is not JSON, %v", line, err)
+		}
+
+		op, _ := event["op"].(string)
+		role, _ := event["role"].(string)
+		if op == "" || event["time"] == nil || event["level"] == nil {
+			t.Errorf("log event %v, want its op, time and level", event)
+		}
+		if event["result"] == "error" && event["error"] == nil {
+			t.Errorf("log event %v, want the error of the failed call", event)
+		}
+		seen[op+" "+role] = true
+
+		if event["op"] == "PutRolePolicy" && event["policy"] != "read" {
+			t.Errorf("PutRolePolicy event %v, want policy read", event)
+		}
+	}
+
+	for _, want := range []string{"GetRole app", "CreateRole app-copy", "PutRolePolicy app-copy"} {
+		if !seen[want] {
+			t.Errorf("no log event for %s in %q", want, lines)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package iamdup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrPolicyCollision is returned by MergeSnapshots when two source roles
+// have an inline policy with the same name and collisions are not allowed.
+var ErrPolicyCollision = errors.New("inline policy name used by several source roles")
+
+// MergeSnapshots returns a snapshot holding the union of the inline and
+// managed policies of snapshots. Every other attribute, including the
+// assume role policy document and the tags, comes from the snapshot of
+// the role named trustFrom, or from the first snapshot when it is empty.
+//
+// An inline policy name used by several snapshots is prefixed with the
+// name of its role in each of them, unless failOnCollision is set, in
+// which case ErrPolicyCollision is returned. ErrPolicyCollision is returned
+// as well when a prefixed name is still used by another policy.
+func MergeSnapshots(snapshots []*Snapshot, trustFrom string, failOnCollision bool) (*Snapshot, error) {
+	if len(snapshots) == 0 {
+		return nil, errors.New("no source role to merge")
+	}
+
+	base := snapshots[0]
+	if trustFrom != "" {
+		base = nil
+		for _, snapshot := range snapshots {
+			if snapshot.RoleName == trustFrom {
+				base = snapshot
+				break
+			}
+		}
+
+		if base == nil {
+			return nil, fmt.Errorf("trust-from role %s is not one of the source roles", trustFrom)
+		}
+	}
+
+	owners := make(map[string][]string)
+	for _, snapshot := range snapshots {
+		for _, policy := range snapshot.InlinePolicies {
+			owners[policy.Name] = append(owners[policy.Name], snapshot.RoleName)
+		}
+	}
+
+	merged := *base
+	merged.InlinePolicies = nil
+	merged.ManagedPolicies = nil
+	merged.InstanceProfiles = nil
+	merged.LastUsed = nil
+
+	names := make(map[string]bool)
+	attached := make(map[string]bool)
+	for _, snapshot := range snapshots {
+		for _, policy := range snapshot.InlinePolicies {
+			if len(owners[policy.Name]) > 1 {
+				if failOnCollision {
+					return nil, fmt.Errorf("inline policy %s of roles %v: %w", policy.Name, owners[policy.Name], ErrPolicyCollision)
+				}
+
+				prefixed := snapshot.RoleName + "-" + policy.Name
+				err := ValidatePolicyName(prefixed)
+				if err != nil {
+					return nil, fmt.Errorf("invalid name for inline policy %s of role %s, %w", policy.Name, snapshot.RoleName, err)
+				}
+				policy.Name = prefixed
+			}
+
+			if names[policy.Name] {
+				return nil, fmt.Errorf("inline policy %s of role %s is named like another merged policy: %w", policy.Name, snapshot.RoleName, ErrPolicyCollision)
+			}
+			names[policy.Name] = true
+
+			merged.InlinePolicies = append(merged.InlinePolicies, policy)
+		}
+
+		for _, policy := range snapshot.ManagedPolicies {
+			if attached[policy.Arn] {
+				continue
+			}
+			attached[policy.Arn] = true
+			merged.ManagedPolicies = append(merged.ManagedPolicies, policy)
+		}
+	}
+
+	return &merged, nil
+}
+
+// DuplicateMerged creates targetRoleName with the policies of every role of
+// sourceRoleNames, merged with MergeSnapshots using TrustFrom and
+// FailOnCollision.
+func (d *Duplicator) DuplicateMerged(ctx context.Context, sourceRoleNames []string, targetRoleName string) (*Result, error) {
+	err := ValidateRoleName(targetRoleName)
+	if err != nil {
+		return nil, err
+	}
+
+	err = d.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := make([]*Snapshot, 0, len(sourceRoleNames))
+	for _, sourceRoleName := range sourceRoleNames {
+		snapshot, err := d.Snapshot(ctx, sourceRoleName)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+
+	snapshot, err := MergeSnapshots(snapshots, d.TrustFrom, d.FailOnCollision)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.applyAttempts(ctx, snapshot, targetRoleName)
+}
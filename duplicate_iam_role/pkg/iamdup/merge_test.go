@@ -0,0 +1,127 @@
+package iamdup
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// mergeSource returns the snapshot of roleName with inline policies named
+// inlineNames and the managed policies managedArns.
+func mergeSource(roleName string, trust string, inlineNames []string, managedArns []string) *Snapshot {
+	snapshot := &Snapshot{Version: SnapshotVersion, RoleName: roleName, AssumeRolePolicyDocument: json.RawMessage(trust)}
+	for _, policyName := range inlineNames {
+		snapshot.InlinePolicies = append(snapshot.InlinePolicies, InlinePolicy{Name: policyName, Document: json.RawMessage(testDocument)})
+	}
+	for _, policyArn := range managedArns {
+		snapshot.ManagedPolicies = append(snapshot.ManagedPolicies, ManagedPolicy{Name: policyArn[strings.LastIndex(policyArn, "/")+1:], Arn: policyArn})
+	}
+	return snapshot
+}
+
+func TestMergeSnapshots(t *testing.T) {
+	otherTrust := `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"Service":"lambda.amazonaws.com"},"Action":"sts:AssumeRole"}]}`
+
+	tests := []struct {
+		name            string
+		snapshots       []*Snapshot
+		trustFrom       string
+		failOnCollision bool
+		wantInline      []string
+		wantManaged     []string
+		wantTrust       string
+		wantErr         error
+	}{
+		{
+			name: "union",
+			snapshots: []*Snapshot{
+				mergeSource("web", testTrust, []string{"read"}, []string{"arn:aws:iam::aws:policy/ReadOnlyAccess"}),
+				mergeSource("worker", otherTrust, []string{"write"}, []string{"arn:aws:iam::aws:policy/ReadOnlyAccess", "arn:aws:iam::aws:policy/AmazonSQSFullAccess"}),
+			},
+			wantInline:  []string{"read", "write"},
+			wantManaged: []string{"arn:aws:iam::aws:policy/ReadOnlyAccess", "arn:aws:iam::aws:policy/AmazonSQSFullAccess"},
+			wantTrust:   testTrust,
+		},
+		{
+			name: "trust from",
+			snapshots: []*Snapshot{
+				mergeSource("web", testTrust, []string{"read"}, nil),
+				mergeSource("worker", otherTrust, nil, nil),
+			},
+			trustFrom:  "worker",
+			wantInline: []string{"read"},
+			wantTrust:  otherTrust,
+		},
+		{
+			name: "collision prefixed",
+			snapshots: []*Snapshot{
+				mergeSource("web", testTrust, []string{"access", "read"}, nil),
+				mergeSource("worker", otherTrust, []string{"access"}, nil),
+			},
+			wantInline: []string{"web-access", "read", "worker-access"},
+			wantTrust:  testTrust,
+		},
+		{
+			name: "fail on collision",
+			snapshots: []*Snapshot{
+				mergeSource("web", testTrust, []string{"access"}, nil),
+				mergeSource("worker", otherTrust, []string{"access"}, nil),
+			},
+			failOnCollision: true,
+			wantErr:         ErrPolicyCollision,
+		},
+		{
+			name: "prefixed name collides again",
+			snapshots: []*Snapshot{
+				mergeSource("web", testTrust, []string{"access"}, nil),
+				mergeSource("worker", otherTrust, []string{"access", "web-access"}, nil),
+			},
+			wantErr: ErrPolicyCollision,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged, err := MergeSnapshots(tt.snapshots, tt.trustFrom, tt.failOnCollision)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("MergeSnapshots error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+
+			var inline, managed []string
+			for _, policy := range merged.InlinePolicies {
+				inline = append(inline, policy.Name)
+			}
+			for _, policy := range merged.ManagedPolicies {
+				managed = append(managed, policy.Arn)
+			}
+
+			if !reflect.DeepEqual(inline, tt.wantInline) {
+				t.Errorf("inline policies = %q, want %q", inline, tt.wantInline)
+			}
+			if !reflect.DeepEqual(managed, tt.wantManaged) {
+				t.Errorf("managed policies = %q, want %q", managed, tt.wantManaged)
+			}
+			if string(merged.AssumeRolePolicyDocument) != tt.wantTrust {
+				t.Errorf("assume role policy document = %s, want %s", merged.AssumeRolePolicyDocument, tt.wantTrust)
+			}
+		})
+	}
+}
+
+func TestMergeSnapshotsValidatesPrefixedName(t *testing.T) {
+	roleName := strings.Repeat("r", MaxRoleNameLength)
+	policyName := strings.Repeat("p", MaxPolicyNameLength-10)
+
+	_, err := MergeSnapshots([]*Snapshot{
+		mergeSource(roleName, testTrust, []string{policyName}, nil),
+		mergeSource("worker", testTrust, []string{policyName}, nil),
+	}, "", false)
+	if err == nil || !strings.Contains(err.Error(), "must be between 1 and") {
+		t.Errorf("MergeSnapshots error = %v, want the prefixed name rejected as too long", err)
+	}
+}
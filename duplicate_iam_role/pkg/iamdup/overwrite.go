@@ -0,0 +1,142 @@
+package iamdup
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+)
+
+// overwrite converges an existing target role onto the source definition.
+func (d *Duplicator) overwrite(ctx context.Context, client IAMClient, snapshot *Snapshot, targetRoleName string) error {
+	err := UpdateAssumeRolePolicy(ctx, client, snapshot, targetRoleName)
+	if err != nil {
+		return fmt.Errorf("unable to update assume role policy, %w", err)
+	}
+
+	if !d.SkipInlinePolicies {
+		err = ReplaceInlinePolicies(ctx, client, targetRoleName, snapshot.InlinePolicies, d.Progress)
+		if err != nil {
+			return fmt.Errorf("unable to replace inline policies, %w", err)
+		}
+	}
+
+	if !d.SkipManagedPolicies {
+		err = ReconcileManagedPolicies(ctx, client, targetRoleName, snapshot.ManagedPolicies, d.Concurrency, d.Progress)
+		if err != nil {
+			return fmt.Errorf("unable to reconcile managed policies, %w", err)
+		}
+	}
+
+	if d.CopyInstanceProfile {
+		err = d.copyInstanceProfile(ctx, client, snapshot, targetRoleName)
+		if err != nil {
+			return fmt.Errorf("unable to copy instance profile, %w", err)
+		}
+	}
+
+	return nil
+}
+
+func RoleExists(ctx context.Context, client IAMClient, roleName string) (bool, error) {
+	_, err := GetRole(ctx, client, roleName)
+	if IsNoSuchEntity(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func UpdateAssumeRolePolicy(ctx context.Context, client IAMClient, snapshot *Snapshot, targetRoleName string) error {
+	assumeRolePolicyDocument := string(snapshot.AssumeRolePolicyDocument)
+
+	params := iam.UpdateAssumeRolePolicyInput{
+		RoleName:       &targetRoleName,
+		PolicyDocument: &assumeRolePolicyDocument,
+	}
+
+	_, err := client.UpdateAssumeRolePolicy(ctx, &params)
+	if err != nil {
+		return &OpError{Op: "UpdateAssumeRolePolicy", RoleName: targetRoleName, Err: err}
+	}
+
+	return nil
+}
+
+// ReplaceInlinePolicies deletes the inline policies of targetRoleName that
+// are not part of inlinePolicies, then puts every policy in inlinePolicies.
+func ReplaceInlinePolicies(ctx context.Context, client IAMClient, targetRoleName string, inlinePolicies []InlinePolicy, progress Progress) error {
+	existingPolicyNames, err := ListInlinePolicyNames(ctx, client, targetRoleName)
+	if err != nil {
+		return err
+	}
+
+	wanted := make(map[string]bool, len(inlinePolicies))
+	for _, policy := range inlinePolicies {
+		wanted[policy.Name] = true
+	}
+
+	for _, policyName := range existingPolicyNames {
+		if wanted[policyName] {
+			continue
+		}
+
+		params := iam.DeleteRolePolicyInput{
+			RoleName:   &targetRoleName,
+			PolicyName: &policyName,
+		}
+
+		_, err = client.DeleteRolePolicy(ctx, &params)
+		if err != nil {
+			return &OpError{Op: "DeleteRolePolicy", RoleName: targetRoleName, PolicyName: policyName, Err: err}
+		}
+	}
+
+	return AddInlinePolicies(ctx, client, targetRoleName, inlinePolicies, progress)
+}
+
+// ReconcileManagedPolicies detaches the managed policies of targetRoleName
+// that are not part of managedPolicies and attaches the missing ones, at
+// most concurrency at once.
+func ReconcileManagedPolicies(ctx context.Context, client IAMClient, targetRoleName string, managedPolicies []ManagedPolicy, concurrency int, progress Progress) error {
+	attachedPolicies, err := GetManagedPolicies(ctx, client, targetRoleName)
+	if err != nil {
+		return err
+	}
+
+	wanted := make(map[string]bool, len(managedPolicies))
+	for _, policy := range managedPolicies {
+		wanted[policy.Arn] = true
+	}
+
+	attached := make(map[string]bool, len(attachedPolicies))
+	for _, policy := range attachedPolicies {
+		attached[*policy.PolicyArn] = true
+
+		if wanted[*policy.PolicyArn] {
+			continue
+		}
+
+		params := iam.DetachRolePolicyInput{
+			RoleName:  &targetRoleName,
+			PolicyArn: policy.PolicyArn,
+		}
+
+		_, err = client.DetachRolePolicy(ctx, &params)
+		if err != nil {
+			return &OpError{Op: "DetachRolePolicy", RoleName: targetRoleName, PolicyName: *policy.PolicyArn, Err: err}
+		}
+	}
+
+	var missingPolicies []ManagedPolicy
+	for _, policy := range managedPolicies {
+		if !attached[policy.Arn] {
+			missingPolicies = append(missingPolicies, policy)
+		}
+	}
+
+	return AddManagedPolicies(ctx, client, targetRoleName, missingPolicies, concurrency, progress)
+}
@@ -0,0 +1,79 @@
+package iamdup
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Partitions are the AWS partitions an ARN can be rewritten to.
+var Partitions = []string{"aws", "aws-cn", "aws-us-gov", "aws-iso", "aws-iso-b"}
+
+// ValidatePartition checks that partition is a known AWS partition.
+func ValidatePartition(partition string) error {
+	for _, known := range Partitions {
+		if partition == known {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown partition %q, expected one of %s", partition, strings.Join(Partitions, ", "))
+}
+
+// RewriteArnPartition returns arn with its partition replaced. Strings that
+// are not ARNs of a known partition are returned unchanged.
+func RewriteArnPartition(arn string, partition string) string {
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) != 6 || parts[0] != "arn" || parts[2] == "" || ValidatePartition(parts[1]) != nil {
+		return arn
+	}
+
+	parts[1] = partition
+	return strings.Join(parts, ":")
+}
+
+// RewriteDocumentPartition rewrites the partition of every ARN found in the
+// string values of document. The document is returned as is when it holds
+// no ARN to rewrite.
+func RewriteDocumentPartition(document json.RawMessage, partition string) (json.RawMessage, error) {
+	decoder := json.NewDecoder(bytes.NewReader(document))
+	decoder.UseNumber()
+
+	var parsed interface{}
+	err := decoder.Decode(&parsed)
+	if err != nil {
+		return nil, fmt.Errorf("document is not valid JSON, %w", err)
+	}
+
+	rewritten, changed := rewritePartition(parsed, partition)
+	if !changed {
+		return document, nil
+	}
+
+	return encodeJSON(rewritten)
+}
+
+func rewritePartition(value interface{}, partition string) (interface{}, bool) {
+	changed := false
+
+	switch v := value.(type) {
+	case string:
+		rewritten := RewriteArnPartition(v, partition)
+		return rewritten, rewritten != v
+	case []interface{}:
+		for i := range v {
+			var elementChanged bool
+			v[i], elementChanged = rewritePartition(v[i], partition)
+			changed = changed || elementChanged
+		}
+	case map[string]interface{}:
+		for key := range v {
+			var elementChanged bool
+			v[key], elementChanged = rewritePartition(v[key], partition)
+			changed = changed || elementChanged
+		}
+	}
+
+	return value, changed
+}
@@ -0,0 +1,102 @@
+package iamdup
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestRewriteArnPartition(t *testing.T) {
+	tests := []struct {
+		arn  string
+		want string
+	}{
+		{"arn:aws:iam::aws:policy/ReadOnlyAccess", "arn:aws-us-gov:iam::aws:policy/ReadOnlyAccess"},
+		{"arn:aws:iam::123456789012:role/path/app", "arn:aws-us-gov:iam::123456789012:role/path/app"},
+		{"arn:aws:s3:::bucket/key:with:colons", "arn:aws-us-gov:s3:::bucket/key:with:colons"},
+		{"arn:aws-cn:iam::123456789012:root", "arn:aws-us-gov:iam::123456789012:root"},
+		{"arn:unknown:iam::123456789012:root", "arn:unknown:iam::123456789012:root"},
+		{"ec2.amazonaws.com", "ec2.amazonaws.com"},
+		{"*", "*"},
+	}
+
+	for _, tt := range tests {
+		if got := RewriteArnPartition(tt.arn, "aws-us-gov"); got != tt.want {
+			t.Errorf("RewriteArnPartition(%q) = %q, want %q", tt.arn, got, tt.want)
+		}
+	}
+}
+
+func TestRewriteDocumentPartition(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		want     string
+	}{
+		{
+			name:     "scalar principal",
+			document: `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"AWS":"arn:aws:iam::123456789012:root"},"Action":"sts:AssumeRole"}]}`,
+			want:     `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"AWS":"arn:aws-us-gov:iam::123456789012:root"},"Action":"sts:AssumeRole"}]}`,
+		},
+		{
+			name:     "principal array and condition",
+			document: `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"AWS":["arn:aws:iam::123456789012:role/a","arn:aws:iam::210987654321:root"]},"Action":"sts:AssumeRole","Condition":{"ArnLike":{"aws:SourceArn":"arn:aws:sns:us-east-1:123456789012:topic"}}}]}`,
+			want:     `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"AWS":["arn:aws-us-gov:iam::123456789012:role/a","arn:aws-us-gov:iam::210987654321:root"]},"Action":"sts:AssumeRole","Condition":{"ArnLike":{"aws:SourceArn":"arn:aws-us-gov:sns:us-east-1:123456789012:topic"}}}]}`,
+		},
+		{
+			name:     "no ARN",
+			document: testTrust,
+			want:     testTrust,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := RewriteDocumentPartition(json.RawMessage(tt.document), "aws-us-gov")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			equal, err := EqualDocuments(got, json.RawMessage(tt.want))
+			if err != nil || !equal {
+				t.Errorf("RewriteDocumentPartition() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	_, err := RewriteDocumentPartition(json.RawMessage(`{"Statement":`), "aws-us-gov")
+	if err == nil {
+		t.Error("RewriteDocumentPartition() of invalid JSON succeeded, want an error")
+	}
+}
+
+func TestDuplicateRewritesPartition(t *testing.T) {
+	trust := `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"AWS":"arn:aws:iam::123456789012:root"},"Action":"sts:AssumeRole"}]}`
+
+	client := newFakeIAM("111111111111")
+	source := client.addRole("app", trust)
+	source.attach("ReadOnlyAccess", "arn:aws:iam::aws:policy/ReadOnlyAccess")
+
+	d := New(client)
+	d.TargetPartition = "aws-us-gov"
+
+	_, err := d.Duplicate(context.Background(), "app", "app-copy")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	document, err := url.PathUnescape(*client.roles["app-copy"].role.AssumeRolePolicyDocument)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"AWS":"arn:aws-us-gov:iam::123456789012:root"},"Action":"sts:AssumeRole"}]}`
+	if equal, err := EqualDocuments(json.RawMessage(document), json.RawMessage(want)); err != nil || !equal {
+		t.Errorf("assume role policy document = %s, want %s", document, want)
+	}
+
+	if got, want := client.attachedArns("app-copy"), []string{"arn:aws-us-gov:iam::aws:policy/ReadOnlyAccess"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("attached policies = %q, want %q", got, want)
+	}
+}
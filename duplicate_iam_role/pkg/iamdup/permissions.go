@@ -0,0 +1,140 @@
+package iamdup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+// ErrMissingPermissions is returned by CheckPermissions when the target
+// credentials are not allowed some of the actions of the duplication.
+var ErrMissingPermissions = errors.New("missing permissions")
+
+// PrincipalArn returns the ARN of the IAM entity behind callerArn, as
+// returned by sts get-caller-identity. An assumed role session such as
+// arn:aws:sts::123456789012:assumed-role/Admin/session becomes
+// arn:aws:iam::123456789012:role/Admin. Role paths are not part of session
+// ARNs, so roles with a path other than / cannot be resolved this way.
+func PrincipalArn(callerArn string) string {
+	parts := strings.SplitN(callerArn, ":", 6)
+	if len(parts) != 6 || parts[2] != "sts" || !strings.HasPrefix(parts[5], "assumed-role/") {
+		return callerArn
+	}
+
+	roleName := strings.SplitN(strings.TrimPrefix(parts[5], "assumed-role/"), "/", 2)[0]
+	return fmt.Sprintf("arn:%s:iam::%s:role/%s", parts[1], parts[4], roleName)
+}
+
+// requiredActions returns the IAM actions a duplication with the
+// duplicator's options makes in the target account, following the calls of
+// apply and of the rollback, without repeats.
+func (d *Duplicator) requiredActions() []string {
+	// Tags given to CreateRole and CreatePolicy need iam:TagRole and
+	// iam:TagPolicy as well.
+	actions := []string{"iam:GetRole", "iam:CreateRole", "iam:TagRole", "iam:PutRolePolicy", "iam:AttachRolePolicy"}
+
+	if len(d.AttachPolicies) > 0 {
+		actions = append(actions, "iam:ListPolicies")
+	}
+
+	if d.SkipMissingPolicies {
+		actions = append(actions, "iam:GetPolicy")
+	}
+
+	if d.CloneManagedPolicies || d.CopyBoundaryPolicy {
+		actions = append(actions, "iam:CreatePolicy", "iam:TagPolicy")
+		if d.CloneAllPolicyVersions {
+			actions = append(actions, "iam:CreatePolicyVersion")
+		}
+	}
+
+	if d.Overwrite {
+		actions = append(actions, "iam:UpdateAssumeRolePolicy", "iam:ListRolePolicies", "iam:DeleteRolePolicy", "iam:ListAttachedRolePolicies", "iam:DetachRolePolicy")
+	}
+
+	if d.CopyInstanceProfile {
+		actions = append(actions, "iam:ListInstanceProfilesForRole", "iam:CreateInstanceProfile", "iam:AddRoleToInstanceProfile")
+	}
+
+	if d.Verify {
+		actions = append(actions, "iam:ListAttachedRolePolicies", "iam:ListRolePolicies", "iam:GetRolePolicy")
+	}
+
+	if d.RollbackOnError {
+		actions = append(actions, "iam:DetachRolePolicy", "iam:DeleteRolePolicy", "iam:DeleteRole")
+		if d.CopyInstanceProfile {
+			actions = append(actions, "iam:RemoveRoleFromInstanceProfile", "iam:DeleteInstanceProfile")
+		}
+		if d.CloneManagedPolicies || d.CopyBoundaryPolicy {
+			actions = append(actions, "iam:DeletePolicyVersion", "iam:DeletePolicy")
+		}
+	}
+
+	seen := make(map[string]bool, len(actions))
+	unique := actions[:0]
+	for _, action := range actions {
+		if !seen[action] {
+			seen[action] = true
+			unique = append(unique, action)
+		}
+	}
+
+	return unique
+}
+
+// CheckPermissions simulates, with SimulatePrincipalPolicy, the actions a
+// duplication makes through Target for principalArn, the IAM user or role
+// of the target credentials. It returns ErrMissingPermissions naming the
+// denied actions. Resource-level conditions and permissions boundaries of
+// the resources themselves are not taken into account.
+func (d *Duplicator) CheckPermissions(ctx context.Context, principalArn string) error {
+	params := iam.SimulatePrincipalPolicyInput{
+		PolicySourceArn: &principalArn,
+		ActionNames:     d.requiredActions(),
+	}
+
+	var denied []string
+	for {
+		out, err := d.Target.SimulatePrincipalPolicy(ctx, &params)
+		if err != nil {
+			return &OpError{Op: "SimulatePrincipalPolicy", Err: err}
+		}
+
+		for _, result := range out.EvaluationResults {
+			if result.EvalDecision != types.PolicyEvaluationDecisionTypeAllowed {
+				denied = append(denied, *result.EvalActionName)
+			}
+		}
+
+		if !out.IsTruncated {
+			break
+		}
+
+		if out.Marker == nil {
+			return fmt.Errorf("SimulatePrincipalPolicy returned a truncated page without a marker")
+		}
+		params.Marker = out.Marker
+	}
+
+	if len(denied) > 0 {
+		return fmt.Errorf("%s is not allowed %s: %w", principalArn, strings.Join(denied, ", "), ErrMissingPermissions)
+	}
+
+	return nil
+}
+
+// DeniedAction returns the IAM action, such as iam:CreateRole, of the call
+// that caused err when it failed for missing permissions, or an empty
+// string otherwise.
+func DeniedAction(err error) string {
+	var opErr *OpError
+	if !IsAccessDenied(err) || !errors.As(err, &opErr) {
+		return ""
+	}
+
+	return "iam:" + opErr.Op
+}
@@ -0,0 +1,114 @@
+package iamdup
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/smithy-go"
+)
+
+func TestRequiredActionsCoverTargetCalls(t *testing.T) {
+	tests := []struct {
+		name    string
+		options func(d *Duplicator)
+		setup   func(source *fakeRole, target *fakeIAM)
+	}{
+		{
+			name:    "create",
+			options: func(d *Duplicator) { d.Verify = true },
+		},
+		{
+			name: "overwrite",
+			options: func(d *Duplicator) {
+				d.Overwrite = true
+				d.Verify = true
+			},
+			setup: func(source *fakeRole, target *fakeIAM) {
+				role := target.addRole("app", testTrust)
+				role.putInline("stale", testDocument)
+				role.attach("PowerUserAccess", "arn:aws:iam::aws:policy/PowerUserAccess")
+			},
+		},
+		{
+			name: "clone and roll back",
+			options: func(d *Duplicator) {
+				d.CloneManagedPolicies = true
+				d.RollbackOnError = true
+			},
+			setup: func(source *fakeRole, target *fakeIAM) {
+				source.attach("app-access", "arn:aws:iam::111111111111:policy/app-access")
+				target.fail = func(op string, name string) error {
+					if op == "AttachRolePolicy" {
+						return errors.New("internal failure")
+					}
+					return nil
+				}
+			},
+		},
+		{
+			name:    "skip missing policies",
+			options: func(d *Duplicator) { d.SkipMissingPolicies = true },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newFakeIAM("111111111111")
+			client.addPolicy("app-access", testDocument)
+			source := client.addRole("app", testTrust)
+			source.putInline("read", testDocument)
+			source.attach("ReadOnlyAccess", "arn:aws:iam::aws:policy/ReadOnlyAccess")
+
+			target := newFakeIAM("222222222222")
+			if tt.setup != nil {
+				tt.setup(source, target)
+			}
+
+			d := New(client)
+			d.Target = target
+			tt.options(d)
+
+			// Failures are part of some cases, only the calls matter.
+			_, _ = d.Duplicate(context.Background(), "app", "app")
+
+			required := make(map[string]bool)
+			for _, action := range d.requiredActions() {
+				required[action] = true
+			}
+			for _, call := range target.calls {
+				action := "iam:" + strings.Fields(call)[0]
+				if !required[action] {
+					t.Errorf("%s is called but not in requiredActions() = %q", action, d.requiredActions())
+				}
+			}
+		})
+	}
+}
+
+func TestDeniedActionIsRequired(t *testing.T) {
+	client := newFakeIAM("111111111111")
+	client.addRole("app", testTrust)
+	client.fail = func(op string, name string) error {
+		if op == "CreateRole" {
+			return &smithy.GenericAPIError{Code: "AccessDenied", Message: "not authorized to perform iam:CreateRole"}
+		}
+		return nil
+	}
+
+	d := New(client)
+	_, err := d.Duplicate(context.Background(), "app", "app-copy")
+
+	action := DeniedAction(err)
+	if action != "iam:CreateRole" {
+		t.Fatalf("DeniedAction() = %q, want iam:CreateRole", action)
+	}
+
+	for _, required := range d.requiredActions() {
+		if required == action {
+			return
+		}
+	}
+	t.Errorf("requiredActions() = %q, want %s", d.requiredActions(), action)
+}
@@ -0,0 +1,376 @@
+package iamdup
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+// GetPolicyDocument returns a managed policy together with the decoded
+// document of its version versionID, or of its default version when
+// versionID is empty.
+func GetPolicyDocument(ctx context.Context, client IAMClient, policyArn string, versionID string) (*types.Policy, string, error) {
+	policy, err := client.GetPolicy(ctx, &iam.GetPolicyInput{
+		PolicyArn: &policyArn,
+	})
+	if err != nil {
+		return nil, "", &OpError{Op: "GetPolicy", PolicyName: policyArn, Err: err}
+	}
+
+	if versionID == "" {
+		versionID = *policy.Policy.DefaultVersionId
+	}
+
+	version, err := client.GetPolicyVersion(ctx, &iam.GetPolicyVersionInput{
+		PolicyArn: &policyArn,
+		VersionId: &versionID,
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("version %s, %w", versionID, &OpError{Op: "GetPolicyVersion", PolicyName: policyArn, Err: err})
+	}
+
+	document, err := decodeDocument(*version.PolicyVersion.Document)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid document in policy %s, %w", policyArn, err)
+	}
+
+	return policy.Policy, string(document), nil
+}
+
+// ClonePolicy reads the customer managed policy policyArn through source
+// and creates a policy with the same name, path, description, tags and
+// document through target. The document is the one of version versionID,
+// or of the default version when versionID is empty. It returns the ARN of
+// the new policy.
+func ClonePolicy(ctx context.Context, source IAMClient, target IAMClient, policyArn string, versionID string) (string, error) {
+	params, err := clonePolicyInput(ctx, source, policyArn, versionID)
+	if err != nil {
+		return "", err
+	}
+
+	return createPolicy(ctx, target, policyArn, params)
+}
+
+// clonePolicyInput builds the CreatePolicyInput copying the customer
+// managed policy policyArn, read through source, at version versionID or
+// its default version.
+func clonePolicyInput(ctx context.Context, source IAMClient, policyArn string, versionID string) (*iam.CreatePolicyInput, error) {
+	policy, document, err := GetPolicyDocument(ctx, source, policyArn, versionID)
+	if err != nil {
+		return nil, err
+	}
+
+	tags, err := GetPolicyTags(ctx, source, policyArn)
+	if err != nil {
+		return nil, err
+	}
+
+	return &iam.CreatePolicyInput{
+		PolicyName:     policy.PolicyName,
+		Path:           policy.Path,
+		Description:    policy.Description,
+		PolicyDocument: &document,
+		Tags:           tags,
+	}, nil
+}
+
+// createPolicy creates the copy of policyArn described by params through
+// target and returns its ARN.
+func createPolicy(ctx context.Context, target IAMClient, policyArn string, params *iam.CreatePolicyInput) (string, error) {
+	created, err := target.CreatePolicy(ctx, params)
+	if IsEntityAlreadyExists(err) {
+		return "", fmt.Errorf("failed to clone policy %s, a policy named %s already exists in the target account, %w", policyArn, *params.PolicyName, &OpError{Op: "CreatePolicy", PolicyName: *params.PolicyName, Err: err})
+	} else if err != nil {
+		return "", fmt.Errorf("failed to clone policy %s, %w", policyArn, &OpError{Op: "CreatePolicy", PolicyName: *params.PolicyName, Err: err})
+	}
+
+	return *created.Policy.Arn, nil
+}
+
+// DuplicatePolicy creates a copy of the customer managed policy
+// sourcePolicy, given by name or ARN, through Target. The copy keeps the
+// source name unless targetPolicyName is set, and its path unless Path is
+// set. Non-default versions are copied with CloneAllPolicyVersions. It
+// returns the ARN of the new policy, empty in a dry run.
+func (d *Duplicator) DuplicatePolicy(ctx context.Context, sourcePolicy string, targetPolicyName string) (string, error) {
+	err := d.Validate()
+	if err != nil {
+		return "", err
+	}
+
+	sourceArn, err := d.sourcePolicyArn(ctx, sourcePolicy)
+	if err != nil {
+		return "", fmt.Errorf("unable to resolve source policy, %w", err)
+	}
+
+	if IsAWSManagedPolicy(sourceArn) {
+		return "", fmt.Errorf("policy %s is managed by AWS and already exists in every account", sourceArn)
+	}
+
+	params, err := clonePolicyInput(ctx, d.Client, sourceArn, "")
+	if err != nil {
+		return "", fmt.Errorf("unable to read source policy, %w", err)
+	}
+
+	if targetPolicyName != "" {
+		params.PolicyName = &targetPolicyName
+	}
+
+	if d.Path != "" {
+		params.Path = &d.Path
+	}
+
+	if d.DryRun {
+		fmt.Fprintf(d.Out, "[dry-run] create policy %s\n", *params.PolicyName)
+		fmt.Fprintf(d.Out, "[dry-run]   document: %s\n", *params.PolicyDocument)
+		for _, tag := range params.Tags {
+			fmt.Fprintf(d.Out, "[dry-run]   tag %s=%s\n", *tag.Key, *tag.Value)
+		}
+		return "", nil
+	}
+
+	err = d.confirm(ctx, "create policy "+*params.PolicyName)
+	if err != nil {
+		return "", err
+	}
+
+	policyArn, err := createPolicy(ctx, d.Target, sourceArn, params)
+	if err != nil {
+		return "", err
+	}
+
+	if d.CloneAllPolicyVersions {
+		err = ClonePolicyVersions(ctx, d.Client, d.Target, sourceArn, policyArn)
+		if err != nil {
+			return policyArn, err
+		}
+	}
+
+	return policyArn, nil
+}
+
+// MaxPolicyVersions is the number of versions IAM keeps for a managed
+// policy.
+const MaxPolicyVersions = 5
+
+// ClonePolicyVersions copies the non-default versions of sourceArn, read
+// through source, onto targetArn, oldest first, through target. targetArn
+// is expected to hold only the default version, as created by ClonePolicy,
+// and it stays the default.
+func ClonePolicyVersions(ctx context.Context, source IAMClient, target IAMClient, sourceArn string, targetArn string) error {
+	versions, err := ListPolicyVersions(ctx, source, sourceArn)
+	if err != nil {
+		return err
+	}
+
+	sort.SliceStable(versions, func(i, j int) bool {
+		return aws.ToTime(versions[i].CreateDate).Before(aws.ToTime(versions[j].CreateDate))
+	})
+
+	copied := 1
+	for _, version := range versions {
+		if version.IsDefaultVersion {
+			continue
+		}
+
+		policyVersion, err := source.GetPolicyVersion(ctx, &iam.GetPolicyVersionInput{
+			PolicyArn: &sourceArn,
+			VersionId: version.VersionId,
+		})
+		if err != nil {
+			return fmt.Errorf("version %s, %w", *version.VersionId, &OpError{Op: "GetPolicyVersion", PolicyName: sourceArn, Err: err})
+		}
+
+		document, err := decodeDocument(*policyVersion.PolicyVersion.Document)
+		if err != nil {
+			return fmt.Errorf("invalid document in policy %s version %s, %w", sourceArn, *version.VersionId, err)
+		}
+
+		policyDocument := string(document)
+		_, err = target.CreatePolicyVersion(ctx, &iam.CreatePolicyVersionInput{
+			PolicyArn:      &targetArn,
+			PolicyDocument: &policyDocument,
+			SetAsDefault:   false,
+		})
+		if IsLimitExceeded(err) {
+			return fmt.Errorf("policy %s reached the limit of %d versions after %d of %d were copied, %w", targetArn, MaxPolicyVersions, copied, len(versions), &OpError{Op: "CreatePolicyVersion", PolicyName: targetArn, Err: err})
+		} else if err != nil {
+			return fmt.Errorf("version %s, %w", *version.VersionId, &OpError{Op: "CreatePolicyVersion", PolicyName: targetArn, Err: err})
+		}
+		copied++
+	}
+
+	return nil
+}
+
+// ListPolicyVersions returns every version of the managed policy policyArn.
+func ListPolicyVersions(ctx context.Context, client IAMClient, policyArn string) ([]types.PolicyVersion, error) {
+	params := iam.ListPolicyVersionsInput{
+		PolicyArn: &policyArn,
+	}
+
+	var versions []types.PolicyVersion
+
+	paginator := iam.NewListPolicyVersionsPaginator(client, &params)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, &OpError{Op: "ListPolicyVersions", PolicyName: policyArn, Err: err}
+		}
+
+		versions = append(versions, page.Versions...)
+	}
+
+	return versions, nil
+}
+
+// GetPolicyTags returns every tag of the managed policy policyArn.
+func GetPolicyTags(ctx context.Context, client IAMClient, policyArn string) ([]types.Tag, error) {
+	params := iam.ListPolicyTagsInput{
+		PolicyArn: &policyArn,
+	}
+
+	var tags []types.Tag
+	for {
+		page, err := client.ListPolicyTags(ctx, &params)
+		if err != nil {
+			return nil, &OpError{Op: "ListPolicyTags", PolicyName: policyArn, Err: err}
+		}
+
+		tags = append(tags, page.Tags...)
+		if !page.IsTruncated {
+			return tags, nil
+		}
+
+		// Without a marker this would loop on the first page again.
+		if page.Marker == nil {
+			return nil, fmt.Errorf("ListPolicyTags returned a truncated page without a marker for policy %s", policyArn)
+		}
+		params.Marker = page.Marker
+	}
+}
+
+// getInlinePolicies fetches the document of each named inline policy
+// through get and decodes it. It is shared by roles, users and groups.
+func getInlinePolicies(policyNames []string, get func(policyName string) (*string, error)) ([]InlinePolicy, error) {
+	var inlinePolicies []InlinePolicy
+
+	for _, policyName := range policyNames {
+		document, err := get(policyName)
+		if err != nil {
+			return nil, err
+		}
+
+		policyDocument, err := decodeDocument(*document)
+		if err != nil {
+			return nil, fmt.Errorf("invalid inline policy %s, %w", policyName, err)
+		}
+
+		inlinePolicies = append(inlinePolicies, InlinePolicy{
+			Name:     policyName,
+			Document: policyDocument,
+		})
+	}
+
+	return inlinePolicies, nil
+}
+
+// toManagedPolicies converts attached policies as returned by the
+// ListAttached*Policies calls.
+func toManagedPolicies(attachedPolicies []types.AttachedPolicy) []ManagedPolicy {
+	var managedPolicies []ManagedPolicy
+
+	for _, policy := range attachedPolicies {
+		managedPolicies = append(managedPolicies, ManagedPolicy{
+			Name: *policy.PolicyName,
+			Arn:  *policy.PolicyArn,
+		})
+	}
+
+	return managedPolicies
+}
+
+// PolicyResolver finds customer managed policies of an account by name.
+// The policies are listed once, on the first lookup, and reused for the
+// rest of the run.
+type PolicyResolver struct {
+	Client IAMClient
+
+	arns map[string]string
+}
+
+// Resolve returns the ARN of the customer managed policy policyName.
+func (r *PolicyResolver) Resolve(ctx context.Context, policyName string) (string, error) {
+	if r.arns == nil {
+		arns, err := listLocalPolicies(ctx, r.Client)
+		if err != nil {
+			return "", err
+		}
+		r.arns = arns
+	}
+
+	policyArn, ok := r.arns[policyName]
+	if !ok {
+		return "", fmt.Errorf("policy %s: %w", policyName, ErrPolicyNotFound)
+	}
+
+	return policyArn, nil
+}
+
+// listLocalPolicies returns the ARN of every customer managed policy by
+// name.
+func listLocalPolicies(ctx context.Context, client IAMClient) (map[string]string, error) {
+	params := iam.ListPoliciesInput{
+		Scope: types.PolicyScopeTypeLocal,
+	}
+
+	arns := make(map[string]string)
+
+	paginator := iam.NewListPoliciesPaginator(client, &params)
+	for paginator.HasMorePages() {
+		policies, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, &OpError{Op: "ListPolicies", Err: err}
+		}
+
+		for _, policy := range policies.Policies {
+			arns[*policy.PolicyName] = *policy.Arn
+		}
+	}
+
+	return arns, nil
+}
+
+// skipMissingPolicies removes from snapshot the managed policies that no
+// longer exist, with a warning, and returns their ARNs. Policies cloned by
+// CloneManagedPolicies are looked up in the source account, the others in
+// the target account where they are attached.
+func (d *Duplicator) skipMissingPolicies(ctx context.Context, snapshot *Snapshot) ([]string, error) {
+	var skipped []string
+	var kept []ManagedPolicy
+	for _, policy := range snapshot.ManagedPolicies {
+		client := d.Target
+		if d.CloneManagedPolicies && !IsAWSManagedPolicy(policy.Arn) {
+			client = d.Client
+		}
+
+		_, err := client.GetPolicy(ctx, &iam.GetPolicyInput{PolicyArn: &policy.Arn})
+		if IsNoSuchEntity(err) {
+			d.warn(fmt.Sprintf("managed policy %s of role %s does not exist, it is skipped", policy.Arn, snapshot.RoleName))
+			skipped = append(skipped, policy.Arn)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to check managed policy %s, %w", policy.Name, &OpError{Op: "GetPolicy", PolicyName: policy.Arn, Err: err})
+		}
+
+		kept = append(kept, policy)
+	}
+
+	snapshot.ManagedPolicies = kept
+	return skipped, nil
+}
@@ -0,0 +1,99 @@
+package iamdup
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+func TestClonedPolicyCarriesTags(t *testing.T) {
+	tags := []types.Tag{
+		{Key: aws.String("owner"), Value: aws.String("platform")},
+		{Key: aws.String("cost-center"), Value: aws.String("42")},
+	}
+
+	client := newFakeIAM("111111111111")
+	policyArn := client.addPolicy("app-access", testDocument)
+	client.policies[policyArn].tags = tags
+	client.addRole("app", testTrust).attach("app-access", policyArn)
+
+	target := newFakeIAM("222222222222")
+
+	d := New(client)
+	d.Target = target
+	d.CloneManagedPolicies = true
+
+	_, err := d.Duplicate(context.Background(), "app", "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clonedArn := "arn:aws:iam::222222222222:policy/app-access"
+	cloned, ok := target.policies[clonedArn]
+	if !ok {
+		t.Fatalf("policy %s not created, target holds %d policies", clonedArn, len(target.policies))
+	}
+	if got, want := toTags(cloned.tags), toTags(tags); !reflect.DeepEqual(got, want) {
+		t.Errorf("cloned policy tags = %v, want %v", got, want)
+	}
+
+	if got, want := target.attachedArns("app"), []string{clonedArn}; !reflect.DeepEqual(got, want) {
+		t.Errorf("attached policies = %q, want %q", got, want)
+	}
+}
+
+func TestSkipMissingPoliciesKeepsTheOthers(t *testing.T) {
+	tests := []struct {
+		name    string
+		skip    bool
+		wantErr bool
+	}{
+		{"skipped", true, false},
+		{"not skipped", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newFakeIAM("111111111111")
+			readArn := client.addPolicy("read", testDocument)
+			writeArn := client.addPolicy("write", testDocument)
+			deletedArn := "arn:aws:iam::111111111111:policy/deleted"
+			source := client.addRole("app", testTrust)
+			source.attach("read", readArn)
+			source.attach("deleted", deletedArn)
+			source.attach("write", writeArn)
+
+			var warnings []string
+			d := New(client)
+			d.SkipMissingPolicies = tt.skip
+			d.Warn = func(message string) { warnings = append(warnings, message) }
+
+			result, err := d.Duplicate(context.Background(), "app", "app-copy")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if !IsNoSuchEntity(err) {
+					t.Errorf("err = %v, want NoSuchEntity", err)
+				}
+				return
+			}
+
+			if !reflect.DeepEqual(result.SkippedManagedPolicies, []string{deletedArn}) {
+				t.Errorf("skipped policies = %q, want %s", result.SkippedManagedPolicies, deletedArn)
+			}
+			if got := client.attachedArns("app-copy"); !reflect.DeepEqual(got, []string{readArn, writeArn}) {
+				t.Errorf("attached policies = %q, want %s and %s", got, readArn, writeArn)
+			}
+			if got := client.callsTo("AttachRolePolicy"); len(got) != 2 {
+				t.Errorf("AttachRolePolicy called for %q, want the missing policy left out", got)
+			}
+			if len(warnings) != 1 {
+				t.Errorf("warnings = %q, want one for %s", warnings, deletedArn)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package iamdup
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// ErrProtectedRole is returned when an existing target role matching
+// ProtectPattern would be changed without Force.
+var ErrProtectedRole = errors.New("role is protected")
+
+// ValidateProtectPattern checks that pattern is a valid regular expression.
+func ValidateProtectPattern(pattern string) error {
+	_, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid protect pattern %q, %w", pattern, err)
+	}
+
+	return nil
+}
+
+// checkProtected returns ErrProtectedRole when the existing role
+// targetRoleName matches ProtectPattern and Force is not set.
+func (d *Duplicator) checkProtected(targetRoleName string) error {
+	if d.ProtectPattern == "" || d.Force {
+		return nil
+	}
+
+	pattern, err := regexp.Compile(d.ProtectPattern)
+	if err != nil {
+		return fmt.Errorf("invalid protect pattern %q, %w", d.ProtectPattern, err)
+	}
+
+	if pattern.MatchString(targetRoleName) {
+		return fmt.Errorf("target role %s matches %q: %w", targetRoleName, d.ProtectPattern, ErrProtectedRole)
+	}
+
+	return nil
+}
@@ -0,0 +1,56 @@
+package iamdup
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestProtectPatternGuardsExistingTarget(t *testing.T) {
+	tests := []struct {
+		name    string
+		target  string
+		force   bool
+		wantErr error
+	}{
+		{"blocked", "admin-app", false, ErrProtectedRole},
+		{"not matching", "app-copy", false, nil},
+		{"forced", "admin-app", true, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newFakeIAM("111111111111")
+			client.addRole("app", testTrust).putInline("s3", testDocument)
+			client.addRole(tt.target, testTrust)
+
+			d := New(client)
+			d.Overwrite = true
+			d.ProtectPattern = "^admin"
+			d.Force = tt.force
+
+			_, err := d.Duplicate(context.Background(), "app", tt.target)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+
+			written := len(client.callsTo("UpdateAssumeRolePolicy")) + len(client.callsTo("PutRolePolicy"))
+			if tt.wantErr != nil && written > 0 {
+				t.Errorf("protected role %s was changed", tt.target)
+			}
+			if tt.wantErr == nil && !reflect.DeepEqual(client.inlineNames(tt.target), []string{"s3"}) {
+				t.Errorf("role %s was not updated", tt.target)
+			}
+		})
+	}
+}
+
+func TestValidateProtectPattern(t *testing.T) {
+	if err := ValidateProtectPattern("^admin"); err != nil {
+		t.Errorf("ValidateProtectPattern(^admin) error = %v", err)
+	}
+	if err := ValidateProtectPattern("[unclosed"); err == nil {
+		t.Error("ValidateProtectPattern([unclosed) succeeded, want an error")
+	}
+}
@@ -0,0 +1,57 @@
+package iamdup
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Replacement rewrites the decoded trust and inline policy documents
+// before they are written, typically to swap the source account ID for the
+// target one. Old is replaced literally unless Regex is set, in which case
+// it is a regular expression and New may refer to its groups as $1.
+type Replacement struct {
+	Old   string
+	New   string
+	Regex bool
+}
+
+// ValidateReplacements checks that every regular expression compiles.
+func ValidateReplacements(replacements []Replacement) error {
+	for _, replacement := range replacements {
+		if !replacement.Regex {
+			continue
+		}
+
+		_, err := regexp.Compile(replacement.Old)
+		if err != nil {
+			return fmt.Errorf("invalid replacement pattern %q, %w", replacement.Old, err)
+		}
+	}
+
+	return nil
+}
+
+// ReplaceInDocument applies every replacement to document, in order, and
+// checks that the result is still JSON.
+func ReplaceInDocument(document json.RawMessage, replacements []Replacement) (json.RawMessage, error) {
+	replaced := string(document)
+	for _, replacement := range replacements {
+		if replacement.Regex {
+			pattern, err := regexp.Compile(replacement.Old)
+			if err != nil {
+				return nil, fmt.Errorf("invalid replacement pattern %q, %w", replacement.Old, err)
+			}
+			replaced = pattern.ReplaceAllString(replaced, replacement.New)
+		} else {
+			replaced = strings.ReplaceAll(replaced, replacement.Old, replacement.New)
+		}
+	}
+
+	if !json.Valid([]byte(replaced)) {
+		return nil, fmt.Errorf("document is not valid JSON after replacements")
+	}
+
+	return json.RawMessage(replaced), nil
+}
@@ -0,0 +1,67 @@
+package iamdup
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestReplaceInDocument(t *testing.T) {
+	document := `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"sqs:SendMessage","Resource":"arn:aws:sqs:us-east-1:111111111111:queue"}]}`
+
+	tests := []struct {
+		name         string
+		replacements []Replacement
+		want         string
+		wantErr      bool
+	}{
+		{
+			name:         "literal account ID",
+			replacements: []Replacement{{Old: "111111111111", New: "222222222222"}},
+			want:         `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"sqs:SendMessage","Resource":"arn:aws:sqs:us-east-1:222222222222:queue"}]}`,
+		},
+		{
+			name:         "regex with groups",
+			replacements: []Replacement{{Old: `arn:aws:sqs:([a-z0-9-]+):111111111111:`, New: "arn:aws:sqs:$1:222222222222:", Regex: true}},
+			want:         `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"sqs:SendMessage","Resource":"arn:aws:sqs:us-east-1:222222222222:queue"}]}`,
+		},
+		{
+			name:         "in order",
+			replacements: []Replacement{{Old: "111111111111", New: "222222222222"}, {Old: "us-east-1:222222222222", New: "eu-west-1:333333333333"}},
+			want:         `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"sqs:SendMessage","Resource":"arn:aws:sqs:eu-west-1:333333333333:queue"}]}`,
+		},
+		{
+			name:         "no match",
+			replacements: []Replacement{{Old: "999999999999", New: "222222222222"}},
+			want:         document,
+		},
+		{
+			name:         "breaks the JSON",
+			replacements: []Replacement{{Old: `"Resource"`, New: `Resource`}},
+			wantErr:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReplaceInDocument(json.RawMessage(document), tt.replacements)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReplaceInDocument() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && string(got) != tt.want {
+				t.Errorf("ReplaceInDocument() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateReplacements(t *testing.T) {
+	err := ValidateReplacements([]Replacement{{Old: "(", New: "x"}})
+	if err != nil {
+		t.Errorf("ValidateReplacements() of a literal error = %v, want nil", err)
+	}
+
+	err = ValidateReplacements([]Replacement{{Old: "(", New: "x", Regex: true}})
+	if err == nil {
+		t.Error("ValidateReplacements() of an invalid regex succeeded, want an error")
+	}
+}
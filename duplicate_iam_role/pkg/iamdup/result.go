@@ -0,0 +1,57 @@
+package iamdup
+
+// Result describes what a Duplicate or Import run wrote to the target role.
+type Result struct {
+	RoleName string `json:"roleName"`
+	RoleArn  string `json:"roleArn,omitempty"`
+
+	// Updated is set when an existing role was overwritten.
+	Updated    bool `json:"updated"`
+	DryRun     bool `json:"dryRun"`
+	RolledBack bool `json:"rolledBack"`
+
+	// InlinePolicies and ManagedPolicies list the inline policy names and
+	// managed policy ARNs that were written, or would be in a dry run.
+	InlinePolicies  []string `json:"inlinePolicies"`
+	ManagedPolicies []string `json:"managedPolicies"`
+
+	// InstanceProfile is the instance profile the role was added to.
+	InstanceProfile string `json:"instanceProfile,omitempty"`
+
+	// FailedInlinePolicies and FailedManagedPolicies list the writes that
+	// were rejected.
+	FailedInlinePolicies  []string `json:"failedInlinePolicies,omitempty"`
+	FailedManagedPolicies []string `json:"failedManagedPolicies,omitempty"`
+
+	// SkippedManagedPolicies lists the managed policies left out by
+	// SkipMissingPolicies because they no longer exist.
+	SkippedManagedPolicies []string `json:"skippedManagedPolicies,omitempty"`
+
+	// TrustedRoles describes the roles trusted by the role, copied before
+	// it with FollowTrust.
+	TrustedRoles []*Result `json:"trustedRoles,omitempty"`
+}
+
+// setPlanned records every policy of snapshot as written, for dry runs.
+func (r *Result) setPlanned(snapshot *Snapshot) {
+	for _, policy := range snapshot.InlinePolicies {
+		r.InlinePolicies = append(r.InlinePolicies, policy.Name)
+	}
+
+	for _, policy := range snapshot.ManagedPolicies {
+		r.ManagedPolicies = append(r.ManagedPolicies, policy.Arn)
+	}
+}
+
+// setWritten records what rec saw being written and failing.
+func (r *Result) setWritten(rec *recorder) {
+	if rec.roleArn != "" {
+		r.RoleArn = rec.roleArn
+	}
+
+	r.InlinePolicies = rec.inlinePolicies
+	r.ManagedPolicies = rec.managedPolicies
+	r.InstanceProfile = rec.addedToInstanceProfile
+	r.FailedInlinePolicies = rec.failedInlinePolicies
+	r.FailedManagedPolicies = rec.failedManagedPolicies
+}
@@ -0,0 +1,394 @@
+package iamdup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+func GetRole(ctx context.Context, client IAMClient, roleName string) (*iam.GetRoleOutput, error) {
+	roleInput := iam.GetRoleInput{
+		RoleName: &roleName,
+	}
+	sourceRole, err := client.GetRole(ctx, &roleInput)
+	if err != nil {
+		return nil, &OpError{Op: "GetRole", RoleName: roleName, Err: err}
+	}
+
+	return sourceRole, nil
+}
+
+// ListRoles returns every role whose path starts with pathPrefix, or every
+// role of the account when pathPrefix is empty.
+func ListRoles(ctx context.Context, client IAMClient, pathPrefix string) ([]types.Role, error) {
+	var params iam.ListRolesInput
+	if pathPrefix != "" {
+		params.PathPrefix = &pathPrefix
+	}
+
+	var roles []types.Role
+
+	paginator := iam.NewListRolesPaginator(client, &params)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, &OpError{Op: "ListRoles", Err: err}
+		}
+
+		roles = append(roles, page.Roles...)
+	}
+
+	return roles, nil
+}
+
+// DefaultConcurrency is the number of inline policies fetched, or managed
+// policies attached, at once when no other limit is given.
+const DefaultConcurrency = 5
+
+// GetInlinePolicies fetches every inline policy of roleName, running at most
+// concurrency GetRolePolicy calls at once. The result keeps the order of
+// ListRolePolicies and the error of the first failing policy in that order
+// is returned, leaving aside the calls canceled because of that failure.
+func GetInlinePolicies(ctx context.Context, client IAMClient, roleName string, concurrency int) ([]*iam.GetRolePolicyOutput, error) {
+	inlinePolicyNames, err := ListInlinePolicyNames(ctx, client, roleName)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(inlinePolicyNames) == 0 {
+		return []*iam.GetRolePolicyOutput{}, nil
+	}
+
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	inlinePolicies := make([]*iam.GetRolePolicyOutput, len(inlinePolicyNames))
+	errs := make([]error, len(inlinePolicyNames))
+	sem := make(chan struct{}, concurrency)
+
+	var wg sync.WaitGroup
+	for i := range inlinePolicyNames {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			rolePolicyInput := iam.GetRolePolicyInput{
+				RoleName:   &roleName,
+				PolicyName: &inlinePolicyNames[i],
+			}
+
+			inlinePolicy, err := client.GetRolePolicy(ctx, &rolePolicyInput)
+			if err != nil {
+				errs[i] = &OpError{Op: "GetRolePolicy", RoleName: roleName, PolicyName: inlinePolicyNames[i], Err: err}
+				cancel()
+				return
+			}
+
+			inlinePolicies[i] = inlinePolicy
+		}(i)
+	}
+	wg.Wait()
+
+	// The first failure cancels the calls still running, which then fail
+	// with context.Canceled; those are only reported when nothing else
+	// failed, such as when ctx itself was canceled.
+	var canceled error
+	for _, err := range errs {
+		if err != nil && !errors.Is(err, context.Canceled) {
+			return nil, err
+		}
+		if err != nil && canceled == nil {
+			canceled = err
+		}
+	}
+	if canceled != nil {
+		return nil, canceled
+	}
+
+	return inlinePolicies, nil
+}
+
+// GetInlinePolicy fetches the inline policy policyName of roleName, with its
+// document decoded.
+func GetInlinePolicy(ctx context.Context, client IAMClient, roleName string, policyName string) (InlinePolicy, error) {
+	rolePolicyInput := iam.GetRolePolicyInput{
+		PolicyName: &policyName,
+		RoleName:   &roleName,
+	}
+
+	inlinePolicy, err := client.GetRolePolicy(ctx, &rolePolicyInput)
+	if err != nil {
+		return InlinePolicy{}, &OpError{Op: "GetRolePolicy", RoleName: roleName, PolicyName: policyName, Err: err}
+	}
+
+	document, err := decodeDocument(*inlinePolicy.PolicyDocument)
+	if err != nil {
+		return InlinePolicy{}, fmt.Errorf("invalid inline policy %s, %w", policyName, err)
+	}
+
+	return InlinePolicy{Name: policyName, Document: document}, nil
+}
+
+func ListInlinePolicyNames(ctx context.Context, client IAMClient, roleName string) ([]string, error) {
+	params := iam.ListRolePoliciesInput{
+		RoleName: &roleName,
+	}
+
+	var inlinePolicyNames []string
+
+	paginator := iam.NewListRolePoliciesPaginator(client, &params)
+	for paginator.HasMorePages() {
+		rolePolicies, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, &OpError{Op: "ListRolePolicies", RoleName: roleName, Err: err}
+		}
+
+		// The paginator stops on a missing marker, which would silently
+		// leave the following policies out of the copy.
+		if rolePolicies.IsTruncated && rolePolicies.Marker == nil {
+			return nil, fmt.Errorf("ListRolePolicies returned a truncated page without a marker for role %s", roleName)
+		}
+
+		inlinePolicyNames = append(inlinePolicyNames, rolePolicies.PolicyNames...)
+	}
+
+	return inlinePolicyNames, nil
+}
+
+func GetManagedPolicies(ctx context.Context, client IAMClient, roleName string) ([]types.AttachedPolicy, error) {
+	params := iam.ListAttachedRolePoliciesInput{
+		RoleName: &roleName,
+	}
+
+	var managedPolicies []types.AttachedPolicy
+
+	paginator := iam.NewListAttachedRolePoliciesPaginator(client, &params)
+	for paginator.HasMorePages() {
+		attachedRolePolicies, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, &OpError{Op: "ListAttachedRolePolicies", RoleName: roleName, Err: err}
+		}
+
+		if attachedRolePolicies.IsTruncated && attachedRolePolicies.Marker == nil {
+			return nil, fmt.Errorf("ListAttachedRolePolicies returned a truncated page without a marker for role %s", roleName)
+		}
+
+		managedPolicies = append(managedPolicies, attachedRolePolicies.AttachedPolicies...)
+	}
+
+	return managedPolicies, nil
+}
+
+func CreateRole(ctx context.Context, client IAMClient, snapshot *Snapshot, targetRoleName string) error {
+	assumeRolePolicyDocument := string(snapshot.AssumeRolePolicyDocument)
+
+	params := iam.CreateRoleInput{
+		RoleName:                 &targetRoleName,
+		AssumeRolePolicyDocument: &assumeRolePolicyDocument,
+	}
+
+	if snapshot.Path != "" {
+		params.Path = &snapshot.Path
+	}
+
+	if snapshot.Description != "" {
+		params.Description = &snapshot.Description
+	}
+
+	if snapshot.MaxSessionDuration != 0 {
+		params.MaxSessionDuration = &snapshot.MaxSessionDuration
+	}
+
+	if snapshot.PermissionsBoundaryArn != "" {
+		params.PermissionsBoundary = &snapshot.PermissionsBoundaryArn
+	}
+
+	for _, tag := range snapshot.Tags {
+		params.Tags = append(params.Tags, types.Tag{
+			Key:   aws.String(tag.Key),
+			Value: aws.String(tag.Value),
+		})
+	}
+
+	_, err := client.CreateRole(ctx, &params)
+	if err != nil {
+		return &OpError{Op: "CreateRole", RoleName: targetRoleName, Err: err}
+	}
+
+	return nil
+}
+
+// DefaultWaitTimeout is how long WaitRoleExists polls for a new role when
+// no other timeout is given.
+const DefaultWaitTimeout = 30 * time.Second
+
+// WaitRoleExists polls GetRole with an increasing delay until roleName is
+// visible or timeout elapses. IAM is eventually consistent, so a role that
+// was just created may not be usable by the following calls yet.
+func WaitRoleExists(ctx context.Context, client IAMClient, roleName string, timeout time.Duration) error {
+	if timeout <= 0 {
+		timeout = DefaultWaitTimeout
+	}
+
+	waiter := iam.NewRoleExistsWaiter(client, func(o *iam.RoleExistsWaiterOptions) {
+		o.MinDelay = 500 * time.Millisecond
+		o.MaxDelay = 5 * time.Second
+	})
+
+	err := waiter.Wait(ctx, &iam.GetRoleInput{RoleName: &roleName}, timeout)
+	if err != nil {
+		return fmt.Errorf("failed to wait for role %s, %w", roleName, err)
+	}
+
+	return nil
+}
+
+// Progress is told about each step of a long loop before it runs, such as
+// attaching the current-th of total managed policies.
+type Progress func(current int, total int, step string)
+
+func (p Progress) report(current int, total int, step string) {
+	if p != nil {
+		p(current, total, step)
+	}
+}
+
+// AddInlinePolicies puts every policy on targetRoleName, reporting each to
+// progress when not nil. A failing policy does not stop the others; all
+// failures are returned joined together.
+func AddInlinePolicies(ctx context.Context, client IAMClient, targetRoleName string, inlinePolicies []InlinePolicy, progress Progress) error {
+	var errs []error
+
+	for i, policy := range inlinePolicies {
+		progress.report(i+1, len(inlinePolicies), "putting inline policy "+policy.Name)
+		policyDocument := string(policy.Document)
+
+		params := iam.PutRolePolicyInput{
+			RoleName:       &targetRoleName,
+			PolicyName:     aws.String(policy.Name),
+			PolicyDocument: &policyDocument,
+		}
+
+		_, err := client.PutRolePolicy(ctx, &params)
+		if err != nil {
+			errs = append(errs, &OpError{Op: "PutRolePolicy", RoleName: targetRoleName, PolicyName: policy.Name, Err: err})
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// AddManagedPolicies attaches every policy to targetRoleName, running at
+// most concurrency AttachRolePolicy calls at once and reporting each to
+// progress when not nil. A failing policy does not stop the others, unless
+// the role reached its quota of attached policies; all failures are
+// returned joined together in the order of managedPolicies, whatever order
+// the calls completed in.
+func AddManagedPolicies(ctx context.Context, client IAMClient, targetRoleName string, managedPolicies []ManagedPolicy, concurrency int, progress Progress) error {
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+
+	errs := make([]error, len(managedPolicies))
+	attached := make([]bool, len(managedPolicies))
+	sem := make(chan struct{}, concurrency)
+
+	var (
+		wg           sync.WaitGroup
+		mu           sync.Mutex
+		started      int
+		limitReached bool
+	)
+
+	for i := range managedPolicies {
+		sem <- struct{}{}
+
+		mu.Lock()
+		stop := limitReached
+		mu.Unlock()
+		if stop {
+			// Every following attachment would fail the same way.
+			<-sem
+			break
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			policy := managedPolicies[i]
+
+			mu.Lock()
+			started++
+			progress.report(started, len(managedPolicies), "attaching "+policy.Arn)
+			mu.Unlock()
+
+			params := iam.AttachRolePolicyInput{
+				RoleName:  &targetRoleName,
+				PolicyArn: aws.String(policy.Arn),
+			}
+
+			_, err := client.AttachRolePolicy(ctx, &params)
+			if err == nil {
+				attached[i] = true
+				return
+			}
+
+			errs[i] = &OpError{Op: "AttachRolePolicy", RoleName: targetRoleName, PolicyName: policy.Arn, Err: err}
+			if IsLimitExceeded(err) {
+				mu.Lock()
+				limitReached = true
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	attachedCount := 0
+	for _, ok := range attached {
+		if ok {
+			attachedCount++
+		}
+	}
+
+	var joined []error
+	var limitErr error
+	notAttached := 0
+
+	for i, err := range errs {
+		policy := managedPolicies[i]
+
+		switch {
+		case err == nil && attached[i]:
+		case err == nil, IsLimitExceeded(err):
+			notAttached++
+			if limitErr == nil && err != nil {
+				limitErr = err
+			}
+		case IsNoSuchEntity(err) && !IsAWSManagedPolicy(policy.Arn):
+			joined = append(joined, fmt.Errorf("customer managed policy %s does not exist in the target account, %w", policy.Arn, err))
+		default:
+			joined = append(joined, err)
+		}
+	}
+
+	if limitErr != nil {
+		joined = append(joined, fmt.Errorf("the role reached its quota of attached managed policies after %d of %d were attached, %d were not attached; copy them as inline policies or request a quota increase, %w", attachedCount, len(managedPolicies), notAttached, limitErr))
+	}
+
+	return errors.Join(joined...)
+}
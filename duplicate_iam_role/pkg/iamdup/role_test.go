@@ -0,0 +1,275 @@
+package iamdup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+func TestDuplicateTruncatedPages(t *testing.T) {
+	client := newFakeIAM("111111111111")
+	client.pageSize = 2
+
+	source := client.addRole("app", testTrust)
+	for _, policyName := range []string{"a", "b", "c"} {
+		source.putInline(policyName, testDocument)
+	}
+	for _, policyName := range []string{"ReadOnlyAccess", "AmazonS3ReadOnlyAccess", "CloudWatchReadOnlyAccess"} {
+		source.attach(policyName, "arn:aws:iam::aws:policy/"+policyName)
+	}
+
+	_, err := New(client).Duplicate(context.Background(), "app", "app-copy")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := client.callsTo("ListRolePolicies"); len(got) != 2 {
+		t.Errorf("ListRolePolicies called for %q, want two pages", got)
+	}
+
+	if got, want := client.inlineNames("app-copy"), []string{"a", "b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("inline policies = %q, want %q", got, want)
+	}
+
+	if got, want := client.attachedArns("app-copy"), client.attachedArns("app"); !reflect.DeepEqual(got, want) {
+		t.Errorf("attached policies = %q, want %q", got, want)
+	}
+}
+
+func TestGetInlinePoliciesConcurrency(t *testing.T) {
+	client := newFakeIAM("111111111111")
+	client.delay = 10 * time.Millisecond
+
+	source := client.addRole("app", testTrust)
+	var want []string
+	for i := 0; i < 12; i++ {
+		policyName := fmt.Sprintf("policy-%02d", i)
+		source.putInline(policyName, testDocument)
+		want = append(want, policyName)
+	}
+
+	policies, err := GetInlinePolicies(context.Background(), client, "app", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, policy := range policies {
+		got = append(got, *policy.PolicyName)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("policies = %q, want %q", got, want)
+	}
+
+	if client.peak > 3 {
+		t.Errorf("%d GetRolePolicy calls ran at once, want at most 3", client.peak)
+	}
+}
+
+func TestGetInlinePoliciesReportsFailureOverCancellation(t *testing.T) {
+	client := newFakeIAM("111111111111")
+	client.delay = 50 * time.Millisecond
+
+	source := client.addRole("app", testTrust)
+	for _, policyName := range []string{"a", "b", "c", "d"} {
+		source.putInline(policyName, testDocument)
+	}
+
+	failure := errors.New("internal failure")
+	client.fail = func(op string, name string) error {
+		if op == "GetRolePolicy" && name == "app/c" {
+			return failure
+		}
+		return nil
+	}
+
+	_, err := GetInlinePolicies(context.Background(), client, "app", 4)
+	if !errors.Is(err, failure) {
+		t.Errorf("err = %v, want %v", err, failure)
+	}
+}
+
+func TestTruncatedPageWithoutMarker(t *testing.T) {
+	tests := []struct {
+		name string
+		list func(ctx context.Context, client IAMClient) error
+	}{
+		{"ListRolePolicies", func(ctx context.Context, client IAMClient) error {
+			_, err := ListInlinePolicyNames(ctx, client, "app")
+			return err
+		}},
+		{"ListAttachedRolePolicies", func(ctx context.Context, client IAMClient) error {
+			_, err := GetManagedPolicies(ctx, client, "app")
+			return err
+		}},
+		{"ListPolicyTags", func(ctx context.Context, client IAMClient) error {
+			_, err := GetPolicyTags(ctx, client, "arn:aws:iam::111111111111:policy/app-access")
+			return err
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newFakeIAM("111111111111")
+			client.pageSize = 1
+			client.truncateWithoutMarker = true
+
+			source := client.addRole("app", testTrust)
+			policyArn := client.addPolicy("app-access", testDocument)
+			client.policies[policyArn].tags = fromTags([]Tag{{Key: "a", Value: "1"}, {Key: "b", Value: "2"}})
+			for _, policyName := range []string{"a", "b"} {
+				source.putInline(policyName, testDocument)
+				source.attach(policyName, "arn:aws:iam::aws:policy/"+policyName)
+			}
+
+			err := tt.list(context.Background(), client)
+			if err == nil || !strings.Contains(err.Error(), "truncated page without a marker") {
+				t.Errorf("err = %v, want a truncated page error", err)
+			}
+		})
+	}
+}
+
+func TestGetPolicyTagsPages(t *testing.T) {
+	client := newFakeIAM("111111111111")
+	client.pageSize = 2
+
+	policyArn := client.addPolicy("app-access", testDocument)
+	want := []Tag{{Key: "a", Value: "1"}, {Key: "b", Value: "2"}, {Key: "c", Value: "3"}}
+	client.policies[policyArn].tags = fromTags(want)
+
+	tags, err := GetPolicyTags(context.Background(), client, policyArn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := toTags(tags); !reflect.DeepEqual(got, want) {
+		t.Errorf("tags = %v, want %v", got, want)
+	}
+}
+
+func TestDuplicateWaitsForCreatedRole(t *testing.T) {
+	client := newFakeIAM("111111111111")
+	source := client.addRole("app", testTrust)
+	source.putInline("a", testDocument)
+
+	created, notFound := false, 0
+	client.fail = func(op string, name string) error {
+		if op == "CreateRole" {
+			created = true
+		}
+		if op == "GetRole" && name == "app-copy" && created && notFound == 0 {
+			notFound++
+			return &types.NoSuchEntityException{Message: aws.String("role app-copy not found")}
+		}
+		return nil
+	}
+
+	_, err := New(client).Duplicate(context.Background(), "app", "app-copy")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var afterCreate []string
+	for _, call := range client.calls {
+		if call == "CreateRole app-copy" {
+			afterCreate = nil
+		}
+		afterCreate = append(afterCreate, call)
+	}
+	if want := []string{"CreateRole app-copy", "GetRole app-copy", "GetRole app-copy", "PutRolePolicy app-copy/a"}; len(afterCreate) < len(want) || !reflect.DeepEqual(afterCreate[:len(want)], want) {
+		t.Errorf("calls after CreateRole = %q, want %q first", afterCreate, want)
+	}
+}
+
+func TestAddManagedPoliciesReportsQuota(t *testing.T) {
+	client := newFakeIAM("111111111111")
+	client.addRole("app-copy", testTrust)
+
+	attachCalls := 0
+	client.fail = func(op string, name string) error {
+		if op != "AttachRolePolicy" {
+			return nil
+		}
+		attachCalls++
+		if attachCalls > 10 {
+			return &types.LimitExceededException{Message: aws.String("Cannot exceed quota for PoliciesPerRole: 10")}
+		}
+		return nil
+	}
+
+	var policies []ManagedPolicy
+	for i := 0; i < 12; i++ {
+		policyName := fmt.Sprintf("Policy%02d", i)
+		policies = append(policies, ManagedPolicy{Name: policyName, Arn: "arn:aws:iam::aws:policy/" + policyName})
+	}
+
+	err := AddManagedPolicies(context.Background(), client, "app-copy", policies, 1, nil)
+	if !IsLimitExceeded(err) {
+		t.Fatalf("AddManagedPolicies error = %v, want LimitExceeded", err)
+	}
+
+	want := "the role reached its quota of attached managed policies after 10 of 12 were attached, 2 were not attached; copy them as inline policies or request a quota increase"
+	if !strings.Contains(err.Error(), want) {
+		t.Errorf("error = %q, want guidance %q", err, want)
+	}
+
+	if attachCalls != 11 {
+		t.Errorf("AttachRolePolicy called %d times, want the attachments stopped after the first LimitExceeded", attachCalls)
+	}
+	if got := client.attachedArns("app-copy"); len(got) != 10 {
+		t.Errorf("attached policies = %q, want 10", got)
+	}
+}
+
+func TestAddManagedPoliciesMixedResults(t *testing.T) {
+	client := newFakeIAM("111111111111")
+	client.addRole("app-copy", testTrust)
+
+	failing := map[string]bool{"Policy03": true, "Policy07": true, "Policy11": true}
+	client.fail = func(op string, name string) error {
+		if op == "AttachRolePolicy" && failing[name[strings.LastIndex(name, "/")+1:]] {
+			return fmt.Errorf("failure of %s", name[strings.LastIndex(name, "/")+1:])
+		}
+		return nil
+	}
+
+	var policies []ManagedPolicy
+	var wantAttached []string
+	for i := 0; i < 12; i++ {
+		policyName := fmt.Sprintf("Policy%02d", i)
+		policyArn := "arn:aws:iam::aws:policy/" + policyName
+		policies = append(policies, ManagedPolicy{Name: policyName, Arn: policyArn})
+		if !failing[policyName] {
+			wantAttached = append(wantAttached, policyArn)
+		}
+	}
+
+	for run := 0; run < 5; run++ {
+		client.roles["app-copy"].attached = nil
+
+		err := AddManagedPolicies(context.Background(), client, "app-copy", policies, 4, nil)
+		if err == nil {
+			t.Fatal("AddManagedPolicies succeeded, want the failures")
+		}
+
+		lines := strings.Split(err.Error(), "\n")
+		if len(lines) != 3 || !strings.Contains(lines[0], "failure of Policy03") || !strings.Contains(lines[1], "failure of Policy07") || !strings.Contains(lines[2], "failure of Policy11") {
+			t.Fatalf("error = %q, want the three failures in the order of the policies", err)
+		}
+
+		got := client.attachedArns("app-copy")
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, wantAttached) {
+			t.Errorf("attached policies = %q, want %q", got, wantAttached)
+		}
+	}
+}
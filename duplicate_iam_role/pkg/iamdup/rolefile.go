@@ -0,0 +1,78 @@
+package iamdup
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+// ReadRole decodes the output of `aws iam get-role` into the structure
+// returned by GetRole. The CLI wraps the role in a Role object and prints
+// the assume role policy document either decoded or URL-encoded, both are
+// accepted.
+func ReadRole(r io.Reader) (*iam.GetRoleOutput, error) {
+	var output struct {
+		Role *struct {
+			types.Role
+			AssumeRolePolicyDocument json.RawMessage
+		}
+	}
+
+	decoder := json.NewDecoder(r)
+	err := decoder.Decode(&output)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode role file, %w", err)
+	}
+
+	if output.Role == nil {
+		return nil, fmt.Errorf("role file has no Role object, expected the output of aws iam get-role")
+	}
+
+	role := output.Role.Role
+	if role.RoleName == nil || *role.RoleName == "" {
+		return nil, fmt.Errorf("role file has no Role.RoleName")
+	}
+
+	if len(output.Role.AssumeRolePolicyDocument) == 0 {
+		return nil, fmt.Errorf("role file has no Role.AssumeRolePolicyDocument")
+	}
+
+	document, err := readRoleDocument(output.Role.AssumeRolePolicyDocument)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Role.AssumeRolePolicyDocument, %w", err)
+	}
+	role.AssumeRolePolicyDocument = &document
+
+	return &iam.GetRoleOutput{Role: &role}, nil
+}
+
+// readRoleDocument returns the document URL-encoded, as GetRole does. A
+// JSON string is taken as already encoded and a JSON object is encoded.
+func readRoleDocument(raw json.RawMessage) (string, error) {
+	var encoded string
+	if raw[0] == '"' {
+		err := json.Unmarshal(raw, &encoded)
+		if err != nil {
+			return "", err
+		}
+
+		return encoded, nil
+	}
+
+	var compacted bytes.Buffer
+	err := json.Compact(&compacted, raw)
+	if err != nil {
+		return "", err
+	}
+
+	if compacted.Bytes()[0] != '{' {
+		return "", fmt.Errorf("document must be a JSON object or a URL-encoded string")
+	}
+
+	return url.PathEscape(compacted.String()), nil
+}
@@ -0,0 +1,219 @@
+package iamdup
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+)
+
+// recorder wraps an IAMClient and remembers every role, inline policy,
+// managed policy, managed policy attachment and instance profile it
+// successfully created, so that the run can be reported and rollback only
+// removes what this run added.
+type recorder struct {
+	IAMClient
+
+	// mu guards the policy lists, managed policies are attached
+	// concurrently.
+	mu sync.Mutex
+
+	roleName        string
+	roleArn         string
+	inlinePolicies  []string
+	managedPolicies []string
+
+	// instanceProfileName is set when the instance profile was created by
+	// this run, addedToInstanceProfile when the role was added to it.
+	instanceProfileName    string
+	addedToInstanceProfile string
+
+	failedInlinePolicies  []string
+	failedManagedPolicies []string
+
+	// createdPolicies are the ARNs of the managed policies created by this
+	// run, createdPolicyVersions the versions added to them besides their
+	// default one, which must be deleted first.
+	createdPolicies       []string
+	createdPolicyVersions map[string][]string
+}
+
+func (r *recorder) CreateRole(ctx context.Context, params *iam.CreateRoleInput, optFns ...func(*iam.Options)) (*iam.CreateRoleOutput, error) {
+	out, err := r.IAMClient.CreateRole(ctx, params, optFns...)
+	if err == nil {
+		r.roleName = *params.RoleName
+		r.roleArn = *out.Role.Arn
+	}
+	return out, err
+}
+
+func (r *recorder) PutRolePolicy(ctx context.Context, params *iam.PutRolePolicyInput, optFns ...func(*iam.Options)) (*iam.PutRolePolicyOutput, error) {
+	out, err := r.IAMClient.PutRolePolicy(ctx, params, optFns...)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err == nil {
+		r.inlinePolicies = append(r.inlinePolicies, *params.PolicyName)
+	} else {
+		r.failedInlinePolicies = append(r.failedInlinePolicies, *params.PolicyName)
+	}
+	return out, err
+}
+
+func (r *recorder) AttachRolePolicy(ctx context.Context, params *iam.AttachRolePolicyInput, optFns ...func(*iam.Options)) (*iam.AttachRolePolicyOutput, error) {
+	out, err := r.IAMClient.AttachRolePolicy(ctx, params, optFns...)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err == nil {
+		r.managedPolicies = append(r.managedPolicies, *params.PolicyArn)
+	} else {
+		r.failedManagedPolicies = append(r.failedManagedPolicies, *params.PolicyArn)
+	}
+	return out, err
+}
+
+func (r *recorder) CreatePolicy(ctx context.Context, params *iam.CreatePolicyInput, optFns ...func(*iam.Options)) (*iam.CreatePolicyOutput, error) {
+	out, err := r.IAMClient.CreatePolicy(ctx, params, optFns...)
+	if err == nil {
+		r.createdPolicies = append(r.createdPolicies, *out.Policy.Arn)
+	}
+	return out, err
+}
+
+func (r *recorder) CreatePolicyVersion(ctx context.Context, params *iam.CreatePolicyVersionInput, optFns ...func(*iam.Options)) (*iam.CreatePolicyVersionOutput, error) {
+	out, err := r.IAMClient.CreatePolicyVersion(ctx, params, optFns...)
+	if err == nil && !params.SetAsDefault {
+		if r.createdPolicyVersions == nil {
+			r.createdPolicyVersions = make(map[string][]string)
+		}
+		r.createdPolicyVersions[*params.PolicyArn] = append(r.createdPolicyVersions[*params.PolicyArn], *out.PolicyVersion.VersionId)
+	}
+	return out, err
+}
+
+func (r *recorder) CreateInstanceProfile(ctx context.Context, params *iam.CreateInstanceProfileInput, optFns ...func(*iam.Options)) (*iam.CreateInstanceProfileOutput, error) {
+	out, err := r.IAMClient.CreateInstanceProfile(ctx, params, optFns...)
+	if err == nil {
+		r.instanceProfileName = *params.InstanceProfileName
+	}
+	return out, err
+}
+
+func (r *recorder) AddRoleToInstanceProfile(ctx context.Context, params *iam.AddRoleToInstanceProfileInput, optFns ...func(*iam.Options)) (*iam.AddRoleToInstanceProfileOutput, error) {
+	out, err := r.IAMClient.AddRoleToInstanceProfile(ctx, params, optFns...)
+	if err == nil {
+		r.addedToInstanceProfile = *params.InstanceProfileName
+	}
+	return out, err
+}
+
+// RollbackTimeout bounds the calls undoing a failed duplication. They do not
+// use the deadline of the run, which may be what made it fail.
+const RollbackTimeout = time.Minute
+
+// rollback removes the role from the recorded instance profile, detaches
+// the recorded managed policies, deletes the recorded inline policies, the
+// recorded instance profile and role, and finally the recorded managed
+// policies.
+func (r *recorder) rollback(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), RollbackTimeout)
+	defer cancel()
+
+	if r.roleName != "" {
+		err := r.rollbackRole(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i := len(r.createdPolicies) - 1; i >= 0; i-- {
+		policyArn := r.createdPolicies[i]
+
+		for _, versionID := range r.createdPolicyVersions[policyArn] {
+			params := iam.DeletePolicyVersionInput{
+				PolicyArn: &policyArn,
+				VersionId: aws.String(versionID),
+			}
+
+			_, err := r.IAMClient.DeletePolicyVersion(ctx, &params)
+			if err != nil {
+				return fmt.Errorf("version %s, %w", versionID, &OpError{Op: "DeletePolicyVersion", PolicyName: policyArn, Err: err})
+			}
+		}
+
+		params := iam.DeletePolicyInput{
+			PolicyArn: &policyArn,
+		}
+
+		_, err := r.IAMClient.DeletePolicy(ctx, &params)
+		if err != nil {
+			return &OpError{Op: "DeletePolicy", PolicyName: policyArn, Err: err}
+		}
+	}
+
+	return nil
+}
+
+// rollbackRole undoes the recorded changes of the recorded role, then
+// deletes it.
+func (r *recorder) rollbackRole(ctx context.Context) error {
+	if r.addedToInstanceProfile != "" {
+		params := iam.RemoveRoleFromInstanceProfileInput{
+			RoleName:            &r.roleName,
+			InstanceProfileName: &r.addedToInstanceProfile,
+		}
+
+		_, err := r.IAMClient.RemoveRoleFromInstanceProfile(ctx, &params)
+		if err != nil {
+			return fmt.Errorf("instance profile %s, %w", r.addedToInstanceProfile, &OpError{Op: "RemoveRoleFromInstanceProfile", RoleName: r.roleName, Err: err})
+		}
+	}
+
+	for _, policyArn := range r.managedPolicies {
+		params := iam.DetachRolePolicyInput{
+			RoleName:  &r.roleName,
+			PolicyArn: &policyArn,
+		}
+
+		_, err := r.IAMClient.DetachRolePolicy(ctx, &params)
+		if err != nil {
+			return &OpError{Op: "DetachRolePolicy", RoleName: r.roleName, PolicyName: policyArn, Err: err}
+		}
+	}
+
+	for _, policyName := range r.inlinePolicies {
+		params := iam.DeleteRolePolicyInput{
+			RoleName:   &r.roleName,
+			PolicyName: &policyName,
+		}
+
+		_, err := r.IAMClient.DeleteRolePolicy(ctx, &params)
+		if err != nil {
+			return &OpError{Op: "DeleteRolePolicy", RoleName: r.roleName, PolicyName: policyName, Err: err}
+		}
+	}
+
+	if r.instanceProfileName != "" {
+		params := iam.DeleteInstanceProfileInput{
+			InstanceProfileName: &r.instanceProfileName,
+		}
+
+		_, err := r.IAMClient.DeleteInstanceProfile(ctx, &params)
+		if err != nil {
+			return fmt.Errorf("instance profile %s, %w", r.instanceProfileName, &OpError{Op: "DeleteInstanceProfile", Err: err})
+		}
+	}
+
+	params := iam.DeleteRoleInput{
+		RoleName: &r.roleName,
+	}
+
+	_, err := r.IAMClient.DeleteRole(ctx, &params)
+	if err != nil {
+		return &OpError{Op: "DeleteRole", RoleName: r.roleName, Err: err}
+	}
+
+	return nil
+}
@@ -0,0 +1,108 @@
+package iamdup
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestRollbackOnPutRolePolicyFailure(t *testing.T) {
+	client := newFakeIAM("111111111111")
+	source := client.addRole("app", testTrust)
+	source.putInline("read", testDocument)
+	source.putInline("write", testDocument)
+
+	failure := errors.New("internal failure")
+	client.fail = func(op string, name string) error {
+		if op == "PutRolePolicy" && name == "app-copy/write" {
+			return failure
+		}
+		return nil
+	}
+
+	d := New(client)
+	d.RollbackOnError = true
+
+	result, err := d.Duplicate(context.Background(), "app", "app-copy")
+	if !errors.Is(err, failure) {
+		t.Fatalf("err = %v, want %v", err, failure)
+	}
+
+	if !result.RolledBack {
+		t.Error("result is not marked as rolled back")
+	}
+
+	if client.hasRole("app-copy") {
+		t.Error("target role was not deleted")
+	}
+
+	deleted := client.callsTo("DeleteRolePolicy")
+	if len(deleted) != 1 || deleted[0] != "app-copy/read" {
+		t.Errorf("deleted inline policies %q, want only app-copy/read", deleted)
+	}
+}
+
+func TestRollbackAfterTimeout(t *testing.T) {
+	client := newFakeIAM("111111111111")
+	source := client.addRole("app", testTrust)
+	source.putInline("read", testDocument)
+	source.putInline("write", testDocument)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client.fail = func(op string, name string) error {
+		if op == "PutRolePolicy" && name == "app-copy/write" {
+			cancel()
+			return context.DeadlineExceeded
+		}
+		return nil
+	}
+
+	d := New(client)
+	d.Concurrency = 1
+	d.RollbackOnError = true
+
+	result, err := d.Duplicate(ctx, "app", "app-copy")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	if !result.RolledBack || client.hasRole("app-copy") {
+		t.Errorf("target role was not rolled back, %v", err)
+	}
+}
+
+func TestRollbackDeletesClonedPolicies(t *testing.T) {
+	client := newFakeIAM("111111111111")
+	policyArn := client.addPolicy("app-access", testDocument)
+	source := client.addRole("app", testTrust)
+	source.putInline("read", testDocument)
+	source.attach("app-access", policyArn)
+
+	target := newFakeIAM("222222222222")
+	target.fail = func(op string, name string) error {
+		if op == "PutRolePolicy" {
+			return errors.New("internal failure")
+		}
+		return nil
+	}
+
+	d := New(client)
+	d.Target = target
+	d.CloneManagedPolicies = true
+	d.RollbackOnError = true
+
+	_, err := d.Duplicate(context.Background(), "app", "app")
+	if err == nil {
+		t.Fatal("Duplicate succeeded, want the PutRolePolicy failure")
+	}
+
+	if got := target.callsTo("CreatePolicy"); len(got) != 1 {
+		t.Fatalf("CreatePolicy called for %q, want app-access", got)
+	}
+
+	if len(target.policies) != 0 || target.hasRole("app") {
+		t.Errorf("rollback left %d policies and role %v behind", len(target.policies), target.hasRole("app"))
+	}
+}
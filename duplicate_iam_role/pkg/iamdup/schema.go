@@ -0,0 +1,142 @@
+package iamdup
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// SnapshotSchema is the JSON Schema of the snapshot format written by
+// Export. ReadSnapshot checks every snapshot against it.
+//
+//go:embed snapshot.schema.json
+var SnapshotSchema []byte
+
+// schema is the subset of JSON Schema used by SnapshotSchema.
+type schema struct {
+	Type                 string             `json:"type"`
+	Required             []string           `json:"required"`
+	Properties           map[string]*schema `json:"properties"`
+	AdditionalProperties *bool              `json:"additionalProperties"`
+	Items                *schema            `json:"items"`
+	Minimum              *float64           `json:"minimum"`
+	MinLength            *int               `json:"minLength"`
+}
+
+var snapshotSchema = mustParseSchema(SnapshotSchema)
+
+func mustParseSchema(data []byte) *schema {
+	var s schema
+	err := json.Unmarshal(data, &s)
+	if err != nil {
+		panic(fmt.Sprintf("invalid embedded schema, %v", err))
+	}
+
+	return &s
+}
+
+// SchemaError describes the first value of a snapshot that does not match
+// SnapshotSchema. Path locates it, such as $.inlinePolicies[0].name.
+type SchemaError struct {
+	Path    string
+	Message string
+}
+
+func (e *SchemaError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+// ValidateSnapshotJSON checks data against SnapshotSchema and returns a
+// *SchemaError for the first mismatch.
+func ValidateSnapshotJSON(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value interface{}
+	err := decoder.Decode(&value)
+	if err != nil {
+		return fmt.Errorf("snapshot is not valid JSON, %w", err)
+	}
+
+	return snapshotSchema.validate("$", value)
+}
+
+func (s *schema) validate(path string, value interface{}) error {
+	switch s.Type {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return &SchemaError{Path: path, Message: "expected an object"}
+		}
+		return s.validateObject(path, object)
+	case "array":
+		array, ok := value.([]interface{})
+		if !ok {
+			return &SchemaError{Path: path, Message: "expected an array"}
+		}
+		for i, item := range array {
+			if s.Items == nil {
+				break
+			}
+			err := s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item)
+			if err != nil {
+				return err
+			}
+		}
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return &SchemaError{Path: path, Message: "expected a string"}
+		}
+		if s.MinLength != nil && len(str) < *s.MinLength {
+			return &SchemaError{Path: path, Message: fmt.Sprintf("expected at least %d characters", *s.MinLength)}
+		}
+	case "integer":
+		number, ok := value.(json.Number)
+		if !ok {
+			return &SchemaError{Path: path, Message: "expected an integer"}
+		}
+		n, err := number.Int64()
+		if err != nil {
+			return &SchemaError{Path: path, Message: "expected an integer"}
+		}
+		if s.Minimum != nil && float64(n) < *s.Minimum {
+			return &SchemaError{Path: path, Message: fmt.Sprintf("expected at least %v", *s.Minimum)}
+		}
+	}
+
+	return nil
+}
+
+func (s *schema) validateObject(path string, object map[string]interface{}) error {
+	for _, name := range s.Required {
+		if _, ok := object[name]; !ok {
+			return &SchemaError{Path: path, Message: fmt.Sprintf("missing required property %q", name)}
+		}
+	}
+
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		property, ok := s.Properties[name]
+		if !ok {
+			if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				return &SchemaError{Path: path, Message: fmt.Sprintf("unknown property %q", name)}
+			}
+			continue
+		}
+
+		err := property.validate(path+"."+name, object[name])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,230 @@
+package iamdup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+// SnapshotVersion is the version of the snapshot format written by Export.
+const SnapshotVersion = 1
+
+// Snapshot is the full definition of a role as written by Export. Policy
+// documents are stored decoded so that the file is readable and can be
+// kept under version control.
+type Snapshot struct {
+	Version                  int             `json:"version"`
+	RoleName                 string          `json:"roleName"`
+	Path                     string          `json:"path,omitempty"`
+	Description              string          `json:"description,omitempty"`
+	MaxSessionDuration       int32           `json:"maxSessionDuration,omitempty"`
+	PermissionsBoundaryArn   string          `json:"permissionsBoundaryArn,omitempty"`
+	AssumeRolePolicyDocument json.RawMessage `json:"assumeRolePolicyDocument"`
+	Tags                     []Tag           `json:"tags,omitempty"`
+	InlinePolicies           []InlinePolicy  `json:"inlinePolicies,omitempty"`
+	ManagedPolicies          []ManagedPolicy `json:"managedPolicies,omitempty"`
+	InstanceProfiles         []string        `json:"instanceProfiles,omitempty"`
+
+	// LastUsed is read-only audit information about the source role. It is
+	// never written to a target role.
+	LastUsed *RoleLastUsed `json:"lastUsed,omitempty"`
+}
+
+// RoleLastUsed tells when and in which region a role was last used, as
+// reported by GetRole.
+type RoleLastUsed struct {
+	LastUsedDate *time.Time `json:"lastUsedDate,omitempty"`
+	Region       string     `json:"region,omitempty"`
+}
+
+type Tag struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type InlinePolicy struct {
+	Name     string          `json:"name"`
+	Document json.RawMessage `json:"document"`
+}
+
+type ManagedPolicy struct {
+	Name string `json:"name"`
+	Arn  string `json:"arn"`
+
+	// VersionID pins the policy version cloned by CloneManagedPolicies. The
+	// default version is cloned when empty.
+	VersionID string `json:"versionId,omitempty"`
+}
+
+// NewSnapshot builds a Snapshot from the API responses describing a role,
+// decoding the URL-encoded policy documents on the way.
+func NewSnapshot(role *iam.GetRoleOutput, inlinePolicies []*iam.GetRolePolicyOutput, managedPolicies []types.AttachedPolicy) (*Snapshot, error) {
+	snapshot := Snapshot{
+		Version:  SnapshotVersion,
+		RoleName: *role.Role.RoleName,
+	}
+
+	if role.Role.Path != nil {
+		snapshot.Path = *role.Role.Path
+	}
+	if role.Role.Description != nil {
+		snapshot.Description = *role.Role.Description
+	}
+	if role.Role.MaxSessionDuration != nil {
+		snapshot.MaxSessionDuration = *role.Role.MaxSessionDuration
+	}
+	if role.Role.PermissionsBoundary != nil {
+		snapshot.PermissionsBoundaryArn = *role.Role.PermissionsBoundary.PermissionsBoundaryArn
+	}
+
+	if lastUsed := role.Role.RoleLastUsed; lastUsed != nil && (lastUsed.LastUsedDate != nil || lastUsed.Region != nil) {
+		snapshot.LastUsed = &RoleLastUsed{LastUsedDate: lastUsed.LastUsedDate}
+		if lastUsed.Region != nil {
+			snapshot.LastUsed.Region = *lastUsed.Region
+		}
+	}
+
+	assumeRolePolicyDocument, err := decodeDocument(*role.Role.AssumeRolePolicyDocument)
+	if err != nil {
+		return nil, fmt.Errorf("invalid assume role policy document, %w", err)
+	}
+	snapshot.AssumeRolePolicyDocument = assumeRolePolicyDocument
+
+	snapshot.Tags = toTags(role.Role.Tags)
+
+	err = snapshot.addPolicies(inlinePolicies, managedPolicies)
+	if err != nil {
+		return nil, err
+	}
+
+	return &snapshot, nil
+}
+
+// addPolicies appends the API responses describing inline and managed
+// policies to the snapshot, decoding the inline documents.
+func (s *Snapshot) addPolicies(inlinePolicies []*iam.GetRolePolicyOutput, managedPolicies []types.AttachedPolicy) error {
+	for _, policy := range inlinePolicies {
+		policyDocument, err := decodeDocument(*policy.PolicyDocument)
+		if err != nil {
+			return fmt.Errorf("invalid inline policy %s, %w", *policy.PolicyName, err)
+		}
+
+		s.InlinePolicies = append(s.InlinePolicies, InlinePolicy{
+			Name:     *policy.PolicyName,
+			Document: policyDocument,
+		})
+	}
+
+	for _, policy := range managedPolicies {
+		s.ManagedPolicies = append(s.ManagedPolicies, ManagedPolicy{
+			Name: *policy.PolicyName,
+			Arn:  *policy.PolicyArn,
+		})
+	}
+
+	return nil
+}
+
+// DescribeRole reads roleName through client and returns it as a Snapshot
+// without policies, with the assume role policy document decoded and the
+// optional fields and tags converted, so that callers do not deal with
+// the raw GetRole response.
+func DescribeRole(ctx context.Context, client IAMClient, roleName string) (*Snapshot, error) {
+	role, err := GetRole(ctx, client, roleName)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewSnapshot(role, nil, nil)
+}
+
+// ReadSnapshot decodes a snapshot written by Snapshot.Write, after checking
+// it against SnapshotSchema, and rejects other versions of the format.
+func ReadSnapshot(r io.Reader) (*Snapshot, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot, %w", err)
+	}
+
+	err = ValidateSnapshotJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid snapshot, %w", err)
+	}
+
+	var snapshot Snapshot
+	err = json.Unmarshal(data, &snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode snapshot, %w", err)
+	}
+
+	if snapshot.Version != SnapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %d, expected %d", snapshot.Version, SnapshotVersion)
+	}
+
+	return &snapshot, nil
+}
+
+// Write encodes the snapshot as indented JSON.
+func (s *Snapshot) Write(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(s)
+}
+
+// Export writes the definition of roleName to w, in the format of
+// Snapshot.Write. Inline policies are fetched and written one at a time,
+// so that they are never all held in memory.
+func (d *Duplicator) Export(ctx context.Context, roleName string, w io.Writer) error {
+	snapshot, err := d.snapshotRoleWithoutInlinePolicies(ctx, d.Client, roleName)
+	if err != nil {
+		return roleNotFound("source", roleName, err)
+	}
+
+	if d.RecordPolicyVersions {
+		err = recordPolicyVersions(ctx, d.Client, snapshot)
+		if err != nil {
+			return fmt.Errorf("unable to record policy versions, %w", err)
+		}
+	}
+
+	policyNames, err := ListInlinePolicyNames(ctx, d.Client, roleName)
+	if err != nil {
+		return fmt.Errorf("unable to get inline policies, %w", err)
+	}
+
+	return writeSnapshotStream(w, snapshot, len(policyNames), func(i int) (InlinePolicy, error) {
+		policy, err := GetInlinePolicy(ctx, d.Client, roleName, policyNames[i])
+		if err != nil {
+			return InlinePolicy{}, fmt.Errorf("unable to get inline policies, %w", err)
+		}
+
+		return policy, nil
+	})
+}
+
+// recordPolicyVersions sets the VersionID of every customer managed policy
+// of snapshot to its current default version, so that importing the
+// snapshot later clones the same documents.
+func recordPolicyVersions(ctx context.Context, client IAMClient, snapshot *Snapshot) error {
+	for i, policy := range snapshot.ManagedPolicies {
+		if IsAWSManagedPolicy(policy.Arn) {
+			continue
+		}
+
+		out, err := client.GetPolicy(ctx, &iam.GetPolicyInput{
+			PolicyArn: &policy.Arn,
+		})
+		if err != nil {
+			return &OpError{Op: "GetPolicy", PolicyName: policy.Arn, Err: err}
+		}
+
+		snapshot.ManagedPolicies[i].VersionID = *out.Policy.DefaultVersionId
+	}
+
+	return nil
+}
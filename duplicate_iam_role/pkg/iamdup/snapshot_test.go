@@ -0,0 +1,131 @@
+package iamdup
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+func TestDescribeRoleLastUsed(t *testing.T) {
+	lastUsedDate := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		lastUsed *types.RoleLastUsed
+		want     *RoleLastUsed
+	}{
+		{"never used", nil, nil},
+		{"empty", &types.RoleLastUsed{}, nil},
+		{"used", &types.RoleLastUsed{LastUsedDate: &lastUsedDate, Region: aws.String("eu-west-1")}, &RoleLastUsed{LastUsedDate: &lastUsedDate, Region: "eu-west-1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newFakeIAM("111111111111")
+			client.addRole("app", testTrust).role.RoleLastUsed = tt.lastUsed
+
+			snapshot, err := DescribeRole(context.Background(), client, "app")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := snapshot.LastUsed
+			if (got == nil) != (tt.want == nil) || got != nil && (!got.LastUsedDate.Equal(*tt.want.LastUsedDate) || got.Region != tt.want.Region) {
+				t.Errorf("LastUsed = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewSnapshotDecodesDocuments(t *testing.T) {
+	trust := `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"Service":"ec2.amazonaws.com"},"Action":"sts:AssumeRole","Condition":{"StringEquals":{"sts:ExternalId":"a b&c"}}}]}`
+
+	role := &iam.GetRoleOutput{Role: &types.Role{
+		RoleName:                 aws.String("app"),
+		AssumeRolePolicyDocument: aws.String(url.PathEscape(trust)),
+	}}
+	inlinePolicies := []*iam.GetRolePolicyOutput{
+		{PolicyName: aws.String("read"), PolicyDocument: aws.String(url.PathEscape(testDocument))},
+	}
+
+	snapshot, err := NewSnapshot(role, inlinePolicies, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := string(snapshot.AssumeRolePolicyDocument); got != trust {
+		t.Errorf("assume role policy document = %s, want %s", got, trust)
+	}
+	if got := string(snapshot.InlinePolicies[0].Document); got != testDocument {
+		t.Errorf("inline policy document = %s, want %s", got, testDocument)
+	}
+
+	role.Role.AssumeRolePolicyDocument = aws.String("%zz")
+	_, err = NewSnapshot(role, nil, nil)
+	if err == nil {
+		t.Error("NewSnapshot() of a badly encoded document succeeded, want an error")
+	}
+}
+
+func TestReadSnapshot(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{
+			name: "valid",
+			data: `{"version":1,"roleName":"app","assumeRolePolicyDocument":` + testTrust + `,"inlinePolicies":[{"name":"read","document":` + testDocument + `}]}`,
+		},
+		{
+			name:    "missing version",
+			data:    `{"roleName":"app","assumeRolePolicyDocument":` + testTrust + `}`,
+			wantErr: "version",
+		},
+		{
+			name:    "wrong version",
+			data:    `{"version":2,"roleName":"app","assumeRolePolicyDocument":` + testTrust + `}`,
+			wantErr: "unsupported snapshot version 2",
+		},
+		{
+			name:    "missing role name",
+			data:    `{"version":1,"assumeRolePolicyDocument":` + testTrust + `}`,
+			wantErr: "roleName",
+		},
+		{
+			name:    "document not an object",
+			data:    `{"version":1,"roleName":"app","assumeRolePolicyDocument":"%7B%7D"}`,
+			wantErr: "$.assumeRolePolicyDocument",
+		},
+		{
+			name:    "bad JSON",
+			data:    `{"version":1,"roleName":"app","assumeRolePolicyDocument":{"Statement":[}`,
+			wantErr: "not valid JSON",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			snapshot, err := ReadSnapshot(strings.NewReader(tt.data))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if snapshot.RoleName != "app" || len(snapshot.InlinePolicies) != 1 || string(snapshot.InlinePolicies[0].Document) != testDocument {
+					t.Errorf("ReadSnapshot() = %+v, want role app with inline policy read", snapshot)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ReadSnapshot() error = %v, want one mentioning %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package iamdup
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// MaxInlinePolicySize is the largest total size IAM accepts for the inline
+// policy documents of a role, counted without white space. It applies to
+// the inline policies together, so a single policy cannot be larger either.
+const MaxInlinePolicySize = 10240
+
+// DocumentSize returns the size of document as IAM counts it, without the
+// white space between JSON tokens.
+func DocumentSize(document json.RawMessage) (int, error) {
+	var compacted bytes.Buffer
+	err := json.Compact(&compacted, document)
+	if err != nil {
+		return 0, err
+	}
+
+	return compacted.Len(), nil
+}
+
+// ValidateInlinePolicySize checks that policy fits in MaxInlinePolicySize.
+func ValidateInlinePolicySize(policy InlinePolicy) error {
+	size, err := DocumentSize(policy.Document)
+	if err != nil {
+		return fmt.Errorf("invalid inline policy %s, %w", policy.Name, err)
+	}
+
+	if size > MaxInlinePolicySize {
+		return fmt.Errorf("inline policy %s is %d characters, more than the %d allowed, write it as a managed policy instead", policy.Name, size, MaxInlinePolicySize)
+	}
+
+	return nil
+}
+
+// ValidateInlinePoliciesSize checks that policies together fit in
+// MaxInlinePolicySize. Splitting a policy with SplitInlinePolicy does not
+// change their total.
+func ValidateInlinePoliciesSize(policies []InlinePolicy) error {
+	total := 0
+	for _, policy := range policies {
+		size, err := DocumentSize(policy.Document)
+		if err != nil {
+			return fmt.Errorf("invalid inline policy %s, %w", policy.Name, err)
+		}
+		total += size
+	}
+
+	if total > MaxInlinePolicySize {
+		return fmt.Errorf("the %d inline policies are %d characters together, more than the %d IAM allows for a role, write some of them as managed policies instead", len(policies), total, MaxInlinePolicySize)
+	}
+
+	return nil
+}
+
+// SplitInlinePolicy returns policy unchanged when it fits in
+// MaxInlinePolicySize. Otherwise its statements are spread over as few
+// policies as possible, named after policy with a -2, -3... suffix, each
+// keeping the other elements of the document such as Version. IAM limits the
+// total of the inline policies of a role too, so the split policies are
+// still rejected by ValidateInlinePoliciesSize when they are written to a
+// role together.
+func SplitInlinePolicy(policy InlinePolicy) ([]InlinePolicy, error) {
+	size, err := DocumentSize(policy.Document)
+	if err != nil {
+		return nil, fmt.Errorf("invalid inline policy %s, %w", policy.Name, err)
+	}
+
+	if size <= MaxInlinePolicySize {
+		return []InlinePolicy{policy}, nil
+	}
+
+	var document map[string]json.RawMessage
+	err = json.Unmarshal(policy.Document, &document)
+	if err != nil {
+		return nil, fmt.Errorf("invalid inline policy %s, %w", policy.Name, err)
+	}
+
+	var statements []json.RawMessage
+	err = json.Unmarshal(document["Statement"], &statements)
+	if err != nil {
+		return nil, fmt.Errorf("unable to split inline policy %s, its Statement is not a list", policy.Name)
+	}
+
+	var split []InlinePolicy
+	var chunk []json.RawMessage
+	for _, statement := range statements {
+		candidate, err := encodeStatements(document, append(chunk, statement))
+		if err != nil {
+			return nil, err
+		}
+
+		if len(candidate) <= MaxInlinePolicySize {
+			chunk = append(chunk, statement)
+			continue
+		}
+
+		if len(chunk) == 0 {
+			return nil, fmt.Errorf("unable to split inline policy %s, a single statement is more than %d characters", policy.Name, MaxInlinePolicySize)
+		}
+
+		split, err = appendChunk(split, policy.Name, document, chunk)
+		if err != nil {
+			return nil, err
+		}
+		chunk = []json.RawMessage{statement}
+	}
+
+	return appendChunk(split, policy.Name, document, chunk)
+}
+
+// appendChunk adds a policy holding statements to split, named after
+// policyName and its position.
+func appendChunk(split []InlinePolicy, policyName string, document map[string]json.RawMessage, statements []json.RawMessage) ([]InlinePolicy, error) {
+	encoded, err := encodeStatements(document, statements)
+	if err != nil {
+		return nil, err
+	}
+
+	name := policyName
+	if len(split) > 0 {
+		name = fmt.Sprintf("%s-%d", policyName, len(split)+1)
+	}
+
+	return append(split, InlinePolicy{Name: name, Document: encoded}), nil
+}
+
+// encodeStatements returns document with its Statement replaced by
+// statements, compacted.
+func encodeStatements(document map[string]json.RawMessage, statements []json.RawMessage) (json.RawMessage, error) {
+	edited := make(map[string]json.RawMessage, len(document))
+	for key, value := range document {
+		edited[key] = value
+	}
+
+	var err error
+	edited["Statement"], err = encodeJSON(statements)
+	if err != nil {
+		return nil, err
+	}
+
+	return encodeJSON(edited)
+}
@@ -0,0 +1,35 @@
+package iamdup
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestValidateInlinePoliciesSize(t *testing.T) {
+	// policy returns a policy of 105 characters plus size.
+	policy := func(name string, size int) InlinePolicy {
+		document := fmt.Sprintf(`{"Version":"2012-10-17","Statement":[{"Sid":"%s","Effect":"Allow","Action":"s3:GetObject","Resource":"*"}]}`, strings.Repeat("a", size))
+		return InlinePolicy{Name: name, Document: []byte(document)}
+	}
+
+	tests := []struct {
+		name     string
+		policies []InlinePolicy
+		wantErr  bool
+	}{
+		{"one small policy", []InlinePolicy{policy("a", 100)}, false},
+		{"each small, total too large", []InlinePolicy{policy("a", 6000), policy("b", 6000)}, true},
+		{"total at the limit", []InlinePolicy{policy("a", 5000), policy("b", MaxInlinePolicySize-5000-2*105)}, false},
+		{"total one over the limit", []InlinePolicy{policy("a", 5000), policy("b", MaxInlinePolicySize-5000-2*105+1)}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateInlinePoliciesSize(tt.policies)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateInlinePoliciesSize() = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
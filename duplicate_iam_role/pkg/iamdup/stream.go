@@ -0,0 +1,108 @@
+package iamdup
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+)
+
+// snapshotHead and snapshotTail hold the fields of Snapshot written before
+// and after InlinePolicies by writeSnapshotStream. They must follow the
+// fields and tags of Snapshot.
+type snapshotHead struct {
+	Version                  int             `json:"version"`
+	RoleName                 string          `json:"roleName"`
+	Path                     string          `json:"path,omitempty"`
+	Description              string          `json:"description,omitempty"`
+	MaxSessionDuration       int32           `json:"maxSessionDuration,omitempty"`
+	PermissionsBoundaryArn   string          `json:"permissionsBoundaryArn,omitempty"`
+	AssumeRolePolicyDocument json.RawMessage `json:"assumeRolePolicyDocument"`
+	Tags                     []Tag           `json:"tags,omitempty"`
+}
+
+type snapshotTail struct {
+	ManagedPolicies  []ManagedPolicy `json:"managedPolicies,omitempty"`
+	InstanceProfiles []string        `json:"instanceProfiles,omitempty"`
+	LastUsed         *RoleLastUsed   `json:"lastUsed,omitempty"`
+}
+
+// writeSnapshotStream writes snapshot to w exactly like Snapshot.Write,
+// with count inline policies returned by next in place of its own. Each
+// policy is written as soon as next returns it.
+func writeSnapshotStream(w io.Writer, snapshot *Snapshot, count int, next func(i int) (InlinePolicy, error)) error {
+	head, err := json.MarshalIndent(snapshotHead{
+		Version:                  snapshot.Version,
+		RoleName:                 snapshot.RoleName,
+		Path:                     snapshot.Path,
+		Description:              snapshot.Description,
+		MaxSessionDuration:       snapshot.MaxSessionDuration,
+		PermissionsBoundaryArn:   snapshot.PermissionsBoundaryArn,
+		AssumeRolePolicyDocument: snapshot.AssumeRolePolicyDocument,
+		Tags:                     snapshot.Tags,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tail, err := json.MarshalIndent(snapshotTail{
+		ManagedPolicies:  snapshot.ManagedPolicies,
+		InstanceProfiles: snapshot.InstanceProfiles,
+		LastUsed:         snapshot.LastUsed,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Both halves are objects: the closing brace of the head and the
+	// opening one of the tail are dropped to join them.
+	_, err = w.Write(bytes.TrimSuffix(head, []byte("\n}")))
+	if err != nil {
+		return err
+	}
+
+	if count > 0 {
+		_, err = io.WriteString(w, ",\n  \"inlinePolicies\": [")
+		if err != nil {
+			return err
+		}
+
+		for i := 0; i < count; i++ {
+			policy, err := next(i)
+			if err != nil {
+				return err
+			}
+
+			encoded, err := json.MarshalIndent(policy, "    ", "  ")
+			if err != nil {
+				return err
+			}
+
+			separator := ",\n    "
+			if i == 0 {
+				separator = "\n    "
+			}
+
+			_, err = io.WriteString(w, separator+string(encoded))
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err = io.WriteString(w, "\n  ]")
+		if err != nil {
+			return err
+		}
+	}
+
+	if fields := bytes.TrimSuffix(bytes.TrimPrefix(tail, []byte("{")), []byte("}")); len(bytes.TrimSpace(fields)) > 0 {
+		_, err = w.Write(append([]byte(","), fields...))
+	} else {
+		_, err = io.WriteString(w, "\n")
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, "}\n")
+	return err
+}
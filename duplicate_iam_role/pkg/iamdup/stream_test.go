@@ -0,0 +1,105 @@
+package iamdup
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+// fetchWriter records, for every write, how many inline policies had been
+// fetched from client. The buffer is not embedded, its WriteString would
+// bypass Write.
+type fetchWriter struct {
+	buf     bytes.Buffer
+	client  *fakeIAM
+	fetched []int
+}
+
+func (w *fetchWriter) Write(p []byte) (int, error) {
+	w.fetched = append(w.fetched, len(w.client.callsTo("GetRolePolicy")))
+	return w.buf.Write(p)
+}
+
+// largeDocument returns a policy document of n statements.
+func largeDocument(name string, n int) string {
+	statements := make([]string, n)
+	for i := range statements {
+		statements[i] = fmt.Sprintf(`{"Sid":"Read%d","Effect":"Allow","Action":["s3:GetObject","s3:ListBucket"],"Resource":["arn:aws:s3:::%s-%d","arn:aws:s3:::%s-%d/*"]}`, i, name, i, name, i)
+	}
+
+	return `{"Version":"2012-10-17","Statement":[` + strings.Join(statements, ",") + `]}`
+}
+
+func TestExportStreamsLargeDocuments(t *testing.T) {
+	client := newFakeIAM("111111111111")
+	source := client.addRole("app", testTrust)
+	source.role.Description = aws.String("application role")
+	source.role.Tags = []types.Tag{{Key: aws.String("team"), Value: aws.String("core")}}
+	source.attach("ReadOnlyAccess", "arn:aws:iam::aws:policy/ReadOnlyAccess")
+
+	names := []string{"logs", "s3", "sqs", "tables"}
+	for _, name := range names {
+		source.putInline(name, largeDocument(name, 200))
+	}
+
+	d := New(client)
+
+	snapshot, err := d.Snapshot(context.Background(), "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var want bytes.Buffer
+	err = snapshot.Write(&want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fetchedBefore := len(client.callsTo("GetRolePolicy"))
+	w := &fetchWriter{client: client}
+	err = d.Export(context.Background(), "app", w)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if w.buf.String() != want.String() {
+		t.Errorf("Export() wrote\n%s\nwant the output of Snapshot.Write\n%s", w.buf.String(), want.String())
+	}
+
+	// The role is written before its first policy is fetched, and every
+	// policy before the next one is.
+	if len(w.fetched) == 0 || w.fetched[0] != fetchedBefore {
+		t.Fatalf("fetched policies at each write = %v, want the role written before any fetch", w.fetched)
+	}
+	for i, fetched := range w.fetched {
+		if fetched-fetchedBefore > i {
+			t.Errorf("fetched policies at each write = %v, want one more fetched per policy written", w.fetched)
+			break
+		}
+	}
+
+	read, err := ReadSnapshot(strings.NewReader(w.buf.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read.InlinePolicies) != len(names) {
+		t.Fatalf("read %d inline policies, want %d", len(read.InlinePolicies), len(names))
+	}
+	for i, policy := range read.InlinePolicies {
+		var document bytes.Buffer
+		err = json.Compact(&document, policy.Document)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if policy.Name != names[i] || document.String() != largeDocument(names[i], 200) {
+			t.Errorf("inline policy %d = %s, want %s with its document", i, policy.Name, names[i])
+		}
+	}
+}
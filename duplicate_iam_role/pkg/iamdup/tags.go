@@ -0,0 +1,125 @@
+package iamdup
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+// TagChanges lists the tags SyncTags added, changed and removed on the
+// target role, or would have in a dry run.
+type TagChanges struct {
+	Added   []Tag    `json:"added,omitempty"`
+	Changed []Tag    `json:"changed,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+}
+
+// SyncTags makes the tags of the existing role targetRoleName match the
+// tags of sourceRoleName, edited with SetTags and RemoveTags. Policies and
+// the trust policy are left untouched.
+func (d *Duplicator) SyncTags(ctx context.Context, sourceRoleName string, targetRoleName string) (*TagChanges, error) {
+	sourceRole, err := DescribeRole(ctx, d.Client, sourceRoleName)
+	if err != nil {
+		return nil, roleNotFound("source", sourceRoleName, fmt.Errorf("unable to get source role %s, %w", sourceRoleName, err))
+	}
+
+	targetRole, err := DescribeRole(ctx, d.Target, targetRoleName)
+	if err != nil {
+		return nil, roleNotFound("target", targetRoleName, fmt.Errorf("unable to get target role %s, %w", targetRoleName, err))
+	}
+
+	err = d.checkProtected(targetRoleName)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := diffTags(EditTags(sourceRole.Tags, d.SetTags, d.RemoveTags), targetRole.Tags)
+	if len(changes.Added) == 0 && len(changes.Changed) == 0 && len(changes.Removed) == 0 {
+		return changes, nil
+	}
+
+	if d.DryRun {
+		return changes, nil
+	}
+
+	err = d.confirm(ctx, "update the tags of role "+targetRoleName)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := append(append([]Tag(nil), changes.Added...), changes.Changed...)
+	if len(tags) > 0 {
+		params := iam.TagRoleInput{
+			RoleName: &targetRoleName,
+		}
+
+		for _, tag := range tags {
+			params.Tags = append(params.Tags, types.Tag{
+				Key:   aws.String(tag.Key),
+				Value: aws.String(tag.Value),
+			})
+		}
+
+		_, err = d.Target.TagRole(ctx, &params)
+		if err != nil {
+			return nil, &OpError{Op: "TagRole", RoleName: targetRoleName, Err: err}
+		}
+	}
+
+	if len(changes.Removed) > 0 {
+		params := iam.UntagRoleInput{
+			RoleName: &targetRoleName,
+			TagKeys:  changes.Removed,
+		}
+
+		_, err = d.Target.UntagRole(ctx, &params)
+		if err != nil {
+			return nil, &OpError{Op: "UntagRole", RoleName: targetRoleName, Err: err}
+		}
+	}
+
+	return changes, nil
+}
+
+// diffTags returns the changes turning target into source.
+func diffTags(source []Tag, target []Tag) *TagChanges {
+	targetValues := make(map[string]string, len(target))
+	for _, tag := range target {
+		targetValues[tag.Key] = tag.Value
+	}
+
+	sourceKeys := make(map[string]bool, len(source))
+	changes := &TagChanges{}
+	for _, tag := range source {
+		sourceKeys[tag.Key] = true
+
+		value, ok := targetValues[tag.Key]
+		if !ok {
+			changes.Added = append(changes.Added, tag)
+		} else if value != tag.Value {
+			changes.Changed = append(changes.Changed, tag)
+		}
+	}
+
+	for _, tag := range target {
+		if !sourceKeys[tag.Key] {
+			changes.Removed = append(changes.Removed, tag.Key)
+		}
+	}
+	sort.Strings(changes.Removed)
+
+	return changes
+}
+
+func toTags(tags []types.Tag) []Tag {
+	var converted []Tag
+	for _, tag := range tags {
+		converted = append(converted, Tag{Key: *tag.Key, Value: *tag.Value})
+	}
+
+	return converted
+}
@@ -0,0 +1,163 @@
+package iamdup
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// render returns snapshot with the duplicator's overrides and extra
+// policies applied, as it would be written to targetRoleName, without
+// writing anything.
+func (d *Duplicator) render(ctx context.Context, snapshot *Snapshot, targetRoleName string) (*Snapshot, error) {
+	err := ValidateRoleName(targetRoleName)
+	if err != nil {
+		return nil, err
+	}
+
+	err = d.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot, err = d.inlineManagedPolicies(ctx, snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot, err = d.transform(ctx, snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	err = snapshot.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	err = d.addAttachPolicies(ctx, snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	return snapshot, nil
+}
+
+// WriteTerraform writes to w the Terraform configuration of an
+// aws_iam_role named targetRoleName matching snapshot, with its
+// aws_iam_role_policy and aws_iam_role_policy_attachment resources. Nothing
+// is created in the target account.
+func (d *Duplicator) WriteTerraform(ctx context.Context, snapshot *Snapshot, targetRoleName string, w io.Writer) error {
+	snapshot, err := d.render(ctx, snapshot, targetRoleName)
+	if err != nil {
+		return err
+	}
+
+	out := bufio.NewWriter(w)
+	labels := make(map[string]bool)
+	roleLabel := terraformLabel(targetRoleName, labels)
+
+	fmt.Fprintf(out, "resource \"aws_iam_role\" %q {\n", roleLabel)
+	fmt.Fprintf(out, "  name                 = %s\n", hclString(targetRoleName))
+	if snapshot.Path != "" {
+		fmt.Fprintf(out, "  path                 = %s\n", hclString(snapshot.Path))
+	}
+	if snapshot.Description != "" {
+		fmt.Fprintf(out, "  description          = %s\n", hclString(snapshot.Description))
+	}
+	if snapshot.MaxSessionDuration != 0 {
+		fmt.Fprintf(out, "  max_session_duration = %d\n", snapshot.MaxSessionDuration)
+	}
+	if snapshot.PermissionsBoundaryArn != "" {
+		fmt.Fprintf(out, "  permissions_boundary = %s\n", hclString(snapshot.PermissionsBoundaryArn))
+	}
+
+	document, err := hclHeredoc(snapshot.AssumeRolePolicyDocument, "  ")
+	if err != nil {
+		return fmt.Errorf("invalid assume role policy document, %w", err)
+	}
+	fmt.Fprintf(out, "  assume_role_policy   = %s\n", document)
+
+	if len(snapshot.Tags) > 0 {
+		fmt.Fprintf(out, "\n  tags = {\n")
+		for _, tag := range snapshot.Tags {
+			fmt.Fprintf(out, "    %s = %s\n", hclString(tag.Key), hclString(tag.Value))
+		}
+		fmt.Fprintf(out, "  }\n")
+	}
+	fmt.Fprintf(out, "}\n")
+
+	for _, policy := range snapshot.InlinePolicies {
+		document, err := hclHeredoc(policy.Document, "  ")
+		if err != nil {
+			return fmt.Errorf("invalid inline policy %s, %w", policy.Name, err)
+		}
+
+		fmt.Fprintf(out, "\nresource \"aws_iam_role_policy\" %q {\n", terraformLabel(roleLabel+"_"+policy.Name, labels))
+		fmt.Fprintf(out, "  name   = %s\n", hclString(policy.Name))
+		fmt.Fprintf(out, "  role   = aws_iam_role.%s.id\n", roleLabel)
+		fmt.Fprintf(out, "  policy = %s\n", document)
+		fmt.Fprintf(out, "}\n")
+	}
+
+	for _, policy := range snapshot.ManagedPolicies {
+		fmt.Fprintf(out, "\nresource \"aws_iam_role_policy_attachment\" %q {\n", terraformLabel(roleLabel+"_"+policy.Name, labels))
+		fmt.Fprintf(out, "  role       = aws_iam_role.%s.name\n", roleLabel)
+		fmt.Fprintf(out, "  policy_arn = %s\n", hclString(policy.Arn))
+		fmt.Fprintf(out, "}\n")
+	}
+
+	return out.Flush()
+}
+
+var terraformLabelInvalid = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+// terraformLabel turns name into a resource label Terraform accepts,
+// made unique among the labels already used.
+func terraformLabel(name string, used map[string]bool) string {
+	label := terraformLabelInvalid.ReplaceAllString(name, "_")
+	if label == "" || (label[0] >= '0' && label[0] <= '9') || label[0] == '-' {
+		label = "_" + label
+	}
+
+	unique := label
+	for i := 2; used[unique]; i++ {
+		unique = label + "_" + strconv.Itoa(i)
+	}
+	used[unique] = true
+
+	return unique
+}
+
+// hclEscapeTemplates escapes the ${ and %{ sequences that HCL would
+// otherwise read as interpolations, such as in ${aws:username}.
+var hclEscapeTemplates = strings.NewReplacer("${", "$${", "%{", "%%{")
+
+// hclString quotes s as an HCL string literal.
+func hclString(s string) string {
+	return hclEscapeTemplates.Replace(strconv.Quote(s))
+}
+
+// hclHeredoc formats document as an indented heredoc whose lines are
+// prefixed with indent.
+func hclHeredoc(document json.RawMessage, indent string) (string, error) {
+	normalized, err := NormalizeDocument(document)
+	if err != nil {
+		return "", err
+	}
+
+	var heredoc strings.Builder
+	heredoc.WriteString("<<-EOT\n")
+	for _, line := range bytes.Split(normalized, []byte("\n")) {
+		heredoc.WriteString(indent + "  " + hclEscapeTemplates.Replace(string(line)) + "\n")
+	}
+	heredoc.WriteString(indent + "EOT")
+
+	return heredoc.String(), nil
+}
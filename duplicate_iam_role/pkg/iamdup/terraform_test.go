@@ -0,0 +1,71 @@
+package iamdup
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files of testdata")
+
+// goldenSnapshot is the role rendered by the golden file tests.
+func goldenSnapshot() *Snapshot {
+	return &Snapshot{
+		Version:                  SnapshotVersion,
+		RoleName:                 "app",
+		Path:                     "/services/",
+		Description:              `Role of the "app" service`,
+		MaxSessionDuration:       7200,
+		PermissionsBoundaryArn:   "arn:aws:iam::111111111111:policy/boundary",
+		AssumeRolePolicyDocument: json.RawMessage(testTrust),
+		InlinePolicies: []InlinePolicy{
+			{Name: "read", Document: json.RawMessage(testDocument)},
+			{Name: "read.logs", Document: json.RawMessage(`{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":["logs:GetLogEvents","logs:FilterLogEvents"],"Resource":"arn:aws:logs:*:*:log-group:/app/${aws:username}:*"}]}`)},
+		},
+		ManagedPolicies: []ManagedPolicy{
+			{Name: "ReadOnlyAccess", Arn: "arn:aws:iam::aws:policy/ReadOnlyAccess"},
+			{Name: "app-access", Arn: "arn:aws:iam::111111111111:policy/app-access"},
+		},
+		Tags: []Tag{
+			{Key: "team", Value: "platform"},
+			{Key: "cost-center", Value: "42"},
+		},
+	}
+}
+
+// checkGolden compares got with the golden file name of testdata, or
+// rewrites it with -update.
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+
+	path := filepath.Join("testdata", name)
+	if *update {
+		err := os.WriteFile(path, got, 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got, want) {
+		t.Errorf("output differs from %s, run go test -update to rewrite it\ngot:\n%s", path, got)
+	}
+}
+
+func TestWriteTerraform(t *testing.T) {
+	var out bytes.Buffer
+	err := New(nil).WriteTerraform(context.Background(), goldenSnapshot(), "app-copy", &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkGolden(t, "terraform.tf.golden", out.Bytes())
+}
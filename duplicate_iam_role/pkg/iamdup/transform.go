@@ -0,0 +1,352 @@
+package iamdup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// transform returns a copy of snapshot with the duplicator's overrides
+// applied. The snapshot itself is left untouched.
+func (d *Duplicator) transform(ctx context.Context, snapshot *Snapshot) (*Snapshot, error) {
+	transformed := *snapshot
+	transformed.InlinePolicies = append([]InlinePolicy(nil), snapshot.InlinePolicies...)
+	transformed.ManagedPolicies = append([]ManagedPolicy(nil), snapshot.ManagedPolicies...)
+
+	if d.Description != "" {
+		transformed.Description = d.Description
+	}
+
+	if d.Path != "" {
+		transformed.Path = d.Path
+	}
+
+	if len(d.AssumeRolePolicyDocument) > 0 {
+		transformed.AssumeRolePolicyDocument = d.AssumeRolePolicyDocument
+	}
+
+	if len(d.AddTrustPrincipals) > 0 {
+		document, err := AddTrustPrincipals(transformed.AssumeRolePolicyDocument, d.AddTrustPrincipals)
+		if err != nil {
+			return nil, fmt.Errorf("unable to add trust principals, %w", err)
+		}
+		transformed.AssumeRolePolicyDocument = document
+	}
+
+	if d.MaxSessionDuration != 0 {
+		transformed.MaxSessionDuration = d.MaxSessionDuration
+	}
+
+	tags := snapshot.Tags
+	if d.ProvenanceTags {
+		tags = EditTags(tags, []Tag{
+			{Key: "CopiedFrom", Value: snapshot.RoleName},
+			{Key: "CopiedAt", Value: time.Now().UTC().Format(time.RFC3339)},
+		}, nil)
+	}
+	transformed.Tags = EditTags(tags, d.SetTags, d.RemoveTags)
+
+	if len(d.IncludePolicies) > 0 || len(d.ExcludePolicies) > 0 {
+		transformed.InlinePolicies = nil
+		for _, policy := range snapshot.InlinePolicies {
+			if policySelected(d.IncludePolicies, d.ExcludePolicies, policy.Name) {
+				transformed.InlinePolicies = append(transformed.InlinePolicies, policy)
+			}
+		}
+
+		include, err := d.resolvePatterns(ctx, d.IncludePolicies)
+		if err != nil {
+			return nil, err
+		}
+
+		exclude, err := d.resolvePatterns(ctx, d.ExcludePolicies)
+		if err != nil {
+			return nil, err
+		}
+
+		transformed.ManagedPolicies = nil
+		for _, policy := range snapshot.ManagedPolicies {
+			if policySelected(include, exclude, policy.Arn, policy.Name) {
+				transformed.ManagedPolicies = append(transformed.ManagedPolicies, policy)
+			}
+		}
+	}
+
+	if d.SkipBoundary {
+		transformed.PermissionsBoundaryArn = ""
+	}
+
+	if d.SkipInlinePolicies {
+		transformed.InlinePolicies = nil
+	}
+
+	if d.SkipManagedPolicies {
+		transformed.ManagedPolicies = nil
+	}
+
+	if len(d.Replacements) > 0 {
+		err := transformed.mapDocuments(func(name string, document json.RawMessage) (json.RawMessage, error) {
+			return ReplaceInDocument(document, d.Replacements)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to replace in %w", err)
+		}
+	}
+
+	if d.SplitOversize {
+		var split []InlinePolicy
+		for _, policy := range transformed.InlinePolicies {
+			policies, err := SplitInlinePolicy(policy)
+			if err != nil {
+				return nil, err
+			}
+			split = append(split, policies...)
+		}
+		transformed.InlinePolicies = split
+	}
+
+	if d.TargetPartition != "" {
+		document, err := RewriteDocumentPartition(transformed.AssumeRolePolicyDocument, d.TargetPartition)
+		if err != nil {
+			return nil, fmt.Errorf("unable to rewrite partition of assume role policy document, %w", err)
+		}
+		transformed.AssumeRolePolicyDocument = document
+
+		transformed.PermissionsBoundaryArn = RewriteArnPartition(transformed.PermissionsBoundaryArn, d.TargetPartition)
+		for i := range transformed.ManagedPolicies {
+			transformed.ManagedPolicies[i].Arn = RewriteArnPartition(transformed.ManagedPolicies[i].Arn, d.TargetPartition)
+		}
+	}
+
+	if d.PermissionsBoundaryArn != "" {
+		transformed.PermissionsBoundaryArn = d.PermissionsBoundaryArn
+	}
+
+	if d.PolicyNameTemplate != "" {
+		err := renamePolicies(&transformed, d.PolicyNameTemplate)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if d.Lockdown {
+		err := lockdown(&transformed)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if d.NormalizeJSON {
+		err := transformed.mapDocuments(func(name string, document json.RawMessage) (json.RawMessage, error) {
+			return NormalizeDocument(document)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to normalize %w", err)
+		}
+	}
+
+	return &transformed, nil
+}
+
+// ValidateMaxSessionDuration checks that seconds is within the range IAM
+// accepts for a role's maximum session duration.
+func ValidateMaxSessionDuration(seconds int) error {
+	if seconds < 3600 || seconds > 43200 {
+		return fmt.Errorf("max session duration %d must be between 3600 and 43200 seconds", seconds)
+	}
+
+	return nil
+}
+
+// policySelected reports whether a policy known by any of names passes the
+// include and exclude patterns. Excludes win over includes.
+func policySelected(include []string, exclude []string, names ...string) bool {
+	if matchAny(exclude, names) {
+		return false
+	}
+
+	return len(include) == 0 || matchAny(include, names)
+}
+
+// resolvePatterns returns patterns with the plain names of customer managed
+// policies of the source account replaced by their ARN, so that they do not
+// select an AWS managed policy of the same name. Other names are kept, they
+// may name an AWS managed or an inline policy.
+func (d *Duplicator) resolvePatterns(ctx context.Context, patterns []string) ([]string, error) {
+	resolved := make([]string, 0, len(patterns))
+	for _, pattern := range patterns {
+		if strings.HasPrefix(pattern, "arn:") || strings.ContainsAny(pattern, `*?[\`) {
+			resolved = append(resolved, pattern)
+			continue
+		}
+
+		policyArn, err := d.sourcePolicyArn(ctx, pattern)
+		if errors.Is(err, ErrPolicyNotFound) {
+			resolved = append(resolved, pattern)
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("unable to resolve policy filter %s, %w", pattern, err)
+		}
+		resolved = append(resolved, policyArn)
+	}
+
+	return resolved, nil
+}
+
+// matchAny reports whether any of names matches any of the glob patterns.
+// Patterns are checked by ValidatePatterns beforehand.
+func matchAny(patterns []string, names []string) bool {
+	for _, pattern := range patterns {
+		for _, name := range names {
+			if matched, _ := path.Match(pattern, name); matched {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// ValidatePatterns checks that every pattern is a valid glob.
+func ValidatePatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		_, err := path.Match(pattern, "")
+		if err != nil {
+			return fmt.Errorf("invalid pattern %q, %w", pattern, err)
+		}
+	}
+
+	return nil
+}
+
+// EditTags returns tags with the keys in remove dropped and the tags in set
+// added. A tag in set replaces an existing tag with the same key, keeping
+// its position. Removing a key that is not present is a no-op.
+func EditTags(tags []Tag, set []Tag, remove []string) []Tag {
+	removed := make(map[string]bool, len(remove))
+	for _, key := range remove {
+		removed[key] = true
+	}
+
+	var edited []Tag
+	for _, tag := range tags {
+		if !removed[tag.Key] {
+			edited = append(edited, tag)
+		}
+	}
+
+	for _, tag := range set {
+		replaced := false
+		for i := range edited {
+			if edited[i].Key == tag.Key {
+				edited[i].Value = tag.Value
+				replaced = true
+			}
+		}
+
+		if !replaced {
+			edited = append(edited, tag)
+		}
+	}
+
+	return edited
+}
+
+// MaxRoleNameLength is the longest role name IAM accepts.
+const MaxRoleNameLength = 64
+
+var roleNamePattern = regexp.MustCompile(`^[\w+=,.@-]+$`)
+
+// ValidateRoleName checks that name is a role name IAM accepts, so that a
+// bad name is reported before any call is made.
+func ValidateRoleName(name string) error {
+	if name == "" || len(name) > MaxRoleNameLength {
+		return fmt.Errorf("role name %q must be between 1 and %d characters", name, MaxRoleNameLength)
+	}
+
+	if !roleNamePattern.MatchString(name) {
+		return fmt.Errorf("role name %q may only contain letters, digits and +=,.@_-", name)
+	}
+
+	return nil
+}
+
+// MaxPolicyNameLength is the longest inline policy name IAM accepts.
+const MaxPolicyNameLength = 128
+
+// ValidatePolicyName checks that name is an inline policy name IAM accepts.
+func ValidatePolicyName(name string) error {
+	if name == "" || len(name) > MaxPolicyNameLength {
+		return fmt.Errorf("policy name %q must be between 1 and %d characters", name, MaxPolicyNameLength)
+	}
+
+	if !roleNamePattern.MatchString(name) {
+		return fmt.Errorf("policy name %q may only contain letters, digits and +=,.@_-", name)
+	}
+
+	return nil
+}
+
+// PolicyNameData is the data of a PolicyNameTemplate: the name of the
+// inline policy and of the source role it comes from.
+type PolicyNameData struct {
+	Name   string
+	Source string
+}
+
+// ParsePolicyNameTemplate parses a PolicyNameTemplate.
+func ParsePolicyNameTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("policy-name").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid policy name template %q, %w", text, err)
+	}
+
+	return tmpl, nil
+}
+
+// renamePolicies renders the name of every inline policy of snapshot with
+// the PolicyNameTemplate text, and checks the new names.
+func renamePolicies(snapshot *Snapshot, text string) error {
+	tmpl, err := ParsePolicyNameTemplate(text)
+	if err != nil {
+		return err
+	}
+
+	renamed := make(map[string]bool, len(snapshot.InlinePolicies))
+	for i, policy := range snapshot.InlinePolicies {
+		var name strings.Builder
+		err = tmpl.Execute(&name, PolicyNameData{Name: policy.Name, Source: snapshot.RoleName})
+		if err != nil {
+			return fmt.Errorf("unable to render the name of inline policy %s, %w", policy.Name, err)
+		}
+
+		err = ValidatePolicyName(name.String())
+		if err != nil {
+			return fmt.Errorf("invalid name for inline policy %s, %w", policy.Name, err)
+		}
+
+		if renamed[name.String()] {
+			return fmt.Errorf("inline policy %s is renamed to %s, like another policy", policy.Name, name.String())
+		}
+		renamed[name.String()] = true
+
+		snapshot.InlinePolicies[i].Name = name.String()
+	}
+
+	return nil
+}
+
+// ValidatePath checks that path has the /path/ form required by IAM.
+func ValidatePath(path string) error {
+	if !strings.HasPrefix(path, "/") || !strings.HasSuffix(path, "/") {
+		return fmt.Errorf("path %q must begin and end with /", path)
+	}
+
+	return nil
+}
@@ -0,0 +1,196 @@
+package iamdup
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestEditTags(t *testing.T) {
+	tags := []Tag{{"team", "core"}, {"env", "prod"}, {"owner", "alice"}}
+
+	tests := []struct {
+		name   string
+		set    []Tag
+		remove []string
+		want   []Tag
+	}{
+		{name: "unchanged", want: tags},
+		{name: "add", set: []Tag{{"cost", "42"}}, want: []Tag{{"team", "core"}, {"env", "prod"}, {"owner", "alice"}, {"cost", "42"}}},
+		{name: "replace keeps position", set: []Tag{{"env", "staging"}}, want: []Tag{{"team", "core"}, {"env", "staging"}, {"owner", "alice"}}},
+		{name: "remove", remove: []string{"env"}, want: []Tag{{"team", "core"}, {"owner", "alice"}}},
+		{name: "remove missing key", remove: []string{"missing"}, want: tags},
+		{name: "remove then set", set: []Tag{{"env", "staging"}}, remove: []string{"env"}, want: []Tag{{"team", "core"}, {"owner", "alice"}, {"env", "staging"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := append([]Tag(nil), tags...)
+
+			got := EditTags(tags, tt.set, tt.remove)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("EditTags() = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(tags, original) {
+				t.Errorf("EditTags() modified its input to %v", tags)
+			}
+		})
+	}
+}
+
+func TestPolicySelected(t *testing.T) {
+	tests := []struct {
+		name    string
+		include []string
+		exclude []string
+		names   []string
+		want    bool
+	}{
+		{name: "no filters", names: []string{"app"}, want: true},
+		{name: "include matches", include: []string{"app-*"}, names: []string{"app-read"}, want: true},
+		{name: "include does not match", include: []string{"app-*"}, names: []string{"db-read"}, want: false},
+		{name: "exclude matches", exclude: []string{"*-write"}, names: []string{"app-write"}, want: false},
+		{name: "exclude does not match", exclude: []string{"*-write"}, names: []string{"app-read"}, want: true},
+		{name: "exclude wins", include: []string{"app-*"}, exclude: []string{"*-write"}, names: []string{"app-write"}, want: false},
+		{name: "ARN matches", include: []string{"arn:aws:iam::aws:policy/*"}, names: []string{"ReadOnlyAccess", "arn:aws:iam::aws:policy/ReadOnlyAccess"}, want: true},
+		{name: "name matches", include: []string{"ReadOnly*"}, names: []string{"ReadOnlyAccess", "arn:aws:iam::aws:policy/ReadOnlyAccess"}, want: true},
+		{name: "star does not cross slashes", include: []string{"arn:aws:iam::*"}, names: []string{"arn:aws:iam::aws:policy/ReadOnlyAccess"}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policySelected(tt.include, tt.exclude, tt.names...); got != tt.want {
+				t.Errorf("policySelected(%q) = %v, want %v", tt.names, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidatePatterns(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		wantErr  bool
+	}{
+		{nil, false},
+		{[]string{"app-*", "arn:aws:iam::aws:policy/*", "db-?"}, false},
+		{[]string{"app-*", "[unclosed"}, true},
+		{[]string{`trailing\`}, true},
+	}
+
+	for _, tt := range tests {
+		err := ValidatePatterns(tt.patterns)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ValidatePatterns(%q) error = %v, wantErr %v", tt.patterns, err, tt.wantErr)
+		}
+	}
+}
+
+func TestPolicyFiltersResolveCustomerPolicyNames(t *testing.T) {
+	tests := []struct {
+		name    string
+		exclude []string
+		want    []string
+	}{
+		{"found", []string{"ReadOnlyAccess"}, []string{"arn:aws:iam::aws:policy/ReadOnlyAccess", "arn:aws:iam::aws:policy/ViewOnlyAccess"}},
+		{"not found", []string{"ViewOnlyAccess"}, []string{"arn:aws:iam::111111111111:policy/ReadOnlyAccess", "arn:aws:iam::aws:policy/ReadOnlyAccess"}},
+		{"glob", []string{"ReadOnly*"}, []string{"arn:aws:iam::aws:policy/ViewOnlyAccess"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newFakeIAM("111111111111")
+			customerArn := client.addPolicy("ReadOnlyAccess", testDocument)
+			source := client.addRole("app", testTrust)
+			source.attach("ReadOnlyAccess", "arn:aws:iam::aws:policy/ReadOnlyAccess")
+			source.attach("ReadOnlyAccess", customerArn)
+			source.attach("ViewOnlyAccess", "arn:aws:iam::aws:policy/ViewOnlyAccess")
+
+			d := New(client)
+			d.ExcludePolicies = tt.exclude
+
+			_, err := d.Duplicate(context.Background(), "app", "app-copy")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := client.attachedArns("app-copy")
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("attached policies = %q, want %q", got, tt.want)
+			}
+
+			if got := client.callsTo("ListPolicies"); len(got) > 1 {
+				t.Errorf("ListPolicies called for %q, want the policies listed once", got)
+			}
+		})
+	}
+}
+
+func TestValidateRoleName(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{"app", false},
+		{"App_Role+=,.@-1", false},
+		{strings.Repeat("a", MaxRoleNameLength), false},
+		{"", true},
+		{strings.Repeat("a", MaxRoleNameLength+1), true},
+		{"has space", true},
+		{"path/app", true},
+		{"app:role", true},
+		{"rôle", true},
+	}
+
+	for _, tt := range tests {
+		err := ValidateRoleName(tt.name)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ValidateRoleName(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestPolicyNameTemplate(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		want     []string
+		wantErr  bool
+	}{
+		{name: "prefix", template: "prod-{{.Name}}", want: []string{"prod-s3", "prod-sqs"}},
+		{name: "source", template: "{{.Source}}-{{.Name}}", want: []string{"app-s3", "app-sqs"}},
+		{name: "invalid name", template: "prod {{.Name}}", wantErr: true},
+		{name: "same name", template: "prod", wantErr: true},
+		{name: "unknown field", template: "{{.Missing}}", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newFakeIAM("111111111111")
+			source := client.addRole("app", testTrust)
+			source.putInline("s3", testDocument)
+			source.putInline("sqs", testDocument)
+
+			d := New(client)
+			d.PolicyNameTemplate = tt.template
+
+			_, err := d.Duplicate(context.Background(), "app", "app-copy")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				if client.hasRole("app-copy") {
+					t.Error("target role created despite the invalid names")
+				}
+				return
+			}
+
+			if got := client.inlineNames("app-copy"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("inline policies = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
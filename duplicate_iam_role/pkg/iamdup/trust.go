@@ -0,0 +1,182 @@
+package iamdup
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+)
+
+var accountIDPattern = regexp.MustCompile(`^[0-9]{12}$`)
+
+// CopyTrustPolicy replaces the assume role policy document of the existing
+// role targetRoleName with the one of sourceRoleName, leaving everything
+// else untouched.
+func CopyTrustPolicy(ctx context.Context, client IAMClient, sourceRoleName string, targetRoleName string) error {
+	role, err := DescribeRole(ctx, client, sourceRoleName)
+	if err != nil {
+		return roleNotFound("source", sourceRoleName, err)
+	}
+
+	policyDocument := string(role.AssumeRolePolicyDocument)
+	params := iam.UpdateAssumeRolePolicyInput{
+		RoleName:       &targetRoleName,
+		PolicyDocument: &policyDocument,
+	}
+
+	_, err = client.UpdateAssumeRolePolicy(ctx, &params)
+	if err != nil {
+		return roleNotFound("target", targetRoleName, &OpError{Op: "UpdateAssumeRolePolicy", RoleName: targetRoleName, Err: err})
+	}
+
+	return nil
+}
+
+// ValidateTrustPrincipal checks that principal is an ARN or an account ID,
+// the two forms accepted in the AWS element of a Principal.
+func ValidateTrustPrincipal(principal string) error {
+	if strings.HasPrefix(principal, "arn:") || accountIDPattern.MatchString(principal) {
+		return nil
+	}
+
+	return fmt.Errorf("invalid trust principal %q, expected an ARN or an account ID", principal)
+}
+
+// AddTrustPrincipals adds principals to the AWS principals of the first
+// statement of document allowing sts:AssumeRole to AWS principals. A new
+// statement is added when there is none. Other statements are kept as
+// they are.
+func AddTrustPrincipals(document json.RawMessage, principals []string) (json.RawMessage, error) {
+	var parsed map[string]json.RawMessage
+	err := json.Unmarshal(document, &parsed)
+	if err != nil {
+		return nil, fmt.Errorf("document is not a valid JSON object, %w", err)
+	}
+
+	var statements []json.RawMessage
+	single := false
+	if trimmed := bytes.TrimSpace(parsed["Statement"]); len(trimmed) > 0 && trimmed[0] == '{' {
+		statements = []json.RawMessage{trimmed}
+		single = true
+	} else if len(trimmed) > 0 {
+		err = json.Unmarshal(trimmed, &statements)
+		if err != nil {
+			return nil, fmt.Errorf("document Statement is not a list, %w", err)
+		}
+	}
+
+	merged := false
+	for i, raw := range statements {
+		var statement map[string]interface{}
+		decoder := json.NewDecoder(bytes.NewReader(raw))
+		decoder.UseNumber()
+		err = decoder.Decode(&statement)
+		if err != nil {
+			return nil, fmt.Errorf("invalid statement, %w", err)
+		}
+
+		principal, ok := statement["Principal"].(map[string]interface{})
+		if !ok || statement["Effect"] != "Allow" || !allowsAssumeRole(statement["Action"]) || principal["AWS"] == nil {
+			continue
+		}
+
+		principal["AWS"] = appendPrincipals(principal["AWS"], principals)
+		statements[i], err = encodeJSON(statement)
+		if err != nil {
+			return nil, err
+		}
+		merged = true
+		break
+	}
+
+	if !merged {
+		statement, err := encodeJSON(map[string]interface{}{
+			"Effect":    "Allow",
+			"Principal": map[string]interface{}{"AWS": appendPrincipals(nil, principals)},
+			"Action":    "sts:AssumeRole",
+		})
+		if err != nil {
+			return nil, err
+		}
+		statements = append(statements, statement)
+		single = false
+	}
+
+	if single {
+		parsed["Statement"] = statements[0]
+	} else {
+		parsed["Statement"], err = encodeJSON(statements)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return encodeJSON(parsed)
+}
+
+// allowsAssumeRole reports whether action, a string or a list of strings,
+// contains sts:AssumeRole.
+func allowsAssumeRole(action interface{}) bool {
+	switch v := action.(type) {
+	case string:
+		return v == "sts:AssumeRole"
+	case []interface{}:
+		for _, a := range v {
+			if a == "sts:AssumeRole" {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// appendPrincipals adds the missing principals to existing, a string or a
+// list, and returns a string for a single principal and a list otherwise.
+func appendPrincipals(existing interface{}, principals []string) interface{} {
+	var merged []interface{}
+	switch v := existing.(type) {
+	case string:
+		merged = append(merged, v)
+	case []interface{}:
+		merged = append(merged, v...)
+	}
+
+	for _, principal := range principals {
+		found := false
+		for _, m := range merged {
+			if m == principal {
+				found = true
+			}
+		}
+
+		if !found {
+			merged = append(merged, principal)
+		}
+	}
+
+	if len(merged) == 1 {
+		return merged[0]
+	}
+
+	return merged
+}
+
+// encodeJSON marshals v without escaping HTML characters, which are
+// common in policy conditions.
+func encodeJSON(v interface{}) (json.RawMessage, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+
+	err := encoder.Encode(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.RawMessage(bytes.TrimSpace(buf.Bytes())), nil
+}
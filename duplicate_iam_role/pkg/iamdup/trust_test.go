@@ -0,0 +1,87 @@
+package iamdup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"testing"
+)
+
+func TestAddTrustPrincipals(t *testing.T) {
+	tests := []struct {
+		name       string
+		document   string
+		principals []string
+		want       string
+	}{
+		{
+			name:       "into an array",
+			document:   `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"AWS":["arn:aws:iam::111111111111:root","arn:aws:iam::222222222222:root"]},"Action":"sts:AssumeRole"}]}`,
+			principals: []string{"arn:aws:iam::222222222222:root", "333333333333"},
+			want:       `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"AWS":["arn:aws:iam::111111111111:root","arn:aws:iam::222222222222:root","333333333333"]},"Action":"sts:AssumeRole"}]}`,
+		},
+		{
+			name:       "into a scalar",
+			document:   `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"AWS":"arn:aws:iam::111111111111:root"},"Action":["sts:AssumeRole","sts:TagSession"]}]}`,
+			principals: []string{"333333333333"},
+			want:       `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"AWS":["arn:aws:iam::111111111111:root","333333333333"]},"Action":["sts:AssumeRole","sts:TagSession"]}]}`,
+		},
+		{
+			name:       "scalar already present",
+			document:   `{"Version":"2012-10-17","Statement":{"Effect":"Allow","Principal":{"AWS":"333333333333"},"Action":"sts:AssumeRole"}}`,
+			principals: []string{"333333333333"},
+			want:       `{"Version":"2012-10-17","Statement":{"Effect":"Allow","Principal":{"AWS":"333333333333"},"Action":"sts:AssumeRole"}}`,
+		},
+		{
+			name:       "new statement",
+			document:   testTrust,
+			principals: []string{"333333333333"},
+			want:       `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"Service":"ec2.amazonaws.com"},"Action":"sts:AssumeRole"},{"Effect":"Allow","Principal":{"AWS":"333333333333"},"Action":"sts:AssumeRole"}]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := AddTrustPrincipals(json.RawMessage(tt.document), tt.principals)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			equal, err := EqualDocuments(got, json.RawMessage(tt.want))
+			if err != nil || !equal {
+				t.Errorf("AddTrustPrincipals() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCopyTrustPolicyDecodesDocument(t *testing.T) {
+	trust := `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"AWS":"arn:aws:iam::111111111111:root"},"Action":"sts:AssumeRole","Condition":{"StringLike":{"sts:ExternalId":"a b&c+d/%"}}}]}`
+
+	client := newFakeIAM("111111111111")
+	client.addRole("app", trust)
+	client.addRole("app-copy", testTrust).putInline("kept", testDocument)
+
+	err := CopyTrustPolicy(context.Background(), client, "app", "app-copy")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	document, err := url.PathUnescape(*client.roles["app-copy"].role.AssumeRolePolicyDocument)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if equal, err := EqualDocuments(json.RawMessage(document), json.RawMessage(trust)); err != nil || !equal {
+		t.Errorf("UpdateAssumeRolePolicy sent %s, want the decoded %s", document, trust)
+	}
+
+	if got := client.inlineNames("app-copy"); len(got) != 1 {
+		t.Errorf("inline policies = %q, want the target left untouched", got)
+	}
+
+	err = CopyTrustPolicy(context.Background(), client, "app", "missing")
+	if !errors.Is(err, ErrRoleNotFound) {
+		t.Errorf("CopyTrustPolicy to a missing role error = %v, want ErrRoleNotFound", err)
+	}
+}
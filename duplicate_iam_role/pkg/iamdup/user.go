@@ -0,0 +1,171 @@
+package iamdup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+// DuplicateUser creates targetUserName as a copy of sourceUserName,
+// including its path, permissions boundary, tags, inline policies and
+// managed policies. Login profiles and access keys are never copied since
+// that would duplicate credentials.
+func (d *Duplicator) DuplicateUser(ctx context.Context, sourceUserName string, targetUserName string) error {
+	err := d.Validate()
+	if err != nil {
+		return err
+	}
+
+	sourceUser, err := d.Client.GetUser(ctx, &iam.GetUserInput{
+		UserName: &sourceUserName,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to get source user, %w", &OpError{Op: "GetUser", UserName: sourceUserName, Err: err})
+	}
+
+	inlinePolicies, err := GetUserInlinePolicies(ctx, d.Client, sourceUserName)
+	if err != nil {
+		return fmt.Errorf("unable to get inline policies, %w", err)
+	}
+
+	managedPolicies, err := GetUserManagedPolicies(ctx, d.Client, sourceUserName)
+	if err != nil {
+		return fmt.Errorf("unable to get managed policies, %w", err)
+	}
+
+	for _, policy := range inlinePolicies {
+		err = ValidateDocument(policy.Document)
+		if err != nil {
+			return fmt.Errorf("invalid inline policy %s, %w", policy.Name, err)
+		}
+	}
+
+	params := iam.CreateUserInput{
+		UserName: &targetUserName,
+		Path:     sourceUser.User.Path,
+	}
+
+	if d.Path != "" {
+		params.Path = &d.Path
+	}
+
+	if sourceUser.User.PermissionsBoundary != nil {
+		params.PermissionsBoundary = sourceUser.User.PermissionsBoundary.PermissionsBoundaryArn
+	}
+
+	var tags []Tag
+	for _, tag := range sourceUser.User.Tags {
+		tags = append(tags, Tag{Key: *tag.Key, Value: *tag.Value})
+	}
+	for _, tag := range EditTags(tags, d.SetTags, d.RemoveTags) {
+		params.Tags = append(params.Tags, types.Tag{
+			Key:   aws.String(tag.Key),
+			Value: aws.String(tag.Value),
+		})
+	}
+
+	if d.DryRun {
+		fmt.Fprintf(d.Out, "[dry-run] create user %s\n", targetUserName)
+		for _, policy := range inlinePolicies {
+			fmt.Fprintf(d.Out, "[dry-run]   put inline policy %s (%d bytes)\n", policy.Name, len(policy.Document))
+		}
+		for _, policy := range managedPolicies {
+			fmt.Fprintf(d.Out, "[dry-run]   attach managed policy %s\n", policy.Arn)
+		}
+		fmt.Fprintln(d.Out, "[dry-run]   login profile and access keys are not copied")
+		return nil
+	}
+
+	err = d.confirm(ctx, "create user "+targetUserName)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.Target.CreateUser(ctx, &params)
+	if err != nil {
+		return fmt.Errorf("unable to create user, %w", &OpError{Op: "CreateUser", UserName: targetUserName, Err: err})
+	}
+
+	// A failing policy does not stop the others, as for roles.
+	var errs []error
+	for _, policy := range inlinePolicies {
+		policyDocument := string(policy.Document)
+
+		_, err = d.Target.PutUserPolicy(ctx, &iam.PutUserPolicyInput{
+			UserName:       &targetUserName,
+			PolicyName:     aws.String(policy.Name),
+			PolicyDocument: &policyDocument,
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to add inline policy %s, %w", policy.Name, &OpError{Op: "PutUserPolicy", UserName: targetUserName, PolicyName: policy.Name, Err: err}))
+		}
+	}
+
+	for _, policy := range managedPolicies {
+		_, err = d.Target.AttachUserPolicy(ctx, &iam.AttachUserPolicyInput{
+			UserName:  &targetUserName,
+			PolicyArn: aws.String(policy.Arn),
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to add managed policy %s, %w", policy.Arn, &OpError{Op: "AttachUserPolicy", UserName: targetUserName, PolicyName: policy.Arn, Err: err}))
+		}
+	}
+
+	d.warn(fmt.Sprintf("login profile and access keys of %s were not copied", sourceUserName))
+
+	return errors.Join(errs...)
+}
+
+func GetUserInlinePolicies(ctx context.Context, client IAMClient, userName string) ([]InlinePolicy, error) {
+	params := iam.ListUserPoliciesInput{
+		UserName: &userName,
+	}
+
+	var policyNames []string
+
+	paginator := iam.NewListUserPoliciesPaginator(client, &params)
+	for paginator.HasMorePages() {
+		userPolicies, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, &OpError{Op: "ListUserPolicies", UserName: userName, Err: err}
+		}
+
+		policyNames = append(policyNames, userPolicies.PolicyNames...)
+	}
+
+	return getInlinePolicies(policyNames, func(policyName string) (*string, error) {
+		userPolicy, err := client.GetUserPolicy(ctx, &iam.GetUserPolicyInput{
+			UserName:   &userName,
+			PolicyName: &policyName,
+		})
+		if err != nil {
+			return nil, &OpError{Op: "GetUserPolicy", UserName: userName, PolicyName: policyName, Err: err}
+		}
+
+		return userPolicy.PolicyDocument, nil
+	})
+}
+
+func GetUserManagedPolicies(ctx context.Context, client IAMClient, userName string) ([]ManagedPolicy, error) {
+	params := iam.ListAttachedUserPoliciesInput{
+		UserName: &userName,
+	}
+
+	var managedPolicies []ManagedPolicy
+
+	paginator := iam.NewListAttachedUserPoliciesPaginator(client, &params)
+	for paginator.HasMorePages() {
+		attachedUserPolicies, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, &OpError{Op: "ListAttachedUserPolicies", UserName: userName, Err: err}
+		}
+
+		managedPolicies = append(managedPolicies, toManagedPolicies(attachedUserPolicies.AttachedPolicies)...)
+	}
+
+	return managedPolicies, nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+func duplicatePolicy(args []string) {
+	flags := flag.NewFlagSet(os.Args[0]+" policy", flag.ExitOnError)
+	sourcePolicy := flags.String("source", "", "name or ARN of the customer managed policy that we want to use as a source")
+	targetPolicyName := flags.String("target-name", "", "name of the policy that we want to create, defaults to the source name")
+	var clientFlags clientFlags
+	clientFlags.register(flags)
+	path := flags.String("path", "", "path of the target policy, defaults to the source path")
+	allVersions := flags.Bool("all-versions", false, "also copy the non-default versions of the source policy")
+	dryRun := flags.Bool("dry-run", false, "print the changes without creating anything")
+	yes := flags.Bool("yes", false, "do not ask for confirmation before writing to the target account")
+	flags.Parse(args)
+
+	if *sourcePolicy == "" {
+		usageFatalf("source argument cannot be empty")
+		return
+	}
+
+	ctx, cancel := clientFlags.context()
+	defer cancel()
+	duplicator, err := clientFlags.newDuplicator(ctx)
+	if err != nil {
+		fatal(err)
+		return
+	}
+
+	duplicator.Path = *path
+	duplicator.CloneAllPolicyVersions = *allVersions
+	duplicator.DryRun = *dryRun
+	duplicator.Confirm = confirmUnless(*yes, clientFlags.targetCfg, os.Stdin)
+
+	policyArn, err := duplicator.DuplicatePolicy(ctx, *sourcePolicy, *targetPolicyName)
+	if err != nil {
+		fatal(clientFlags.timeoutError(err))
+		return
+	}
+
+	if policyArn != "" {
+		fmt.Println(policyArn, "created")
+	}
+}
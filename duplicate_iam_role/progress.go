@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+
+	"gitlab.com/renodesper/aws-utils/pkg/iamdup"
+)
+
+// newProgress returns a Progress printing each step on stderr, or nil when
+// quiet or when stderr is not a terminal, so that logs stay clean. With
+// -log-format json each step is logged as an event instead.
+func newProgress(quiet bool) iamdup.Progress {
+	if quiet {
+		return nil
+	}
+
+	if jsonLogs {
+		return func(current int, total int, step string) {
+			slog.Info(step, "step", current, "total", total)
+		}
+	}
+
+	if !isTerminal(os.Stderr) {
+		return nil
+	}
+
+	return func(current int, total int, step string) {
+		fmt.Fprintf(os.Stderr, "[%d/%d] %s\n", current, total, step)
+	}
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
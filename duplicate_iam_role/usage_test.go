@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// usageArgsEnv holds the arguments duplicateRole is run with when the test
+// binary is started again by runUsage.
+const usageArgsEnv = "DUPLICATE_IAM_ROLE_ARGS"
+
+// runUsage runs duplicateRole with args in a new process of the test
+// binary, as usage errors exit, and returns its exit code and output.
+func runUsage(t *testing.T, args ...string) (int, string) {
+	t.Helper()
+
+	cmd := exec.Command(os.Args[0], "-test.run=^"+t.Name()+"$")
+	cmd.Env = append(os.Environ(), usageArgsEnv+"="+strings.Join(args, "\n"))
+	output, err := cmd.CombinedOutput()
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), string(output)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return 0, string(output)
+}
+
+// runUsageChild runs duplicateRole and reports true in the process started
+// by runUsage.
+func runUsageChild() bool {
+	args, ok := os.LookupEnv(usageArgsEnv)
+	if !ok {
+		return false
+	}
+
+	duplicateRole(strings.Split(args, "\n"))
+	return true
+}
+
+func TestFollowTrustRejectsTargetAccounts(t *testing.T) {
+	if runUsageChild() {
+		return
+	}
+
+	code, output := runUsage(t, "-source", "app", "-target", "app", "-follow-trust", "-target-accounts", "accounts.json")
+	if code != exitUsage || !strings.Contains(output, "target-accounts") {
+		t.Errorf("exit code = %d with output %q, want %d rejecting target-accounts", code, output, exitUsage)
+	}
+}
+
+func TestSelfCopyFailsBeforeAnyCall(t *testing.T) {
+	if runUsageChild() {
+		return
+	}
+
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	empty := filepath.Join(t.TempDir(), "empty")
+	err := os.WriteFile(empty, nil, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("AWS_CONFIG_FILE", empty)
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", empty)
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDSOURCE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+
+	batch := filepath.Join(t.TempDir(), "batch")
+	err = os.WriteFile(batch, []byte("web,web-copy\napp,app\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"single", []string{"-source", "app", "-target", "app"}},
+		{"merged", []string{"-source", "web", "-source", "app", "-target", "app"}},
+		{"batch", []string{"-batch", batch}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests.Store(0)
+
+			args := append([]string{"-region", "us-east-1", "-endpoint-url", server.URL, "-quiet"}, tt.args...)
+			code, output := runUsage(t, args...)
+			if code != exitUsage || !strings.Contains(output, "target role app: role would be copied onto itself") {
+				t.Errorf("exit code = %d with output %q, want %d refusing to copy app onto itself", code, output, exitUsage)
+			}
+			if n := requests.Load(); n != 0 {
+				t.Errorf("%d requests sent before refusing the copy", n)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"os"
+)
+
+func duplicateUser(args []string) {
+	flags := flag.NewFlagSet(os.Args[0]+" user", flag.ExitOnError)
+	sourceUserName := flags.String("source", "", "user name that we want to use as a source")
+	targetUserName := flags.String("target", "", "user name that we want to create")
+	var clientFlags clientFlags
+	clientFlags.register(flags)
+	path := flags.String("path", "", "path of the target user, defaults to the source path")
+	var setTags tagsFlag
+	flags.Var(&setTags, "set-tag", "key=value tag to set on the target user, may be repeated")
+	var removeTags stringsFlag
+	flags.Var(&removeTags, "remove-tag", "tag key not to copy to the target user, may be repeated")
+	dryRun := flags.Bool("dry-run", false, "print the changes without creating anything")
+	yes := flags.Bool("yes", false, "do not ask for confirmation before writing to the target account")
+	flags.Parse(args)
+
+	if *sourceUserName == "" {
+		usageFatalf("source argument cannot be empty")
+		return
+	}
+
+	if *targetUserName == "" {
+		usageFatalf("target argument cannot be empty")
+		return
+	}
+
+	ctx, cancel := clientFlags.context()
+	defer cancel()
+	duplicator, err := clientFlags.newDuplicator(ctx)
+	if err != nil {
+		fatal(err)
+		return
+	}
+
+	duplicator.Path = *path
+	duplicator.SetTags = setTags
+	duplicator.RemoveTags = removeTags
+	duplicator.DryRun = *dryRun
+	duplicator.Confirm = confirmUnless(*yes, clientFlags.targetCfg, os.Stdin)
+
+	err = duplicator.DuplicateUser(ctx, *sourceUserName, *targetUserName)
+	if err != nil {
+		fatal(clientFlags.timeoutError(err))
+	}
+}